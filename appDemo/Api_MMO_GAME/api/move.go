@@ -1,42 +1,30 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"zinx_server/appDemo/Api_MMO_GAME/core"
 	"zinx_server/appDemo/Api_MMO_GAME/pb"
 	"zinx_server/zinx/ziface"
 	"zinx_server/zinx/znet"
-
-	"github.com/golang/protobuf/proto"
 )
 
-// MoveApi 玩家移动
-type MoveApi struct {
-	znet.BaseRouter
-}
-
-func (*MoveApi) Handle(request ziface.IRequest) {
-	//1. 将客户端传来的proto协议解码
-	msg := &pb.Position{}
-	err := proto.Unmarshal(request.GetData(), msg)
-	if err != nil {
-		fmt.Println("Move: Position Unmarshal error ", err)
-		return
-	}
-
-	//2. 得知当前的消息是从哪个玩家传递来的,从连接属性pID中获取
-	pID, err := request.GetConnection().GetProperty("pID")
-	if err != nil {
-		fmt.Println("GetProperty pID error", err)
-		request.GetConnection().Stop()
-		return
+// Move 玩家移动，客户端传来的proto协议由HandleTyped解码
+func Move(ctx context.Context, conn ziface.IConnection, msg *pb.Position) (*znet.NoReply, error) {
+	//1. 得知当前的消息是从哪个玩家传递来的,从连接属性pID中获取
+	pID, ok := core.PIDKey.Get(conn)
+	if !ok {
+		conn.Stop()
+		return nil, errors.New("GetProperty pID error")
 	}
 
 	fmt.Printf("user pID = %d , move(%f,%f,%f,%f)\n", pID, msg.X, msg.Y, msg.Z, msg.V)
 
-	//3. 根据pID得到player对象
-	player := core.WorldMgrObj.GetPlayerByPID(pID.(int32))
+	//2. 根据pID得到player对象
+	player := core.WorldMgrObj.GetPlayerByPID(pID)
 
-	//4. 让player对象发起移动位置信息广播
+	//3. 让player对象发起移动位置信息广播
 	player.UpdatePos(msg.X, msg.Y, msg.Z, msg.V)
+	return nil, nil
 }
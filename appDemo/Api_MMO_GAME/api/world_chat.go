@@ -1,39 +1,26 @@
 package api
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"zinx_server/appDemo/Api_MMO_GAME/core"
 	"zinx_server/appDemo/Api_MMO_GAME/pb"
 	"zinx_server/zinx/ziface"
 	"zinx_server/zinx/znet"
-
-	"github.com/golang/protobuf/proto"
 )
 
-// WorldChatApi 世界聊天 路由业务
-type WorldChatApi struct {
-	znet.BaseRouter
-}
-
-func (*WorldChatApi) Handle(request ziface.IRequest) {
-	//1. 将客户端传来的proto协议解码
-	msg := &pb.Talk{}
-	err := proto.Unmarshal(request.GetData(), msg)
-	if err != nil {
-		fmt.Println("Talk Unmarshal error ", err)
-		return
-	}
-
-	//2. 得知当前的消息是从哪个玩家传递来的,从连接属性pID中获取
-	pID, err := request.GetConnection().GetProperty("pID")
-	if err != nil {
-		fmt.Println("GetProperty pID error", err)
-		request.GetConnection().Stop()
-		return
+// WorldChat 世界聊天 路由业务，客户端传来的proto协议由HandleTyped解码
+func WorldChat(ctx context.Context, conn ziface.IConnection, msg *pb.Talk) (*znet.NoReply, error) {
+	//1. 得知当前的消息是从哪个玩家传递来的,从连接属性pID中获取
+	pID, ok := core.PIDKey.Get(conn)
+	if !ok {
+		conn.Stop()
+		return nil, errors.New("GetProperty pID error")
 	}
-	//3. 根据pID得到player对象
-	player := core.WorldMgrObj.GetPlayerByPID(pID.(int32))
+	//2. 根据pID得到player对象
+	player := core.WorldMgrObj.GetPlayerByPID(pID)
 
-	//4. 让player对象发起聊天广播请求
+	//3. 让player对象发起聊天广播请求
 	player.Talk(msg.Content)
+	return nil, nil
 }
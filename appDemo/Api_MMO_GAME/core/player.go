@@ -27,6 +27,9 @@ Player ID 生成器
 var PIDGen int32 = 1  //用来生成玩家ID的计数器
 var IDLock sync.Mutex //保护PIDGen的互斥机制
 
+// 连接上绑定的玩家ID属性
+var PIDKey = ziface.NewKey[int32]("pID")
+
 // 创建一个玩家对象
 func NewPlayer(conn ziface.IConnection) *Player {
 	//生成一个PID
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"zinx_server/appDemo/Api_MMO_GAME/api"
 	"zinx_server/appDemo/Api_MMO_GAME/core"
+	"zinx_server/zinx/zcodec"
 	"zinx_server/zinx/zdecoder"
 	"zinx_server/zinx/ziface"
 	"zinx_server/zinx/znet"
@@ -26,7 +27,7 @@ func OnConnectionAdd(conn ziface.IConnection) {
 	core.WorldMgrObj.AddPlayer(player)
 
 	//将该连接绑定属性PID
-	conn.SetProperty("pID", player.PID)
+	core.PIDKey.Set(conn, player.PID)
 
 	//同步周边Player上线信息，与现实周边Player信息
 	player.SyncSurrounding()
@@ -35,12 +36,7 @@ func OnConnectionAdd(conn ziface.IConnection) {
 }
 
 func OnConnectionLost(conn ziface.IConnection) {
-	pID, _ := conn.GetProperty("pID")
-
-	var playerID int32
-	if pID != nil {
-		playerID = pID.(int32)
-	}
+	playerID, _ := core.PIDKey.Get(conn)
 
 	//根据pID获取对应的Player对象
 	player := core.WorldMgrObj.GetPlayerByPID(playerID)
@@ -58,8 +54,10 @@ func main() {
 	s.SetOnConnStart(OnConnectionAdd)
 	s.SetOnConnStop(OnConnectionLost)
 
-	s.AddRouter(2, &api.WorldChatApi{})
-	s.AddRouter(3, &api.MoveApi{})
+	//客户端的消息使用protobuf编码
+	s.SetCodec(zcodec.NewProtoCodec())
+	znet.HandleTyped(s, 2, api.WorldChat)
+	znet.HandleTyped(s, 3, api.Move)
 
 	s.SetDecoder(zdecoder.NewLTV_Little_Decoder())
 	s.SetPacket(zpack.NewDataPackLtv())
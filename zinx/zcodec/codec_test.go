@@ -0,0 +1,48 @@
+package zcodec
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestJSONCodec(t *testing.T) {
+	codec := NewJSONCodec()
+	data, err := codec.Marshal(map[string]int{"x": 1})
+	assert.Nil(t, err)
+
+	var v map[string]int
+	assert.Nil(t, codec.Unmarshal(data, &v))
+	assert.Equal(t, 1, v["x"])
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	type player struct {
+		ID   uint32
+		Name string
+	}
+
+	codec := NewMsgpackCodec()
+	data, err := codec.Marshal(&player{ID: 1, Name: "zinx"})
+	assert.Nil(t, err)
+
+	v := &player{}
+	assert.Nil(t, codec.Unmarshal(data, v))
+	assert.Equal(t, player{ID: 1, Name: "zinx"}, *v)
+}
+
+func TestProtoCodec(t *testing.T) {
+	codec := NewProtoCodec()
+	data, err := codec.Marshal(wrapperspb.String("zinx"))
+	assert.Nil(t, err)
+
+	v := &wrapperspb.StringValue{}
+	assert.Nil(t, codec.Unmarshal(data, v))
+	assert.Equal(t, "zinx", v.GetValue())
+
+	// 非proto.Message类型返回错误
+	_, err = codec.Marshal(struct{}{})
+	assert.NotNil(t, err)
+	assert.NotNil(t, codec.Unmarshal(data, &struct{}{}))
+}
@@ -0,0 +1,24 @@
+package zcodec
+
+import (
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// msgpack编解码器
+type MsgpackCodec struct{}
+
+func NewMsgpackCodec() *MsgpackCodec {
+	return &MsgpackCodec{}
+}
+
+func (c *MsgpackCodec) Name() string {
+	return "msgpack"
+}
+
+func (c *MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (c *MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
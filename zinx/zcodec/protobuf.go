@@ -0,0 +1,34 @@
+package zcodec
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// protobuf编解码器，编解码的对象需要实现proto.Message
+type ProtoCodec struct{}
+
+func NewProtoCodec() *ProtoCodec {
+	return &ProtoCodec{}
+}
+
+func (c *ProtoCodec) Name() string {
+	return "protobuf"
+}
+
+func (c *ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Marshal(msg)
+}
+
+func (c *ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("protobuf codec: %T is not a proto.Message", v)
+	}
+	return proto.Unmarshal(data, msg)
+}
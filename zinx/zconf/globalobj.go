@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"reflect"
+	"strconv"
 	"testing"
 	"time"
 	"zinx_server/zinx/zlog"
@@ -20,6 +21,22 @@ const (
 	ServerModeTcp       = "tcp"
 	ServerModeWebsocket = "websocket"
 	ServerModeKcp       = "kcp"
+	ServerModeUdp       = "udp"
+	ServerModeUnix      = "unix"
+)
+
+const (
+	NetModeGoroutine = "goroutine" // 每个链接使用独立的读goroutine(默认)
+	NetModeReactor   = "reactor"   // 由少量poller goroutine通过epoll复用所有链接的读事件，仅支持Linux下的tcp/unix链接
+)
+
+// SendBuffMsg缓冲发送队列已满时的处理策略
+const (
+	SendQueuePolicyTimeout    = "timeout"     // 等待SendQueueTimeout后放弃本条消息并返回错误(默认)
+	SendQueuePolicyBlock      = "block"       // 阻塞直到队列有空位、ctx结束或链接关闭
+	SendQueuePolicyDropOldest = "drop_oldest" // 丢弃队列中最早的消息，放入本条消息
+	SendQueuePolicyDropNewest = "drop_newest" // 直接丢弃本条消息并返回错误
+	SendQueuePolicyDisconnect = "disconnect"  // 断开消费过慢的链接
 )
 
 const (
@@ -27,6 +44,75 @@ const (
 	WorkerModeBind = "Bind" // Bind a worker to each connection.(为每个连接分配一个worker)
 )
 
+// 监听器配置，一个Server可以同时开启多个监听器，共用同一个ConnManager和MsgHandle
+type ListenerConfig struct {
+	Name           string //监听器名称，会记录在由该监听器接收的每个连接上，为空则默认为"<Mode>://<Addr>"
+	Mode           string //传输方式 "tcp"/"websocket"/"kcp"/"udp"/"unix"
+	Host           string //监听的IP
+	Port           int    //监听的端口号
+	UnixSocketPath string //unix模式下的socket文件路径
+	UnixSocketPerm string //unix模式下socket文件的权限(八进制字符串)，为空则使用全局UnixSocketPerm
+	WsPath         string //websocket模式下升级请求的路径，为空则使用全局WsPath
+	CertFile       string //证书文件名称 --如果没有设置证书和私钥文件，则不启用TLS加密
+	PrivateKeyFile string //私钥文件名称
+
+	ClientCAFile    string   //校验客户端证书的CA证书文件，设置后开启mTLS
+	ClientAuth      string   //客户端证书校验方式 "none"/"optional"/"require"，为空时设置了ClientCAFile则为"require"
+	TLSMinVersion   string   //TLS最低版本 "1.0"/"1.1"/"1.2"/"1.3"，为空则使用Go的默认值
+	TLSCipherSuites []string //允许的加密套件名称，为空则使用Go的默认值
+
+	ProxyProtocol        bool     //tcp模式下是否解析HAProxy PROXY protocol(v1/v2)头部，获取真实的客户端地址
+	ProxyProtocolTrusted []string //允许发送PROXY头的可信来源(IP或CIDR)，开启ProxyProtocol时必须设置
+}
+
+// 监听地址
+func (lc *ListenerConfig) Addr() string {
+	if lc.Mode == ServerModeUnix {
+		return lc.UnixSocketPath
+	}
+	return fmt.Sprintf("%s:%d", lc.Host, lc.Port)
+}
+
+// 监听器名称
+func (lc *ListenerConfig) GetName() string {
+	if lc.Name != "" {
+		return lc.Name
+	}
+	return lc.Mode + "://" + lc.Addr()
+}
+
+// websocket升级请求的路径
+func (lc *ListenerConfig) GetWsPath() string {
+	if lc.WsPath != "" {
+		return lc.WsPath
+	}
+	if GlobalObject != nil && GlobalObject.WsPath != "" {
+		return GlobalObject.WsPath
+	}
+	return "/"
+}
+
+// 解析unix domain socket文件权限
+func (lc *ListenerConfig) UnixSocketFileMode() (os.FileMode, error) {
+	permStr := lc.UnixSocketPerm
+	if permStr == "" && GlobalObject != nil {
+		permStr = GlobalObject.UnixSocketPerm
+	}
+	if permStr == "" {
+		permStr = "0660"
+	}
+	perm, err := strconv.ParseUint(permStr, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+	return os.FileMode(perm), nil
+}
+
+// 是否启用TLS加密
+func (lc *ListenerConfig) UseTLS() bool {
+	return lc.CertFile != "" && lc.PrivateKeyFile != ""
+}
+
 type Config struct {
 
 	/*
@@ -36,23 +122,51 @@ type Config struct {
 	TCPPort int    //当前服务器主机TCP监听的端口号
 	WsPort  int    //当前服务器主机websocket监听端口
 	KcpPort int    //当前服务器主机KCP监听端口号
+	UdpPort int    //当前服务器主机UDP监听端口号
 	Name    string //当前服务器的名称
 
+	WsPath string //websocket升级请求的路径 默认"/"
+
+	UnixSocketPath string //unix domain socket的文件路径
+	UnixSocketPerm string //unix domain socket文件的权限(八进制字符串) 默认"0660"
+
 	/*
 		Zinx
 	*/
-	Version          string //当前Zinx的版本号
-	MaxConn          int    //当前服务器主机允许的最大链接数
-	MaxPacketSize    uint32 //读写数据包的最大值
-	WorkerPoolSize   uint32 //业务工作Worker池的数量
-	MaxWorkerTaskLen uint32 //业务工作Worker对应负责的任务队列最大任务存储数量
-	MaxMsgChanLen    uint32 //SendBuffMsg发送消息的缓冲最大长度
-	WorkerMode       string //为链接分配worker的方式
-	IOReadBuffSize   uint32 //每次IO最大的读取长度
+	Version           string //当前Zinx的版本号
+	MaxConn           int    //当前服务器主机允许的最大链接数
+	MaxPacketSize     uint32 //读写数据包的最大值
+	WorkerPoolSize    uint32 //业务工作Worker池的数量
+	MaxWorkerTaskLen  uint32 //业务工作Worker对应负责的任务队列最大任务存储数量
+	MaxMsgChanLen     uint32 //SendBuffMsg发送消息的缓冲最大长度
+	MaxMsgChanLenHigh uint32 //高优先级发送通道的缓冲最大长度 默认0 --与MaxMsgChanLen相同
+	MaxMsgChanLenLow  uint32 //低优先级发送通道的缓冲最大长度 默认0 --与MaxMsgChanLen相同
+	WorkerMode        string //为链接分配worker的方式
+	IOReadBuffSize    uint32 //每次IO最大的读取长度
+
+	SendQueuePolicy        string //SendBuffMsg缓冲队列已满时的处理策略 "timeout"/"block"/"drop_oldest"/"drop_newest"/"disconnect" 默认"timeout"
+	SendQueueTimeout       int    //timeout策略下等待队列空位的时间(单位：毫秒) 默认5
+	SendQueueHighWatermark int    //缓冲队列高水位线，队列长度达到该值时通知应用层 默认0 --不开启
+	SendQueueLowWatermark  int    //缓冲队列低水位线，达到高水位后回落到该值时通知应用层
+	SessionMaxUnacked      int    //开启会话层时每个会话最多保留的未确认消息数量，超过后丢弃最早的消息 默认1024
+	CallTimeout            int    //客户端Call等待回复的默认超时时间(单位：毫秒)，ctx带有截止时间时以ctx为准 默认5000
+	WriteFlushWindow       int    //写goroutine合并写的等待窗口(单位：微秒)，取到第一条消息后最多等待该时间再一起写出 默认0 --只合并已在队列中的消息
+
+	NetMode          string //网络模型 "goroutine"/"reactor" 默认"goroutine"
+	ReactorPollerNum int    //reactor模式下poller的数量 默认0 --使用CPU核数
 
-	Mode string //"tcp"：TCP监听;"websocket"：websocket监听; 为空则同时开启
+	Mode string //"tcp"：TCP监听;"websocket"：websocket监听;"kcp"：KCP监听;"udp"：UDP监听;"unix"：unix socket监听; 为空则同时开启tcp和websocket
 
-	RouterSlicesMode bool //路由模式  false为旧版本，true为新版本 默认旧
+	// 监听器列表，不为空时忽略Mode以及Host/各端口配置，按照列表同时开启多个监听器
+	Listeners []ListenerConfig
+
+	RouterSlicesMode bool //内置路由(心跳、会话)的注册方式  false为IRouter，true为路由切片 默认false；业务路由可以按msgID任选一种
+
+	RequestPoolMode bool //是否复用Request及消息缓冲区，开启后Request在路由处理完成后即被回收，需要保留时使用Request.Copy 默认false
+
+	ShutdownTimeout int //Serve收到退出信号后优雅关闭的最长等待时间(单位：秒)，超时后强制关闭所有链接 默认30
+
+	HotRestartTimeout int //热重启时等待新进程重建监听器并就绪的最长时间(单位：秒)，超时则结束新进程并由当前进程继续提供服务 默认30
 
 	/*
 		logger
@@ -74,11 +188,47 @@ type Config struct {
 	*/
 	HeartbeatMax int //最长心跳检测间隔时间(单位：秒),超过改时间间隔，则认为超时，从配置文件读取
 
+	ReadTimeout  int //读超时(单位：毫秒)，超过该时间未读取到对端数据则关闭链接 默认0 --不开启
+	WriteTimeout int //写超时(单位：毫秒)，单次写出超过该时间未完成则关闭链接 默认0 --不开启
+	IdleTimeout  int //空闲超时(单位：毫秒)，超过该时间链接上没有任何读写则关闭链接 默认0 --不开启
+
 	/*
 		TLS
 	*/
 	CertFile       string //证书文件名称 默认""
 	PrivateKeyFile string //私钥文件名称 默认"" --如果没有设置证书和私钥文件，则不启用TLS加密
+
+	ClientCAFile    string   //校验客户端证书的CA证书文件 默认"" --设置后开启mTLS
+	ClientAuth      string   //客户端证书校验方式 "none"/"optional"/"require" 默认"" --设置了ClientCAFile时为"require"
+	TLSMinVersion   string   //TLS最低版本 "1.0"/"1.1"/"1.2"/"1.3" 默认"" --使用Go的默认值
+	TLSCipherSuites []string //允许的加密套件名称 默认空 --使用Go的默认值
+
+	TLSCertReloadInterval int //检查证书文件是否更新的间隔(单位：秒)，更新后自动重新加载 0:不检查 默认60
+
+	/*
+		PROXY protocol
+	*/
+	ProxyProtocol        bool     //TCP监听器是否解析HAProxy PROXY protocol(v1/v2)头部 默认false
+	ProxyProtocolTrusted []string //允许发送PROXY头的可信来源(IP或CIDR，如负载均衡的地址)，开启ProxyProtocol时必须设置，为空则监听器启动失败
+
+	/*
+		KCP
+	*/
+	KcpACKNoDelay      bool  // 收到数据包后是否立即回复ACK 默认false
+	KcpStreamMode      *bool // 是否开启流模式，开启后会合并小包 默认true
+	KcpNoDelay         *int  // 是否启用nodelay模式 0:不启用 1:启用 默认1
+	KcpInterval        int   // 内部update时钟间隔(单位：毫秒) 默认10
+	KcpResend          *int  // 快速重传触发的跳过ACK次数 0:关闭快速重传 默认2
+	KcpNc              *int  // 是否关闭拥塞控制 0:不关闭 1:关闭 默认1
+	KcpSendWindow      int   // 发送窗口大小(单位：包) 默认32
+	KcpRecvWindow      int   // 接收窗口大小(单位：包) 默认32
+	KcpFecDataShards   int   // FEC前向纠错数据分片数 0:不启用FEC 默认0
+	KcpFecParityShards int   // FEC前向纠错校验分片数 默认0
+
+	/*
+		UDP
+	*/
+	UdpIdleTimeout int // UDP虚拟连接的空闲超时时间(单位：秒)，超过该时间未收到对端数据报则关闭该虚拟连接 默认60
 }
 
 /*
@@ -125,6 +275,76 @@ func (g *Config) HeartbeatMaxDuration() time.Duration {
 	return time.Duration(g.HeartbeatMax) * time.Second
 }
 
+func (g *Config) ReadTimeoutDuration() time.Duration {
+	return time.Duration(g.ReadTimeout) * time.Millisecond
+}
+
+func (g *Config) WriteTimeoutDuration() time.Duration {
+	return time.Duration(g.WriteTimeout) * time.Millisecond
+}
+
+func (g *Config) IdleTimeoutDuration() time.Duration {
+	return time.Duration(g.IdleTimeout) * time.Millisecond
+}
+
+func (g *Config) ShutdownTimeoutDuration() time.Duration {
+	return time.Duration(g.ShutdownTimeout) * time.Second
+}
+
+func (g *Config) HotRestartTimeoutDuration() time.Duration {
+	return time.Duration(g.HotRestartTimeout) * time.Second
+}
+
+func (g *Config) TLSCertReloadIntervalDuration() time.Duration {
+	return time.Duration(g.TLSCertReloadInterval) * time.Second
+}
+
+func (g *Config) SendQueueTimeoutDuration() time.Duration {
+	return time.Duration(g.SendQueueTimeout) * time.Millisecond
+}
+
+func (g *Config) CallTimeoutDuration() time.Duration {
+	return time.Duration(g.CallTimeout) * time.Millisecond
+}
+
+func (g *Config) WriteFlushWindowDuration() time.Duration {
+	return time.Duration(g.WriteFlushWindow) * time.Microsecond
+}
+
+func (g *Config) UdpIdleTimeoutDuration() time.Duration {
+	return time.Duration(g.UdpIdleTimeout) * time.Second
+}
+
+// KCP配置中默认值不为零值的项使用指针，区分未配置和配置为false/0
+
+func (g *Config) KcpStreamModeValue() bool {
+	if g.KcpStreamMode == nil {
+		return true
+	}
+	return *g.KcpStreamMode
+}
+
+func (g *Config) KcpNoDelayValue() int {
+	if g.KcpNoDelay == nil {
+		return 1
+	}
+	return *g.KcpNoDelay
+}
+
+func (g *Config) KcpResendValue() int {
+	if g.KcpResend == nil {
+		return 2
+	}
+	return *g.KcpResend
+}
+
+func (g *Config) KcpNcValue() int {
+	if g.KcpNc == nil {
+		return 1
+	}
+	return *g.KcpNc
+}
+
 // 显示Config信息
 func (g *Config) Show() {
 	objVal := reflect.ValueOf(g).Elem()
@@ -178,7 +398,11 @@ func init() {
 		Version:           "V1.0",
 		TCPPort:           8999,
 		WsPort:            9000,
+		WsPath:            "/",
 		KcpPort:           9001,
+		UdpPort:           9002,
+		UnixSocketPath:    pwd + "/zinx.sock",
+		UnixSocketPerm:    "0660",
 		Host:              "0.0.0.0",
 		MaxConn:           12000,
 		MaxPacketSize:     4096,
@@ -186,15 +410,38 @@ func init() {
 		MaxWorkerTaskLen:  1024,
 		WorkerMode:        "",
 		MaxMsgChanLen:     1024,
+		SendQueuePolicy:   SendQueuePolicyTimeout,
+		SendQueueTimeout:  5,
+		SessionMaxUnacked: 1024,
+		CallTimeout:       5000,
 		LogDir:            pwd + "/log",
 		LogFile:           "", // if set "", print to Stderr(默认日志文件为空，打印到stderr)
 		LogIsolationLevel: 0,
 		HeartbeatMax:      10, // The default maximum interval for heartbeat detection is 10 seconds. (默认心跳检测最长间隔为10秒)
 		IOReadBuffSize:    1024,
+		NetMode:           NetModeGoroutine,
 		CertFile:          "",
 		PrivateKeyFile:    "",
 		Mode:              ServerModeTcp,
 		RouterSlicesMode:  false,
+		RequestPoolMode:   false,
+		ShutdownTimeout:   30,
+		HotRestartTimeout: 30,
+
+		TLSCertReloadInterval: 60,
+
+		KcpACKNoDelay:      false,
+		KcpStreamMode:      nil, // 默认值为true，见KcpStreamModeValue
+		KcpNoDelay:         nil, // 默认值为1，见KcpNoDelayValue
+		KcpInterval:        10,
+		KcpResend:          nil, // 默认值为2，见KcpResendValue
+		KcpNc:              nil, // 默认值为1，见KcpNcValue
+		KcpSendWindow:      32,
+		KcpRecvWindow:      32,
+		KcpFecDataShards:   0,
+		KcpFecParityShards: 0,
+
+		UdpIdleTimeout: 60,
 	}
 
 	//应该尝试从conf/zinx.json去加载一些用户自定义的参数
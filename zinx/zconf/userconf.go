@@ -37,9 +37,44 @@ func UserConfToGlobal(config *Config) {
 	if config.MaxMsgChanLen != 0 {
 		GlobalObject.MaxMsgChanLen = config.MaxMsgChanLen
 	}
+	if config.MaxMsgChanLenHigh != 0 {
+		GlobalObject.MaxMsgChanLenHigh = config.MaxMsgChanLenHigh
+	}
+	if config.MaxMsgChanLenLow != 0 {
+		GlobalObject.MaxMsgChanLenLow = config.MaxMsgChanLenLow
+	}
+
+	if config.SendQueuePolicy != "" {
+		GlobalObject.SendQueuePolicy = config.SendQueuePolicy
+	}
+
+	if config.SendQueueTimeout != 0 {
+		GlobalObject.SendQueueTimeout = config.SendQueueTimeout
+	}
+
+	if config.WriteFlushWindow != 0 {
+		GlobalObject.WriteFlushWindow = config.WriteFlushWindow
+	}
+
+	if config.SendQueueHighWatermark != 0 {
+		GlobalObject.SendQueueHighWatermark = config.SendQueueHighWatermark
+		GlobalObject.SendQueueLowWatermark = config.SendQueueLowWatermark
+	}
+	if config.SessionMaxUnacked != 0 {
+		GlobalObject.SessionMaxUnacked = config.SessionMaxUnacked
+	}
+	if config.CallTimeout != 0 {
+		GlobalObject.CallTimeout = config.CallTimeout
+	}
 	if config.IOReadBuffSize != 0 {
 		GlobalObject.IOReadBuffSize = config.IOReadBuffSize
 	}
+	if config.NetMode != "" {
+		GlobalObject.NetMode = config.NetMode
+	}
+	if config.ReactorPollerNum != 0 {
+		GlobalObject.ReactorPollerNum = config.ReactorPollerNum
+	}
 
 	// logger
 	// By default, it is False. If the config is not initialized, the default configuration will be used.
@@ -64,6 +99,15 @@ func UserConfToGlobal(config *Config) {
 	if config.HeartbeatMax != 0 {
 		GlobalObject.HeartbeatMax = config.HeartbeatMax
 	}
+	if config.ReadTimeout != 0 {
+		GlobalObject.ReadTimeout = config.ReadTimeout
+	}
+	if config.WriteTimeout != 0 {
+		GlobalObject.WriteTimeout = config.WriteTimeout
+	}
+	if config.IdleTimeout != 0 {
+		GlobalObject.IdleTimeout = config.IdleTimeout
+	}
 
 	// TLS
 	if config.CertFile != "" {
@@ -72,6 +116,21 @@ func UserConfToGlobal(config *Config) {
 	if config.PrivateKeyFile != "" {
 		GlobalObject.PrivateKeyFile = config.PrivateKeyFile
 	}
+	if config.ClientCAFile != "" {
+		GlobalObject.ClientCAFile = config.ClientCAFile
+	}
+	if config.ClientAuth != "" {
+		GlobalObject.ClientAuth = config.ClientAuth
+	}
+	if config.TLSMinVersion != "" {
+		GlobalObject.TLSMinVersion = config.TLSMinVersion
+	}
+	if len(config.TLSCipherSuites) > 0 {
+		GlobalObject.TLSCipherSuites = config.TLSCipherSuites
+	}
+	if config.TLSCertReloadInterval != 0 {
+		GlobalObject.TLSCertReloadInterval = config.TLSCertReloadInterval
+	}
 
 	if config.Mode != "" {
 		GlobalObject.Mode = config.Mode
@@ -79,8 +138,83 @@ func UserConfToGlobal(config *Config) {
 	if config.WsPort != 0 {
 		GlobalObject.WsPort = config.WsPort
 	}
+	if config.WsPath != "" {
+		GlobalObject.WsPath = config.WsPath
+	}
+	if config.ProxyProtocol {
+		GlobalObject.ProxyProtocol = config.ProxyProtocol
+	}
+	if len(config.ProxyProtocolTrusted) > 0 {
+		GlobalObject.ProxyProtocolTrusted = config.ProxyProtocolTrusted
+	}
+	if len(config.Listeners) > 0 {
+		GlobalObject.Listeners = config.Listeners
+	}
+	if config.KcpPort != 0 {
+		GlobalObject.KcpPort = config.KcpPort
+	}
+
+	if config.UdpPort != 0 {
+		GlobalObject.UdpPort = config.UdpPort
+	}
+	if config.UnixSocketPath != "" {
+		GlobalObject.UnixSocketPath = config.UnixSocketPath
+	}
+	if config.UnixSocketPerm != "" {
+		GlobalObject.UnixSocketPerm = config.UnixSocketPerm
+	}
+
+	// KCP
+	if config.KcpACKNoDelay {
+		GlobalObject.KcpACKNoDelay = config.KcpACKNoDelay
+	}
+	// 指针类型的配置项为nil表示未配置，可以显式配置为false/0
+	if config.KcpStreamMode != nil {
+		GlobalObject.KcpStreamMode = config.KcpStreamMode
+	}
+	if config.KcpNoDelay != nil {
+		GlobalObject.KcpNoDelay = config.KcpNoDelay
+	}
+	if config.KcpInterval != 0 {
+		GlobalObject.KcpInterval = config.KcpInterval
+	}
+	if config.KcpResend != nil {
+		GlobalObject.KcpResend = config.KcpResend
+	}
+	if config.KcpNc != nil {
+		GlobalObject.KcpNc = config.KcpNc
+	}
+	if config.KcpSendWindow != 0 {
+		GlobalObject.KcpSendWindow = config.KcpSendWindow
+	}
+	if config.KcpRecvWindow != 0 {
+		GlobalObject.KcpRecvWindow = config.KcpRecvWindow
+	}
+	if config.KcpFecDataShards != 0 {
+		GlobalObject.KcpFecDataShards = config.KcpFecDataShards
+	}
+	if config.KcpFecParityShards != 0 {
+		GlobalObject.KcpFecParityShards = config.KcpFecParityShards
+	}
+
+	// UDP
+	if config.UdpIdleTimeout != 0 {
+		GlobalObject.UdpIdleTimeout = config.UdpIdleTimeout
+	}
 
 	if config.RouterSlicesMode {
 		GlobalObject.RouterSlicesMode = config.RouterSlicesMode
 	}
+
+	if config.RequestPoolMode {
+		GlobalObject.RequestPoolMode = config.RequestPoolMode
+	}
+
+	if config.ShutdownTimeout != 0 {
+		GlobalObject.ShutdownTimeout = config.ShutdownTimeout
+	}
+
+	if config.HotRestartTimeout != 0 {
+		GlobalObject.HotRestartTimeout = config.HotRestartTimeout
+	}
 }
@@ -49,7 +49,6 @@
 package zdecoder
 
 import (
-	"bytes"
 	"encoding/binary"
 	"math"
 	"zinx_server/zinx/ziface"
@@ -94,20 +93,17 @@ func (ltv *LTV_Little_Decoder) GetLengthField() *ziface.LengthField {
 	}
 }
 
-func (ltv *LTV_Little_Decoder) decode(data []byte) *LTV_Little_Decoder {
+func (ltv *LTV_Little_Decoder) decode(data []byte) LTV_Little_Decoder {
 	ltvData := LTV_Little_Decoder{}
 
 	//Get L
 	ltvData.Length = binary.LittleEndian.Uint32(data[0:4])
 	//Get T
 	ltvData.Tag = binary.LittleEndian.Uint32(data[4:8])
-	//Determine the length of V. (确定V的长度)
-	ltvData.Value = make([]byte, ltvData.Length)
+	//Get V, referencing the message data without copying (直接引用消息中的数据，不再拷贝)
+	ltvData.Value = data[8 : 8+ltvData.Length]
 
-	//5. Get V
-	binary.Read(bytes.NewBuffer(data[8:8+ltvData.Length]), binary.LittleEndian, ltvData.Value)
-
-	return &ltvData
+	return ltvData
 }
 
 func (ltv *LTV_Little_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
@@ -139,5 +135,5 @@ func (ltv *LTV_Little_Decoder) Intercept(chain ziface.IChain) ziface.IcResp {
 
 	//6. Pass the decoded data to the next layer.
 	// (将解码后的数据进入下一层)
-	return chain.ProceedWithIMessage(iMessage, *ltvData)
+	return chain.ProceedWithIMessage(iMessage, ltvData)
 }
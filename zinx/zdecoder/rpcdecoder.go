@@ -0,0 +1,78 @@
+package zdecoder
+
+import (
+	"encoding/binary"
+	"math"
+	"zinx_server/zinx/ziface"
+)
+
+// 携带请求ID的TLV，配合zpack.RPCDataPack使用
+//
+//	+---------------+---------------+---------------+---------------+
+//	|      Tag      |    Length     |   RequestID   |     Value     |
+//	| uint32(4byte) | uint32(4byte) | uint32(4byte) |    n byte     |
+//	+---------------+---------------+---------------+---------------+
+//
+//	说明：
+//	lengthFieldOffset   = 4            (Length的字节位索引下标是4)
+//	lengthFieldLength   = 4            (Length是4个byte)
+//	lengthAdjustment    = 4            (Length只表示Value长度，Length与Value之间还有4字节的RequestID)
+//	initialBytesToStrip = 0            (返回完整的协议内容)
+//	maxFrameLength      = 2^32 + 4 + 4 + 4
+
+const RPC_HEADER_SIZE = 12 //表示携带请求ID的空包长度
+
+type RPCDecoder struct {
+	Tag       uint32
+	Length    uint32
+	RequestID uint32
+	Value     []byte
+}
+
+func NewRPCDecoder() ziface.IDecoder {
+	return &RPCDecoder{}
+}
+
+func (rpc *RPCDecoder) GetLengthField() *ziface.LengthField {
+	return &ziface.LengthField{
+		MaxFrameLength:      math.MaxUint32 + 4 + 4 + 4,
+		LengthFieldLength:   4,
+		LengthFieldOffset:   4,
+		LengthAdjustment:    4,
+		InitialBytesToStrip: 0,
+	}
+}
+
+func (rpc *RPCDecoder) decode(data []byte) RPCDecoder {
+	rpcData := RPCDecoder{}
+	rpcData.Tag = binary.BigEndian.Uint32(data[0:4])
+	rpcData.Length = binary.BigEndian.Uint32(data[4:8])
+	rpcData.RequestID = binary.BigEndian.Uint32(data[8:12])
+	//直接引用消息中的数据，不再拷贝
+	rpcData.Value = data[RPC_HEADER_SIZE : RPC_HEADER_SIZE+rpcData.Length]
+
+	return rpcData
+}
+
+func (rpc *RPCDecoder) Intercept(chain ziface.IChain) ziface.IcResp {
+	iMessage := chain.GetIMessage()
+	if iMessage == nil {
+		return chain.ProceedWithIMessage(iMessage, nil)
+	}
+
+	data := iMessage.GetData()
+	if len(data) < RPC_HEADER_SIZE {
+		return chain.ProceedWithIMessage(iMessage, nil)
+	}
+
+	rpcData := rpc.decode(data)
+
+	iMessage.SetMsgID(rpcData.Tag)
+	iMessage.SetDataLen(rpcData.Length)
+	iMessage.SetData(rpcData.Value)
+	if m, ok := iMessage.(ziface.IRequestIDMessage); ok {
+		m.SetRequestID(rpcData.RequestID)
+	}
+
+	return chain.ProceedWithIMessage(iMessage, rpcData)
+}
@@ -1,12 +1,9 @@
 package zdecoder
 
 import (
-	"bytes"
 	"encoding/binary"
 	"math"
-	"unsafe"
 	"zinx_server/zinx/ziface"
-	"zinx_server/zinx/zlog"
 )
 
 // TLV，即Tag(Type)—Length—Value，是一种简单实用的数据传输方案。
@@ -68,19 +65,16 @@ func (tlv *TLVDecoder) GetLengthField() *ziface.LengthField {
 	}
 }
 
-func (tlv *TLVDecoder) decode(data []byte) *TLVDecoder {
+func (tlv *TLVDecoder) decode(data []byte) TLVDecoder {
 	tlvData := TLVDecoder{}
 	//Get T
 	tlvData.Tag = binary.BigEndian.Uint32(data[0:4])
 	//Get L
 	tlvData.Length = binary.BigEndian.Uint32(data[4:8])
-	//确定V的长度
-	tlvData.Value = make([]byte, tlvData.Length)
-	//Get V
-	binary.Read(bytes.NewBuffer(data[8:8+tlvData.Length]), binary.BigEndian, tlvData.Value)
+	//Get V，直接引用消息中的数据，不再拷贝
+	tlvData.Value = data[8 : 8+tlvData.Length]
 
-	zlog.Ins().DebugF("TLV-DecodeData size:%d data:%+v\n", unsafe.Sizeof(data), tlvData)
-	return &tlvData
+	return tlvData
 }
 
 func (tlv *TLVDecoder) Intercept(chain ziface.IChain) ziface.IcResp {
@@ -108,6 +102,6 @@ func (tlv *TLVDecoder) Intercept(chain ziface.IChain) ziface.IcResp {
 	iMessage.SetData(tlvData.Value)
 
 	//6. 将解码后的数据进入下一层
-	return chain.ProceedWithIMessage(iMessage, *tlvData)
+	return chain.ProceedWithIMessage(iMessage, tlvData)
 
 }
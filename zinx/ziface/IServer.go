@@ -1,23 +1,31 @@
 package ziface
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"time"
 )
 
 // 定义一个服务器接口
 type IServer interface {
-	//启动服务器
-	Start()
-	//停止服务器
+	//启动服务器，监听器的TLS证书等配置加载失败时返回错误
+	Start() error
+	//在调用方提供的监听器上启动服务器，不再按照配置开启监听器
+	StartWithListener(listeners ...net.Listener)
+	//停止服务器，立即关闭所有链接
 	Stop()
-	//运行服务器
-	Serve()
+	//优雅关闭服务器，停止接收新链接并等待已有链接处理完毕，超过ctx截止时间后强制关闭
+	Shutdown(ctx context.Context) error
+	//热重启，启动新进程接管所有监听套接字后优雅关闭当前进程的链接
+	HotRestart(ctx context.Context) error
+	//运行服务器，启动失败时返回错误
+	Serve() error
 
 	//路由功能：给当前的服务注册一个路由方法，供客户端的链接处理使用
 	AddRouter(msgID uint32, router IRouter)
 
-	// 新版路由方式
+	// 新版路由方式，同一个Server中可以与AddRouter混用，但同一个msgID只能绑定一种
 	AddRouterSlices(msgID uint32, router ...RouterHandler) IRouterSlices
 
 	// 路由组管理
@@ -26,6 +34,20 @@ type IServer interface {
 	// 公共组件管理
 	Use(Handlers ...RouterHandler) IRouterSlices
 
+	// 运行期间移除msgID绑定的路由，返回该路由是否存在
+	RemoveRouter(msgID uint32) bool
+	// 运行期间将msgID绑定到router，替换已经绑定的路由
+	ReplaceRouter(msgID uint32, router IRouter)
+	// 运行期间将msgID绑定到路由切片，替换已经绑定的路由
+	ReplaceRouterSlices(msgID uint32, handlers ...RouterHandler)
+	// 获取所有已注册的路由信息，按msgID排序
+	GetRoutes() []RouteInfo
+
+	// 设置收到没有绑定路由的msgID时的处理函数
+	SetNotFoundHandler(handler NotFoundHandler)
+	// 设置路由处理发生panic或者报告错误时的处理函数
+	SetErrorHandler(handler ErrorHandler)
+
 	//获取当前server的连接管理器
 	GetConnMgr() IConnManager
 
@@ -41,6 +63,30 @@ type IServer interface {
 	//得到该Server的连接断开时的Hook函数
 	GetOnConnStop() func(IConnection)
 
+	//开启会话层，链接断开后会话保留gracePeriod，期间客户端可以重连恢复会话
+	StartSession(gracePeriod time.Duration)
+
+	//获取会话管理器，未开启会话层时返回nil
+	GetSessionMgr() ISessionManager
+
+	//设置该Server的连接即将关闭时的Hook函数，此时链接仍可以发送最后的消息
+	SetOnConnBeforeClose(func(connection IConnection))
+
+	//得到该Server的连接即将关闭时的Hook函数
+	GetOnConnBeforeClose() func(IConnection)
+
+	//设置该Server的连接关闭并从ConnManager中移除后的Hook函数
+	SetOnConnRemoved(func(connection IConnection))
+
+	//得到该Server的连接从ConnManager中移除后的Hook函数
+	GetOnConnRemoved() func(IConnection)
+
+	//设置链接的缓冲发送队列越过高/低水位线时的Hook函数
+	SetOnSendQueueWatermark(func(conn IConnection, overHigh bool))
+
+	//得到链接的缓冲发送队列水位线Hook函数
+	GetOnSendQueueWatermark() func(IConnection, bool)
+
 	// 获取Server绑定的数据协议封包方式
 	GetPacket() IDataPack
 
@@ -50,6 +96,12 @@ type IServer interface {
 	// 设置Server绑定的数据协议封包方式
 	SetPacket(IDataPack)
 
+	// 获取带类型的路由(HandleTyped)默认使用的消息编解码器
+	GetCodec() ICodec
+
+	// 设置带类型的路由默认使用的消息编解码器，默认为json
+	SetCodec(ICodec)
+
 	//启动心跳检测
 	StartHeartBeat(time.Duration)
 	//启动心跳检测(自定义回调)
@@ -65,6 +117,12 @@ type IServer interface {
 	// 添加websocket认证方法
 	SetWebsocketAuth(func(r *http.Request) error)
 
+	// 设置websocket监听器上非websocket升级请求的处理器
+	SetHttpHandler(handler http.Handler)
+
+	// 获取websocket升级处理器，用于挂载到已有的http服务中
+	WebsocketHandler() http.Handler
+
 	// 获取服务器名称
 	ServerName() string
 }
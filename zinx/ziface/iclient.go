@@ -1,6 +1,9 @@
 package ziface
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 /*
 定义一个客户端接口
@@ -48,6 +51,16 @@ type IClient interface {
 	//启动心跳检测（自定义回调）
 	StartHeartBeatWithOption(duration time.Duration, option *HeartBeatOption)
 
+	//开启会话层，重连后自动恢复会话并补收断开期间的消息
+	StartSession()
+
+	//获取当前会话的令牌
+	GetSessionToken() string
+
+	//发送携带请求ID的消息并等待服务端通过IRequest.Reply回复，ctx没有截止时间时使用zconf.CallTimeout
+	//需要客户端和服务端都使用携带请求ID的封包方式(ZinxDataPackRPC)以及对应的解码器
+	Call(ctx context.Context, msgID uint32, data []byte) (IMessage, error)
+
 	//获取客户端的长度字段
 	GetLengthField() *LengthField
 
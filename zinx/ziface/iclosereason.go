@@ -0,0 +1,51 @@
+package ziface
+
+// 链接关闭的原因
+type CloseReason int
+
+const (
+	CloseReasonNone             CloseReason = iota //链接尚未关闭
+	CloseReasonStop                                //本端调用Stop()主动关闭
+	CloseReasonRemoteClosed                        //对端关闭了链接
+	CloseReasonReadError                           //读取数据失败
+	CloseReasonWriteError                          //写出数据失败
+	CloseReasonHeartbeatTimeout                    //心跳超时，对端不再存活
+	CloseReasonServerStop                          //服务器停止
+	CloseReasonKicked                              //被业务层踢下线
+	CloseReasonPacketTooLarge                      //收到的数据包超过MaxPacketSize
+	CloseReasonSlowConsumer                        //缓冲发送队列已满(disconnect策略)
+	CloseReasonPanic                               //处理链接数据时发生panic
+	CloseReasonHandshakeFailed                     //TLS握手失败
+	CloseReasonReadTimeout                         //超过ReadTimeout未读取到对端数据
+	CloseReasonWriteTimeout                        //写出数据超过WriteTimeout未完成
+	CloseReasonIdleTimeout                         //超过IdleTimeout链接上没有任何读写
+	CloseReasonSessionResumed                      //会话已在新的链接上恢复，旧链接被取代
+	CloseReasonDecodeError                         //收到的数据无法解码
+)
+
+var closeReasonNames = map[CloseReason]string{
+	CloseReasonNone:             "none",
+	CloseReasonStop:             "stop",
+	CloseReasonRemoteClosed:     "remote_closed",
+	CloseReasonReadError:        "read_error",
+	CloseReasonWriteError:       "write_error",
+	CloseReasonHeartbeatTimeout: "heartbeat_timeout",
+	CloseReasonServerStop:       "server_stop",
+	CloseReasonKicked:           "kicked",
+	CloseReasonPacketTooLarge:   "packet_too_large",
+	CloseReasonSlowConsumer:     "slow_consumer",
+	CloseReasonPanic:            "panic",
+	CloseReasonHandshakeFailed:  "handshake_failed",
+	CloseReasonReadTimeout:      "read_timeout",
+	CloseReasonWriteTimeout:     "write_timeout",
+	CloseReasonIdleTimeout:      "idle_timeout",
+	CloseReasonSessionResumed:   "session_resumed",
+	CloseReasonDecodeError:      "decode_error",
+}
+
+func (r CloseReason) String() string {
+	if name, ok := closeReasonNames[r]; ok {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,13 @@
+package ziface
+
+// 消息内容的编解码器，用于带类型的路由自动解码请求、编码响应
+type ICodec interface {
+	//编解码器名称，如json、protobuf、msgpack
+	Name() string
+
+	//将v编码为消息内容
+	Marshal(v interface{}) ([]byte, error)
+
+	//将消息内容解码到v中，v为指针
+	Unmarshal(data []byte, v interface{}) error
+}
@@ -2,8 +2,10 @@ package ziface
 
 import (
 	"context"
+	"crypto/x509"
 	"github.com/gorilla/websocket"
 	"net"
+	"time"
 )
 
 // 定义链接模块的抽象层
@@ -14,6 +16,12 @@ type IConnection interface {
 	//停止链接 结束当前链接的工作
 	Stop()
 
+	//以指定的原因停止链接，只有第一次停止时的原因会被记录
+	StopWithReason(reason CloseReason, err error)
+
+	//获取链接关闭的原因以及导致关闭的错误，链接未关闭时返回CloseReasonNone
+	GetCloseReason() (CloseReason, error)
+
 	//获取当前链接的绑定socket conn
 	GetConnection() net.Conn
 
@@ -52,9 +60,39 @@ type IConnection interface {
 	//直接将Message数据发送数据给远程的TCP客户端(无缓冲)
 	SendMsg(msgId uint32, data []byte) error
 
+	//直接发送携带请求ID的消息，链接的封包方式需要支持IDataPackRequestID
+	SendMsgWithRequestID(msgId uint32, requestID uint32, data []byte) error
+
 	//直接将Message数据发送给远程的TCP客户端(有缓冲)
 	SendBuffMsg(msgId uint32, data []byte) error //添加带缓冲发送消息接口
 
+	//有缓冲发送，队列已满时block/timeout策略最多等待到ctx结束
+	SendBuffMsgContext(ctx context.Context, msgId uint32, data []byte) error
+
+	//按优先级有缓冲发送，写goroutine总是先写出高优先级通道中的消息
+	SendBuffMsgWithPriority(msgId uint32, data []byte, priority SendPriority) error
+
+	//等待调用之前通过SendBuffMsg/SendToQueue放入缓冲队列的消息全部写出
+	Flush() error
+
+	//设置缓冲发送队列已满时的处理策略，见zconf.SendQueuePolicy*
+	SetSendQueuePolicy(policy string) error
+
+	//设置缓冲发送队列的高/低水位线，队列长度达到high时回调overHigh为true，之后回落到low时回调overHigh为false，high为0则不开启
+	SetSendQueueWatermark(high, low int, callback func(conn IConnection, overHigh bool))
+
+	//获取缓冲发送队列中尚未写出的消息数量
+	GetSendQueueLen() int
+
+	//获取缓冲发送队列的容量(所有优先级通道之和)
+	GetSendQueueCap() int
+
+	//获取缓冲发送队列各优先级通道的统计，按优先级从高到低排列
+	GetSendQueueStats() []SendLaneStats
+
+	//获取链接的流量统计
+	GetStats() ConnStats
+
 	//设置链接属性
 	SetProperty(key string, value interface{})
 
@@ -64,12 +102,67 @@ type IConnection interface {
 	//移除链接属性
 	RemoveProperty(key string)
 
+	//设置带有效期的链接属性，超过ttl之后自动移除，ttl<=0表示永不过期
+	SetPropertyWithTTL(key string, value interface{}, ttl time.Duration)
+
+	//添加链接属性变化的Hook函数，属性被设置、移除或者过期时调用
+	AddPropertyChangeHook(hook PropertyChangeHook)
+
 	//判断当前链接是否存活
 	IsAlive() bool
 
 	//设置心跳检测器
 	SetHeartBeat(checker IHeartbeatChecker)
 
+	//设置读超时，超过该时间未读取到对端数据则关闭链接，为0则不开启
+	SetReadTimeout(timeout time.Duration)
+
+	//设置写超时，单次写出超过该时间未完成则关闭链接，为0则不开启
+	SetWriteTimeout(timeout time.Duration)
+
+	//设置空闲超时，超过该时间链接上没有任何读写则关闭链接，为0则不开启
+	SetIdleTimeout(timeout time.Duration)
+
+	//获取接收该链接的监听器名称(客户端链接为空)
+	GetListenerName() string
+
+	//获取TLS链接中已通过校验的对端证书，非TLS链接或对端未提供证书时返回nil
+	GetPeerCertificate() *x509.Certificate
+
 	//返回ctx，用于用户自定义的go程获取连接退出状态
 	Context() context.Context
 }
+
+// 缓冲发送队列的优先级，数值越小优先级越高
+type SendPriority int
+
+const (
+	SendPriorityHigh   SendPriority = iota //高优先级，如踢下线、支付结果等关键消息
+	SendPriorityNormal                     //普通优先级，SendBuffMsg/SendToQueue默认使用
+	SendPriorityLow                        //低优先级，如位置同步等可延迟的消息
+
+	SendPriorityNum = 3 //优先级通道的数量
+)
+
+// 缓冲发送队列单个优先级通道的统计
+type SendLaneStats struct {
+	Priority SendPriority
+	Len      int    //通道中等待写出的消息数量
+	Cap      int    //通道容量
+	Enqueued uint64 //累计放入通道的消息数量
+	Sent     uint64 //累计写出的消息数量
+	Dropped  uint64 //累计因队列已满被拒绝或丢弃的消息数量
+}
+
+// 链接的流量统计
+type ConnStats struct {
+	BytesIn      uint64    //累计读取的字节数
+	BytesOut     uint64    //累计写出的字节数
+	MsgIn        uint64    //累计收到的消息数量
+	MsgOut       uint64    //累计写出的消息数量
+	DecodeErrors uint64    //收到的数据解码失败或者超过MaxPacketSize的次数
+	SendDropped  uint64    //缓冲发送队列已满被拒绝或丢弃的消息数量
+	QueueLen     int       //缓冲发送队列中尚未写出的消息数量
+	ConnectedAt  time.Time //链接建立的时间
+	LastActivity time.Time //最后一次读写数据的时间
+}
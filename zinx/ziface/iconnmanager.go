@@ -1,5 +1,17 @@
 package ziface
 
+// 所有链接的流量统计汇总
+type ConnMgrStats struct {
+	ConnNum      int    //当前链接数量
+	BytesIn      uint64 //累计读取的字节数，包括已经断开的链接
+	BytesOut     uint64 //累计写出的字节数，包括已经断开的链接
+	MsgIn        uint64 //累计收到的消息数量，包括已经断开的链接
+	MsgOut       uint64 //累计写出的消息数量，包括已经断开的链接
+	DecodeErrors uint64 //累计解码失败的次数，包括已经断开的链接
+	SendDropped  uint64 //累计被丢弃的缓冲发送消息数量，包括已经断开的链接
+	QueueLen     int    //当前所有链接缓冲发送队列中尚未写出的消息数量
+}
+
 /*
 连接管理模块抽象层
 */
@@ -32,4 +44,7 @@ type IConnManager interface {
 	Range(func(uint64, IConnection, interface{}) error, interface{}) error
 	//遍历所有连接2
 	Range2(func(string, IConnection, interface{}) error, interface{}) error
+
+	//获取所有链接的流量统计汇总
+	GetStats() ConnMgrStats
 }
@@ -16,10 +16,22 @@ type IDataPack interface {
 	Unpack([]byte) (IMessage, error)
 }
 
+// 支持将消息直接封包到调用方提供的缓冲区中的封包方式，配合缓冲池使用可以避免封包时的内存分配
+type IDataPackAppender interface {
+	AppendPack(dst []byte, msgID uint32, data []byte) []byte
+}
+
+// 包头中携带请求ID的封包方式，用于请求-响应式的调用(IRequest.Reply/IClient.Call)
+type IDataPackRequestID interface {
+	AppendPackWithRequestID(dst []byte, msgID uint32, requestID uint32, data []byte) []byte
+}
+
 const (
 	// Zinx standard packing and unpacking method (Zinx 标准封包和拆包方式)
 	ZinxDataPack    string = "zinx_pack_tlv_big_endian"
 	ZinxDataPackOld string = "zinx_pack_ltv_little_endian"
+	// 在标准封包的包头之后追加4字节请求ID，需要配合zdecoder.NewRPCDecoder使用
+	ZinxDataPackRPC string = "zinx_pack_rpc_big_endian"
 
 	//...(+)
 	//// Custom packing method can be added here(自定义封包方式在此添加)
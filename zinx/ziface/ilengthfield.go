@@ -4,6 +4,9 @@ import "encoding/binary"
 
 type IFrameDecoder interface {
 	Decode(buff []byte) [][]byte
+	// 将解码出的完整帧追加到frames中返回，帧直接引用解码器内部的缓冲区，
+	// 只在下一次调用Decode/DecodeTo之前有效，需要保留时由调用方拷贝
+	DecodeTo(frames [][]byte, buff []byte) [][]byte
 }
 
 // ILengthField Basic attributes possessed by ILengthField
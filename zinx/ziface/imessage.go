@@ -23,3 +23,9 @@ type IMessage interface {
 	//设置消息的内容
 	SetData([]byte)
 }
+
+// 携带请求ID的消息，请求ID为0表示不是请求-响应式调用的消息
+type IRequestIDMessage interface {
+	GetRequestID() uint32
+	SetRequestID(uint32)
+}
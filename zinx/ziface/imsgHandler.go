@@ -14,11 +14,27 @@ type IMsgHandle interface {
 	Group(start, end uint32, Handlers ...RouterHandler) IGroupRouterSlices
 	Use(Handlers ...RouterHandler) IRouterSlices
 
+	//移除msgID绑定的路由，不论以哪种方式注册，返回该路由是否存在，可以在运行期间调用
+	RemoveRouter(msgID uint32) bool
+	//将msgID绑定到router，替换已经绑定的路由，可以在运行期间调用
+	ReplaceRouter(msgID uint32, router IRouter)
+	//将msgID绑定到路由切片，替换已经绑定的路由，Use添加的公共组件同样生效，可以在运行期间调用
+	ReplaceRouterSlices(msgID uint32, handlers ...RouterHandler)
+	//获取所有已注册的路由信息，按msgID排序
+	GetRoutes() []RouteInfo
+
+	//设置收到没有绑定路由的msgID时的处理函数，为nil时只记录日志
+	SetNotFoundHandler(handler NotFoundHandler)
+	//设置路由处理出错(panic或者SetError)时的处理函数，为nil时只记录日志
+	SetErrorHandler(handler ErrorHandler)
+
 	//启动Worker工作池
 	StartWorkerPool()
 
 	//将消息发送给消息任务队列处理
 	SendMsgToTaskQueue(request IRequest)
+	//获取已投递但尚未处理完成的任务数量
+	GetInFlightTaskCount() int64
 
 	//执行责任链上的拦截器方法
 	Execute(request IRequest)
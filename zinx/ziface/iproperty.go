@@ -0,0 +1,81 @@
+package ziface
+
+import "time"
+
+// 链接属性变化的Hook函数，属性被设置、移除或者过期时调用
+// 属性不存在时对应的oldValue/newValue为nil
+type PropertyChangeHook func(conn IConnection, key string, oldValue, newValue interface{})
+
+// 带类型的链接属性键，避免使用属性时的类型断言
+//
+//	var PIDKey = ziface.NewKey[int32]("pID")
+//	PIDKey.Set(conn, 1)
+//	pID, ok := PIDKey.Get(conn)
+type Key[T any] struct {
+	name string
+	ttl  time.Duration
+}
+
+// 创建属性键
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+// 创建带有效期的属性键，通过该键设置的属性超过ttl之后自动移除
+func NewKeyWithTTL[T any](name string, ttl time.Duration) Key[T] {
+	return Key[T]{name: name, ttl: ttl}
+}
+
+// 获取属性名称，与SetProperty/GetProperty使用的key相同
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// 获取属性有效期，为0表示永不过期
+func (k Key[T]) TTL() time.Duration {
+	return k.ttl
+}
+
+// 设置链接属性
+func (k Key[T]) Set(conn IConnection, value T) {
+	conn.SetPropertyWithTTL(k.name, value, k.ttl)
+}
+
+// 获取链接属性，属性不存在或者类型不匹配时返回false
+func (k Key[T]) Get(conn IConnection) (T, bool) {
+	var zero T
+	value, err := conn.GetProperty(k.name)
+	if err != nil {
+		return zero, false
+	}
+	v, ok := value.(T)
+	if !ok {
+		return zero, false
+	}
+	return v, true
+}
+
+// 获取链接属性，属性不存在时返回defaultValue
+func (k Key[T]) GetOr(conn IConnection, defaultValue T) T {
+	if v, ok := k.Get(conn); ok {
+		return v
+	}
+	return defaultValue
+}
+
+// 移除链接属性
+func (k Key[T]) Remove(conn IConnection) {
+	conn.RemoveProperty(k.name)
+}
+
+// 在链接上注册该属性变化的Hook函数，属性不存在或者类型不匹配时对应的值为零值
+func (k Key[T]) OnChange(conn IConnection, hook func(conn IConnection, oldValue, newValue T)) {
+	conn.AddPropertyChangeHook(func(conn IConnection, key string, oldValue, newValue interface{}) {
+		if key != k.name {
+			return
+		}
+		o, _ := oldValue.(T)
+		n, _ := newValue.(T)
+		hook(conn, o, n)
+	})
+}
@@ -33,7 +33,7 @@ type IRequest interface {
 
 	//转进到下一个处理器开始执行 但是调用此方法的函数会根据先后顺序逆序执行
 	Call()
-	// 终止处理函数的运行 但调用此方法的函数会执行完毕
+	// 终止处理函数的运行 但调用此方法的函数会执行完毕，对IRouter与路由切片绑定的请求均有效
 	Abort()
 	// 指定接下来的Handle去执行哪个Handler函数
 	// 慎用，会导致循环调用
@@ -44,6 +44,21 @@ type IRequest interface {
 
 	// 路由切片操作 执行下一个函数
 	RouterSlicesNext()
+
+	// 报告处理出错，路由处理完成后交给Server的错误处理函数
+	SetError(err error)
+	// 获取处理过程中报告的错误
+	GetError() error
+
+	// 获取请求ID，消息不携带请求ID时返回0
+	GetRequestID() uint32
+	// 使用与请求相同的消息ID和请求ID回复对端，对端通过IClient.Call等待该回复
+	Reply(data []byte) error
+
+	// 拷贝一份与对象池无关的请求，开启RequestPoolMode时需要在路由处理完成后继续使用请求时调用
+	Copy() IRequest
+	// 将请求及其消息归还到对象池，由框架在路由处理完成后调用
+	Release()
 }
 
 type BaseRequest struct{}
@@ -60,3 +75,9 @@ func (br *BaseRequest) Abort()                           {}
 func (br *BaseRequest) Goto(HandleStep)                  {}
 func (br *BaseRequest) BindRouterSlices([]RouterHandler) {}
 func (br *BaseRequest) RouterSlicesNext()                {}
+func (br *BaseRequest) SetError(err error)               {}
+func (br *BaseRequest) GetError() error                  { return nil }
+func (br *BaseRequest) GetRequestID() uint32             { return 0 }
+func (br *BaseRequest) Reply(data []byte) error          { return nil }
+func (br *BaseRequest) Copy() IRequest                   { return nil }
+func (br *BaseRequest) Release()                         {}
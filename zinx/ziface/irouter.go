@@ -20,6 +20,13 @@ type IRouter interface {
 */
 type RouterHandler func(request IRequest)
 
+// 收到没有绑定路由的msgID时调用，可以回复错误消息或者累计次数后断开链接
+type NotFoundHandler func(request IRequest)
+
+// 路由处理发生panic或者通过IRequest.SetError报告错误时调用
+// panic时err为包装了znet.ErrRouterPanic的错误
+type ErrorHandler func(request IRequest, err error)
+
 type IRouterSlices interface {
 	// 添加全局组件
 	Use(Handlers ...RouterHandler)
@@ -41,3 +48,29 @@ type IGroupRouterSlices interface {
 	// 添加业务处理器集合
 	AddHandler(msgId uint32, Handlers ...RouterHandler)
 }
+
+// 路由的注册方式
+type RouteStyle string
+
+const (
+	RouteStyleRouter RouteStyle = "router"        //通过AddRouter/ReplaceRouter注册的IRouter
+	RouteStyleSlices RouteStyle = "router_slices" //通过AddRouterSlices/Group/ReplaceRouterSlices注册的路由切片
+)
+
+// 路由分组的msgID范围
+type RouteGroup struct {
+	Start uint32
+	End   uint32
+}
+
+// 已注册路由的信息，可以用于管理后台查看当前的路由表
+type RouteInfo struct {
+	MsgID uint32
+	Style RouteStyle
+	// 业务处理器名称，IRouter为类型名称，路由切片为函数名称
+	Handlers []string
+	// 在业务处理器之前执行的公共组件名称(Use以及分组的Use添加)，按执行顺序排列
+	Middleware []string
+	// 所属的路由分组，不属于任何分组时为nil
+	Group *RouteGroup
+}
@@ -0,0 +1,61 @@
+package ziface
+
+/*
+	会话层，链接短暂断开后客户端可以重连并恢复到原来的会话
+	1. 链接建立时服务端创建会话，通过SessionTokenMsgID下发恢复令牌
+	2. 服务端通过ISession.SendMsg发送的消息带有递增的seq，包装在SessionDataMsgID中，客户端通过SessionAckMsgID确认
+	3. 链接断开后会话保留一段宽限期，期间保存链接属性以及未确认的消息
+	4. 客户端重连后通过SessionResumeMsgID携带令牌和最后收到的seq请求恢复，
+	   服务端回复恢复结果，成功时将会话绑定到新的链接，恢复链接属性并按顺序重发客户端未收到的消息
+*/
+
+// 会话层使用的保留消息ID
+const (
+	SessionTokenMsgID  uint32 = 99990 //服务端->客户端 下发会话令牌 data: token
+	SessionResumeMsgID uint32 = 99991 //客户端->服务端 请求恢复会话 data: lastSeq(8字节) + token；服务端->客户端 恢复结果 data: 1字节状态
+	SessionAckMsgID    uint32 = 99992 //客户端->服务端 确认收到seq及之前的所有消息 data: seq(8字节)
+	SessionDataMsgID   uint32 = 99993 //服务端->客户端 会话消息 data: seq(8字节) + msgID(4字节) + 消息内容
+)
+
+// 会话恢复结果
+const (
+	SessionResumeOK     byte = 0 //恢复成功
+	SessionResumeFailed byte = 1 //会话不存在、已过期或者未确认的消息已被丢弃
+)
+
+// 服务端会话
+type ISession interface {
+	//获取会话的恢复令牌
+	GetToken() string
+
+	//获取会话当前绑定的链接，链接断开等待恢复期间返回nil
+	GetConnection() IConnection
+
+	//发送会话消息，客户端确认之前消息会被保留，会话恢复后重发给客户端
+	//链接断开等待恢复期间调用只保存消息
+	SendMsg(msgID uint32, data []byte) error
+
+	//获取尚未被客户端确认的消息数量
+	GetUnackedCount() int
+
+	//结束会话，之后不能再恢复
+	Close()
+}
+
+// 服务端会话管理
+type ISessionManager interface {
+	//根据令牌获取会话
+	Get(token string) (ISession, bool)
+
+	//获取链接当前绑定的会话
+	GetByConn(conn IConnection) (ISession, bool)
+
+	//获取会话数量(包括等待恢复的会话)
+	Len() int
+
+	//设置会话恢复到新链接后的Hook函数
+	SetOnSessionResumed(func(session ISession, conn IConnection))
+
+	//设置会话超过宽限期未恢复被移除时的Hook函数
+	SetOnSessionExpired(func(session ISession))
+}
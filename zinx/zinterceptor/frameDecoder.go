@@ -149,6 +149,7 @@ type FrameDecoder struct {
 	tooLongFrameLength     int64 //当某个数据包的长度超过maxLength，则开启丢弃模式，此字段记录需要丢弃的数据长度
 	bytesToDiscard         int64 //记录还剩余多少字节需要丢弃
 	in                     []byte
+	start                  int //in中已经解码完成的字节数
 	lock                   sync.Mutex
 }
 
@@ -216,18 +217,13 @@ func (d *FrameDecoder) getUnadjustedFrameLength(buf *bytes.Buffer, offset int, l
 	var frameLength int64
 	arr := buf.Bytes()
 	arr = arr[offset : offset+length]
-	buffer := bytes.NewBuffer(arr)
 	switch length {
 	case 1:
 		//byte
-		var value uint8
-		binary.Read(buffer, order, &value)
-		frameLength = int64(value)
+		frameLength = int64(arr[0])
 	case 2:
 		//short
-		var value uint16
-		binary.Read(buffer, order, &value)
-		frameLength = int64(value)
+		frameLength = int64(order.Uint16(arr))
 	case 3:
 		//int占32位，这里取出后24位，返回int类型
 		if order == binary.LittleEndian {
@@ -239,12 +235,10 @@ func (d *FrameDecoder) getUnadjustedFrameLength(buf *bytes.Buffer, offset int, l
 		}
 	case 4:
 		//int
-		var value uint32
-		binary.Read(buffer, order, &value)
-		frameLength = int64(value)
+		frameLength = int64(order.Uint32(arr))
 	case 8:
 		//long
-		binary.Read(buffer, order, &frameLength)
+		frameLength = int64(order.Uint64(arr))
 	default:
 		panic(fmt.Sprintf("unsupported LengthFieldLength: %d (expected: 1, 2, 3, 4, or 8)", d.LengthFieldLength))
 	}
@@ -366,11 +360,8 @@ func (d *FrameDecoder) decode(buf []byte) []byte {
 	//获取跳过后的真实数据长度
 	actualFrameLength := frameLengthInt - d.InitialBytesToStrip
 
-	//提供真实的数据
-	buff := make([]byte, actualFrameLength)
-	in.Read(buff)
-
-	return buff
+	//提供真实的数据，直接引用输入的缓冲区
+	return in.Next(actualFrameLength)
 
 }
 
@@ -378,21 +369,39 @@ func (d *FrameDecoder) Decode(buff []byte) [][]byte {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
+	resp := d.decodeTo(make([][]byte, 0), buff)
+	//解码出的帧引用内部缓冲区，返回前拷贝一份
+	for i, frame := range resp {
+		resp[i] = append(make([]byte, 0, len(frame)), frame...)
+	}
+	return resp
+}
+
+func (d *FrameDecoder) DecodeTo(frames [][]byte, buff []byte) [][]byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.decodeTo(frames, buff)
+}
+
+func (d *FrameDecoder) decodeTo(frames [][]byte, buff []byte) [][]byte {
+	//上一次解码出的帧已经不再使用，将剩余的半包数据移动到缓冲区头部，复用缓冲区
+	if d.start > 0 {
+		n := copy(d.in, d.in[d.start:])
+		d.in = d.in[:n]
+		d.start = 0
+	}
 	d.in = append(d.in, buff...)
-	resp := make([][]byte, 0)
 
 	for {
-		arr := d.decode(d.in)
+		arr := d.decode(d.in[d.start:])
 
 		if arr != nil {
 			//证明已经解析出一个完整的包
-			resp = append(resp, arr)
-			_size := len(arr) + d.InitialBytesToStrip
-			if _size > 0 {
-				d.in = d.in[_size:]
-			}
+			frames = append(frames, arr)
+			d.start += len(arr) + d.InitialBytesToStrip
 		} else {
-			return resp
+			return frames
 		}
 	}
 }
@@ -44,3 +44,12 @@ func SetLogger(newlog ziface.ILogger) {
 func Ins() ziface.ILogger {
 	return LogInstance
 }
+
+// 当前是否会输出debug日志，用于在热点路径上避免无用的日志参数构造
+// 使用自定义日志时无法得知其日志级别，总是返回true
+func DebugEnabled() bool {
+	if _, ok := LogInstance.(*DefaultLog); ok {
+		return !StdLog.verifyLogIsolation(LogDebug)
+	}
+	return true
+}
@@ -1,19 +1,23 @@
 package znet
 
-import "time"
+import (
+	"sync/atomic"
+	"time"
+)
 
 const (
 	maxDelay = 1 * time.Second
 )
 
+// 多个监听器以及websocket升级处理器会并发调用，duration使用原子操作读写
 type acceptDelay struct {
-	duration time.Duration
+	duration atomic.Int64
 }
 
 var AcceptDelay *acceptDelay
 
 func init() {
-	AcceptDelay = &acceptDelay{duration: 0}
+	AcceptDelay = &acceptDelay{}
 }
 
 func (d *acceptDelay) Delay() {
@@ -22,22 +26,32 @@ func (d *acceptDelay) Delay() {
 }
 
 func (d *acceptDelay) Reset() {
-	d.duration = 0
+	d.duration.Store(0)
 }
 
 func (d *acceptDelay) Up() {
-	if d.duration == 0 {
-		d.duration = 5 * time.Millisecond
-		return
-	}
-	d.duration = 2 * d.duration
-	if d.duration > maxDelay {
-		d.duration = maxDelay
+	for {
+		old := d.duration.Load()
+		next := 2 * old
+		if old == 0 {
+			next = int64(5 * time.Millisecond)
+		}
+		if next > int64(maxDelay) {
+			next = int64(maxDelay)
+		}
+		if d.duration.CompareAndSwap(old, next) {
+			return
+		}
 	}
 }
 
+// 当前的等待时间
+func (d *acceptDelay) Duration() time.Duration {
+	return time.Duration(d.duration.Load())
+}
+
 func (d *acceptDelay) do() {
-	if d.duration > 0 {
-		time.Sleep(d.duration)
+	if duration := d.Duration(); duration > 0 {
+		time.Sleep(duration)
 	}
 }
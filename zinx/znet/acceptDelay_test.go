@@ -17,16 +17,18 @@ func teardown() {
 }
 
 func TestDelay(t *testing.T) {
-	assert.Equal(t, time.Duration(0), AcceptDelay.duration)
+	// 其他测试中的监听器可能已经修改过全局的等待时间
+	AcceptDelay.Reset()
+	assert.Equal(t, time.Duration(0), AcceptDelay.Duration())
 	AcceptDelay.Up()
-	assert.Equal(t, 5*time.Millisecond, AcceptDelay.duration)
+	assert.Equal(t, 5*time.Millisecond, AcceptDelay.Duration())
 	AcceptDelay.Reset()
-	assert.Equal(t, time.Duration(0), AcceptDelay.duration)
+	assert.Equal(t, time.Duration(0), AcceptDelay.Duration())
 
 	for i := 0; i < 600; i++ {
 		AcceptDelay.Up()
 	}
-	assert.Equal(t, 1*time.Second, AcceptDelay.duration)
+	assert.Equal(t, 1*time.Second, AcceptDelay.Duration())
 }
 
 func TestMain(m *testing.M) {
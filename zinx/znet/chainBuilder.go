@@ -13,6 +13,9 @@ import (
 type chainBuilder struct {
 	body       []ziface.IInterceptor
 	head, tail ziface.IInterceptor
+
+	// 按顺序排列好的所有拦截器，在拦截器变化时重新生成，避免每条消息都重新构造
+	interceptors []ziface.IInterceptor
 }
 
 func newChainBuilder() *chainBuilder {
@@ -23,18 +26,20 @@ func newChainBuilder() *chainBuilder {
 
 func (ic *chainBuilder) Head(interceptor ziface.IInterceptor) {
 	ic.head = interceptor
+	ic.build()
 }
 
 func (ic *chainBuilder) Tail(interceptor ziface.IInterceptor) {
 	ic.tail = interceptor
+	ic.build()
 }
 
 func (ic *chainBuilder) AddInterceptor(interceptor ziface.IInterceptor) {
 	ic.body = append(ic.body, interceptor)
+	ic.build()
 }
 
-// 按顺序执行当前链中的所有拦截器
-func (ic *chainBuilder) Execute(req ziface.IcReq) ziface.IcResp {
+func (ic *chainBuilder) build() {
 	// 在builder中放入所有拦截器
 	var interceptors []ziface.IInterceptor
 
@@ -50,8 +55,13 @@ func (ic *chainBuilder) Execute(req ziface.IcReq) ziface.IcResp {
 		interceptors = append(interceptors, ic.tail)
 	}
 
+	ic.interceptors = interceptors
+}
+
+// 按顺序执行当前链中的所有拦截器
+func (ic *chainBuilder) Execute(req ziface.IcReq) ziface.IcResp {
 	//创建一个责任器链并执行每个拦截器
-	chain := zinterceptor.NewChain(interceptors, 0, req)
+	chain := zinterceptor.NewChain(ic.interceptors, 0, req)
 
 	return chain.Proceed(req)
 }
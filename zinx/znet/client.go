@@ -1,10 +1,14 @@
 package znet
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"github.com/gorilla/websocket"
+	"github.com/xtaci/kcp-go"
 	"net"
+	"net/url"
+	"sync"
 	"time"
 	"zinx_server/zinx/zconf"
 	"zinx_server/zinx/zdecoder"
@@ -20,28 +24,48 @@ type Client struct {
 	Ip string
 	//目标链接服务器的端口
 	Port int
+	//目标链接服务器的unix domain socket路径
+	socketPath string
 	//客户端版本
 	version string
-	//链接实例
+	//链接实例，重连时会被替换，通过Conn()读取
 	conn ziface.IConnection
+	//保护conn以及exitChan/connDone
+	connLock sync.Mutex
+	//Restart/Stop互斥，保证同一时间只有一个链接goroutine
+	restartLock sync.Mutex
+	//保证拦截器和worker只在第一次Start时注册
+	startOnce sync.Once
 	//该client的连接创建时hook函数
 	onConnStart func(conn ziface.IConnection)
 	//该client的连接断开时hook函数
 	onConnStop func(conn ziface.IConnection)
 	//数据报文的封包方式
 	packet ziface.IDataPack
-	//异步获取连接关闭状态
+	//通知当前链接goroutine退出
 	exitChan chan struct{}
+	//当前链接goroutine退出后关闭
+	connDone chan struct{}
 	//消息管理模块
 	msgHandler ziface.IMsgHandle
 	//断粘包解码器
 	decoder ziface.IDecoder
 	//心跳检测器
 	hc ziface.IHeartbeatChecker
+	// 会话层，调用StartSession之后开启
+	session *clientSession
+	// 等待回复的Call调用
+	calls clientCalls
 	//使用TLS
 	useTLS bool
+	//TLS配置，为空则跳过服务端证书校验
+	tlsConfig *tls.Config
 	//websocket 链接
 	dialer *websocket.Dialer
+	//websocket 请求路径
+	wsPath string
+	//自定义拨号方法，为空则直接拨号(如测试中使用内存管道)
+	dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
 	//Error Channel
 	ErrChan chan error
 }
@@ -53,7 +77,7 @@ func NewClient(ip string, port int, opts ...ClientOption) ziface.IClient {
 		Port:    port,
 		version: "tcp",
 
-		msgHandler: newMsgHandle(),
+		msgHandler: newClientMsgHandle(),
 		packet:     zpack.Factory().NewPack(ziface.ZinxDataPack),
 		decoder:    zdecoder.NewTLVDecoder(),
 		ErrChan:    make(chan error),
@@ -75,11 +99,12 @@ func NewWsClient(ip string, port int, opts ...ClientOption) ziface.IClient {
 		Ip:   ip,
 		Port: port,
 
-		msgHandler: newMsgHandle(),
+		msgHandler: newClientMsgHandle(),
 		packet:     zpack.Factory().NewPack(ziface.ZinxDataPack), // Default to using Zinx's TLV packet format(默认使用zinx的TLV封包方式)
 		decoder:    zdecoder.NewTLVDecoder(),                     // Default to using Zinx's TLV decoder(默认使用zinx的TLV解码器)
 		version:    "websocket",
 		dialer:     &websocket.Dialer{},
+		wsPath:     zconf.GlobalObject.WsPath,
 		ErrChan:    make(chan error),
 	}
 
@@ -91,6 +116,45 @@ func NewWsClient(ip string, port int, opts ...ClientOption) ziface.IClient {
 	return c
 }
 
+func NewKcpClient(ip string, port int, opts ...ClientOption) ziface.IClient {
+	c := &Client{
+		Name:    "ZinxClientKcp",
+		Ip:      ip,
+		Port:    port,
+		version: "kcp",
+
+		msgHandler: newClientMsgHandle(),
+		packet:     zpack.Factory().NewPack(ziface.ZinxDataPack),
+		decoder:    zdecoder.NewTLVDecoder(),
+		ErrChan:    make(chan error),
+	}
+	//应用Option设置
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+func NewUnixClient(socketPath string, opts ...ClientOption) ziface.IClient {
+	c := &Client{
+		Name:       "ZinxClientUnix",
+		socketPath: socketPath,
+		version:    "unix",
+
+		msgHandler: newClientMsgHandle(),
+		packet:     zpack.Factory().NewPack(ziface.ZinxDataPack),
+		decoder:    zdecoder.NewTLVDecoder(),
+		ErrChan:    make(chan error),
+	}
+	//应用Option设置
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
 func NewTLSClient(ip string, port int, opts ...ClientOption) ziface.IClient {
 
 	c, _ := NewClient(ip, port, opts...).(*Client)
@@ -100,95 +164,223 @@ func NewTLSClient(ip string, port int, opts ...ClientOption) ziface.IClient {
 	return c
 }
 
+// 创建使用TLS加密的websocket客户端(wss://)
+func NewWssClient(ip string, port int, opts ...ClientOption) ziface.IClient {
+
+	c, _ := NewWsClient(ip, port, opts...).(*Client)
+
+	c.useTLS = true
+	c.dialer.TLSClientConfig = c.getTLSConfig()
+
+	return c
+}
+
+// 获取TLS配置
+func (c *Client) getTLSConfig() *tls.Config {
+	if c.tlsConfig != nil {
+		return c.tlsConfig
+	}
+	return &tls.Config{
+		// Skip certificate verification here because the CA certificate of the certificate issuer is not authenticated
+		// (这里是跳过证书验证，因为证书签发机构的CA证书是不被认证的)
+		InsecureSkipVerify: true,
+	}
+}
+
+// 建立原始链接，设置了自定义拨号方法时使用该方法
+func (c *Client) dialRaw(network, address string) (net.Conn, error) {
+	if c.dialFunc != nil {
+		return c.dialFunc(context.Background(), network, address)
+	}
+	return net.Dial(network, address)
+}
+
 // 重启客户端
+// 先结束之前的链接goroutine并等待其退出，再建立新的链接
 func (c *Client) Restart() {
-	c.exitChan = make(chan struct{})
-	//客户端将协程池关闭
-	zconf.GlobalObject.WorkerPoolSize = 0
-
-	go func() {
-		addr := &net.TCPAddr{
-			IP:   net.ParseIP(c.Ip),
-			Port: c.Port,
-			Zone: "",
-		}
+	c.restartLock.Lock()
+	defer c.restartLock.Unlock()
 
-		//创建原始Socket，得到net.Conn
-		switch c.version {
-		case "websocket":
-			wsAddr := fmt.Sprintf("ws://%s:%d", c.Ip, c.Port)
+	c.stopConnLoop()
 
-			wsConn, _, err := c.dialer.Dial(wsAddr, nil)
+	exitChan := make(chan struct{})
+	connDone := make(chan struct{})
+	c.connLock.Lock()
+	c.exitChan, c.connDone = exitChan, connDone
+	c.connLock.Unlock()
+
+	go c.connect(exitChan, connDone)
+}
+
+// 通知当前的链接goroutine退出并等待，需要持有restartLock
+func (c *Client) stopConnLoop() {
+	c.connLock.Lock()
+	exitChan, connDone := c.exitChan, c.connDone
+	c.exitChan, c.connDone = nil, nil
+	c.connLock.Unlock()
+
+	if exitChan == nil {
+		return
+	}
+	close(exitChan)
+	<-connDone
+}
+
+// 建立链接失败，通知调用方，客户端停止时不再阻塞
+func (c *Client) reportErr(exitChan chan struct{}, err error) {
+	select {
+	case c.ErrChan <- err:
+	case <-exitChan:
+	}
+}
+
+// 建立链接并运行，直到exitChan被关闭，退出时停止该链接
+func (c *Client) connect(exitChan chan struct{}, connDone chan struct{}) {
+	defer close(connDone)
+
+	addr := &net.TCPAddr{
+		IP:   net.ParseIP(c.Ip),
+		Port: c.Port,
+		Zone: "",
+	}
+
+	var conn ziface.IConnection
+	//创建原始Socket，得到net.Conn
+	switch c.version {
+	case "websocket":
+		scheme := "ws"
+		if c.useTLS {
+			scheme = "wss"
+		}
+		wsAddr := (&url.URL{
+			Scheme: scheme,
+			Host:   fmt.Sprintf("%s:%d", c.Ip, c.Port),
+			Path:   c.wsPath,
+		}).String()
+
+		if c.dialFunc != nil {
+			c.dialer.NetDialContext = c.dialFunc
+		}
+		wsConn, _, err := c.dialer.Dial(wsAddr, nil)
+		if err != nil {
+			zlog.Ins().ErrorF("WsClient connect to server failed, err:%v", err)
+			c.reportErr(exitChan, err)
+			return
+		}
+		conn = newWsClientConn(c, wsConn)
+	case "kcp":
+		kcpAddr := fmt.Sprintf("%s:%d", c.Ip, c.Port)
+
+		sess, err := kcp.DialWithOptions(kcpAddr, nil,
+			zconf.GlobalObject.KcpFecDataShards, zconf.GlobalObject.KcpFecParityShards)
+		if err != nil {
+			zlog.Ins().ErrorF("KcpClient connect to server failed, err:%v", err)
+			c.reportErr(exitChan, err)
+			return
+		}
+		setKcpSessionOptions(sess)
+		conn = newClientConn(c, sess)
+	case "unix":
+		rawConn, err := c.dialRaw("unix", c.socketPath)
+		if err != nil {
+			zlog.Ins().ErrorF("UnixClient connect to server failed, err:%v", err)
+			c.reportErr(exitChan, err)
+			return
+		}
+		conn = newClientConn(c, rawConn)
+	default:
+		var rawConn net.Conn
+		var err error
+		if c.dialFunc != nil {
+			// 使用调用方提供的拨号方法
+			rawConn, err = c.dialRaw("tcp", fmt.Sprintf("%s:%d", c.Ip, c.Port))
+			if err == nil && c.useTLS {
+				tlsConn := tls.Client(rawConn, c.getTLSConfig())
+				if err = tlsConn.Handshake(); err != nil {
+					_ = rawConn.Close()
+				}
+				rawConn = tlsConn
+			}
 			if err != nil {
-				zlog.Ins().ErrorF("WsClient connect to server failed, err:%v", err)
-				c.ErrChan <- err
+				zlog.Ins().ErrorF("client connect to server failed, err:%v", err)
+				c.reportErr(exitChan, err)
 				return
 			}
-			c.conn = newWsClientConn(c, wsConn)
-		default:
-			var conn net.Conn
-			var err error
-			if c.useTLS {
-				// TLS encryption
-				config := &tls.Config{
-					// Skip certificate verification here because the CA certificate of the certificate issuer is not authenticated
-					// (这里是跳过证书验证，因为证书签发机构的CA证书是不被认证的)
-					InsecureSkipVerify: true,
-				}
+		} else if c.useTLS {
+			// TLS encryption
+			config := c.getTLSConfig()
 
-				conn, err = tls.Dial("tcp", fmt.Sprintf("%v:%v", net.ParseIP(c.Ip), c.Port), config)
-				if err != nil {
-					zlog.Ins().ErrorF("tls client connect to server failed, err:%v", err)
-					c.ErrChan <- err
-					return
-				}
-			} else {
-				conn, err = net.DialTCP("tcp", nil, addr)
-				if err != nil {
-					// connection failed
-					zlog.Ins().ErrorF("client connect to server failed, err:%v", err)
-					c.ErrChan <- err
-					return
-				}
+			rawConn, err = tls.Dial("tcp", fmt.Sprintf("%v:%v", net.ParseIP(c.Ip), c.Port), config)
+			if err != nil {
+				zlog.Ins().ErrorF("tls client connect to server failed, err:%v", err)
+				c.reportErr(exitChan, err)
+				return
+			}
+		} else {
+			rawConn, err = net.DialTCP("tcp", nil, addr)
+			if err != nil {
+				// connection failed
+				zlog.Ins().ErrorF("client connect to server failed, err:%v", err)
+				c.reportErr(exitChan, err)
+				return
 			}
-			// Create Connection object
-			c.conn = newClientConn(c, conn)
 		}
+		// Create Connection object
+		conn = newClientConn(c, rawConn)
+	}
 
-		zlog.Ins().InfoF("[START] Zinx Client LocalAddr: %s, RemoteAddr: %s\n", c.conn.LocalAddr(), c.conn.RemoteAddr())
-		// HeartBeat detection
-		if c.hc != nil {
-			// Bind connection and heartbeat detector after connection is successfully established
-			// (创建链接成功，绑定链接与心跳检测器)
-			c.hc.BindConn(c.conn)
-		}
+	c.connLock.Lock()
+	c.conn = conn
+	c.connLock.Unlock()
+
+	zlog.Ins().InfoF("[START] Zinx Client LocalAddr: %s, RemoteAddr: %s\n", conn.LocalAddr(), conn.RemoteAddr())
+	// HeartBeat detection
+	if c.hc != nil {
+		// Bind connection and heartbeat detector after connection is successfully established
+		// (创建链接成功，绑定链接与心跳检测器)
+		c.hc.BindConn(conn)
+	}
 
-		// Start connection
-		go c.conn.Start()
+	if c.session != nil {
+		// 重连后请求恢复之前的会话，在开始读取之前标记，避免新链接的令牌覆盖之前的会话
+		c.session.onConnStart(conn)
+	}
 
-		select {
-		case <-c.exitChan:
-			zlog.Ins().InfoF("client exit.")
-		}
-	}()
+	// Start connection
+	go conn.Start()
 
+	select {
+	case <-exitChan:
+		zlog.Ins().InfoF("client exit.")
+		conn.Stop()
+	}
 }
 
 // 启动客户端
 func (c *Client) Start() {
-	//将解码器添加到拦截器
-	if c.decoder != nil {
-		c.msgHandler.AddInterceptor(c.decoder)
-	}
+	//拦截器和worker只注册一次，再次调用Start时只重新建立链接
+	c.startOnce.Do(func() {
+		//将解码器添加到拦截器
+		if c.decoder != nil {
+			c.msgHandler.AddInterceptor(c.decoder)
+		}
+		//在路由之前取出Call调用的回复
+		c.msgHandler.AddInterceptor(&c.calls)
+		//启动worker，按顺序处理收到的消息
+		c.msgHandler.StartWorkerPool()
+	})
 	c.Restart()
 }
 
 // 停止客户端
 func (c *Client) Stop() {
-	zlog.Ins().InfoF("[STOP] Zinx Client LocalAddr: %s, RemoteAddr: %s\n", c.conn.LocalAddr(), c.conn.RemoteAddr())
-	c.conn.Stop()
-	c.exitChan <- struct{}{}
-	close(c.exitChan)
+	c.restartLock.Lock()
+	defer c.restartLock.Unlock()
+
+	if conn := c.Conn(); conn != nil {
+		zlog.Ins().InfoF("[STOP] Zinx Client LocalAddr: %s, RemoteAddr: %s\n", conn.LocalAddr(), conn.RemoteAddr())
+	}
+	c.stopConnLoop()
 	close(c.ErrChan)
 }
 
@@ -199,6 +391,9 @@ func (c *Client) AddRouter(msgID uint32, router ziface.IRouter) {
 
 // 获取当前Client的连接
 func (c *Client) Conn() ziface.IConnection {
+	c.connLock.Lock()
+	defer c.connLock.Unlock()
+
 	return c.conn
 }
 
@@ -262,6 +457,26 @@ func (c *Client) StartHeartBeatWithOption(interval time.Duration, option *ziface
 	c.hc = checker
 }
 
+// 开启会话层，重连后自动恢复会话并补收断开期间的消息
+func (c *Client) StartSession() {
+	session := newClientSession(c)
+
+	//添加会话层的路由
+	c.AddRouter(ziface.SessionTokenMsgID, &clientSessionRouter{handle: session.handleToken})
+	c.AddRouter(ziface.SessionResumeMsgID, &clientSessionRouter{handle: session.handleResume})
+	c.AddRouter(ziface.SessionDataMsgID, &clientSessionRouter{handle: session.handleData})
+
+	c.session = session
+}
+
+// 获取当前会话的令牌，未开启会话层或者尚未收到令牌时返回空
+func (c *Client) GetSessionToken() string {
+	if c.session == nil {
+		return ""
+	}
+	return c.session.getToken()
+}
+
 // 获取客户端的长度字段
 func (c *Client) GetLengthField() *ziface.LengthField {
 	if c.decoder != nil {
@@ -0,0 +1,136 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zlog"
+	"zinx_server/zinx/zpack"
+)
+
+/*
+	客户端请求-响应式调用
+	Call为每个请求分配请求ID并等待服务端通过Request.Reply携带相同请求ID的回复
+	回复在进入路由之前由拦截器取出，不会交给路由处理
+*/
+
+var (
+	// 客户端尚未建立链接
+	ErrClientNotConnected = errors.New("client not connected")
+	// 等待回复超时
+	ErrCallTimeout = errors.New("call timeout")
+	// 等待回复期间链接断开
+	ErrCallConnClosed = errors.New("connection closed before call reply")
+)
+
+// 正在等待回复的调用
+type clientCalls struct {
+	lock    sync.Mutex
+	lastID  uint32
+	pending map[uint32]chan ziface.IMessage
+}
+
+// 分配请求ID，请求ID不为0且不与等待中的调用重复
+func (cs *clientCalls) add() (uint32, chan ziface.IMessage) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	if cs.pending == nil {
+		cs.pending = make(map[uint32]chan ziface.IMessage)
+	}
+	for {
+		cs.lastID++
+		if _, ok := cs.pending[cs.lastID]; cs.lastID != 0 && !ok {
+			break
+		}
+	}
+	reply := make(chan ziface.IMessage, 1)
+	cs.pending[cs.lastID] = reply
+	return cs.lastID, reply
+}
+
+func (cs *clientCalls) remove(requestID uint32) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	delete(cs.pending, requestID)
+}
+
+// 等待回复的调用数量
+func (cs *clientCalls) count() int {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+
+	return len(cs.pending)
+}
+
+// 取出携带请求ID的回复，其余消息继续交给路由处理
+func (cs *clientCalls) Intercept(chain ziface.IChain) ziface.IcResp {
+	request, ok := chain.Request().(ziface.IRequest)
+	if !ok {
+		return chain.Proceed(chain.Request())
+	}
+	requestID := request.GetRequestID()
+	if requestID == 0 {
+		return chain.Proceed(chain.Request())
+	}
+
+	cs.lock.Lock()
+	reply, ok := cs.pending[requestID]
+	delete(cs.pending, requestID)
+	cs.lock.Unlock()
+
+	if ok {
+		// 请求会被回收，这里拷贝一份消息
+		data := make([]byte, len(request.GetData()))
+		copy(data, request.GetData())
+		msg := zpack.NewMsgPackage(request.GetMsgID(), data)
+		msg.SetRequestID(requestID)
+		reply <- msg
+	} else {
+		// 已经超时或者被取消的调用
+		zlog.Ins().DebugF("drop call reply msgID=%d requestID=%d", request.GetMsgID(), requestID)
+	}
+	request.Release()
+	return nil
+}
+
+// 发送携带请求ID的消息并等待回复，ctx没有截止时间时使用zconf.CallTimeout
+func (c *Client) Call(ctx context.Context, msgID uint32, data []byte) (ziface.IMessage, error) {
+	conn := c.Conn()
+	if conn == nil {
+		return nil, ErrClientNotConnected
+	}
+	if _, ok := ctx.Deadline(); !ok && zconf.GlobalObject.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, zconf.GlobalObject.CallTimeoutDuration())
+		defer cancel()
+	}
+
+	requestID, reply := c.calls.add()
+	defer c.calls.remove(requestID)
+
+	if err := conn.SendMsgWithRequestID(msgID, requestID, data); err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg := <-reply:
+		return msg, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: msgID=%d requestID=%d", ErrCallTimeout, msgID, requestID)
+		}
+		return nil, ctx.Err()
+	case <-conn.Context().Done():
+		return nil, ErrCallConnClosed
+	}
+}
+
+// 等待回复的调用数量
+func (c *Client) GetCallsInFlight() int {
+	return c.calls.count()
+}
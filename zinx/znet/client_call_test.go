@@ -0,0 +1,99 @@
+package znet
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/zdecoder"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zpack"
+)
+
+func TestClientCall(t *testing.T) {
+	workerPoolSize := zconf.GlobalObject.WorkerPoolSize
+	defer func() { zconf.GlobalObject.WorkerPoolSize = workerPoolSize }()
+
+	listener := NewPipeListener()
+	s := NewServer()
+	s.SetPacket(zpack.Factory().NewPack(ziface.ZinxDataPackRPC))
+	s.SetDecoder(zdecoder.NewRPCDecoder())
+	started := make(chan ziface.IConnection, 2)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		assert.Nil(t, request.Reply(append([]byte("pong:"), request.GetData()...)))
+	})
+	// 不回复，只发送普通消息
+	s.AddRouterSlices(2, func(request ziface.IRequest) {
+		assert.NotEqual(t, uint32(0), request.GetRequestID())
+		assert.Nil(t, request.GetConnection().SendMsg(3, []byte("notify")))
+	})
+	s.StartWithListener(listener)
+	defer s.Stop()
+
+	router := &pipeClientRouter{replies: make(chan string, 1)}
+	client := NewClient("127.0.0.1", 8999, WithDialerClient(listener.DialContext))
+	client.SetPacket(zpack.Factory().NewPack(ziface.ZinxDataPackRPC))
+	client.SetDecoder(zdecoder.NewRPCDecoder())
+	client.AddRouter(3, router)
+	clientStarted := make(chan struct{}, 2)
+	client.SetOnConnStart(func(conn ziface.IConnection) { clientStarted <- struct{}{} })
+	client.Start()
+	defer client.Stop()
+	serverConn := <-started
+	<-clientStarted
+
+	reply, err := client.Call(context.Background(), 1, []byte("ping"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), reply.GetMsgID())
+	assert.Equal(t, "pong:ping", string(reply.GetData()))
+	assert.NotEqual(t, uint32(0), reply.(ziface.IRequestIDMessage).GetRequestID())
+
+	// 并发调用的回复按请求ID对应
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := fmt.Sprintf("ping%d", i)
+			reply, err := client.Call(context.Background(), 1, []byte(data))
+			if assert.Nil(t, err) {
+				assert.Equal(t, "pong:"+data, string(reply.GetData()))
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 没有回复时超时，普通消息仍然交给路由处理
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = client.Call(ctx, 2, nil)
+	assert.ErrorIs(t, err, ErrCallTimeout)
+	assert.Equal(t, "notify", <-router.replies)
+	assert.Equal(t, 0, client.(*Client).GetCallsInFlight())
+
+	// 等待回复期间链接断开
+	go func() {
+		<-router.replies
+		serverConn.Stop()
+	}()
+	_, err = client.Call(context.Background(), 2, nil)
+	assert.ErrorIs(t, err, ErrCallConnClosed)
+
+	// 重连后使用新的链接调用，回复只被拦截一次
+	client.Restart()
+	<-started
+	<-clientStarted
+	reply, err = client.Call(context.Background(), 1, []byte("again"))
+	assert.Nil(t, err)
+	assert.Equal(t, "pong:again", string(reply.GetData()))
+	assert.Equal(t, 0, client.(*Client).GetCallsInFlight())
+}
+
+func TestRequestReplyWithoutRequestID(t *testing.T) {
+	req := NewRequest(nil, zpack.NewMsgPackage(1, nil))
+	assert.ErrorIs(t, req.Reply(nil), ErrNoRequestID)
+}
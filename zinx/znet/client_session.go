@@ -0,0 +1,158 @@
+package znet
+
+import (
+	"encoding/binary"
+	"sync"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zlog"
+	"zinx_server/zinx/zpack"
+)
+
+/*
+	客户端会话层，协议见ziface/isession.go
+	收到会话消息后确认并还原为原始消息交给路由处理，重连(Restart)后自动请求恢复会话
+*/
+
+type clientSession struct {
+	client *Client
+
+	lock  sync.Mutex
+	token string
+	// 已经按顺序处理的最后一条会话消息的seq
+	lastSeq uint64
+	// 等待前面的消息到达的乱序消息
+	pending map[uint64][]byte
+	// 已经发出恢复请求，等待服务端回复
+	resuming bool
+	// 恢复请求期间服务端为新链接下发的令牌，恢复失败时使用
+	freshToken string
+}
+
+func newClientSession(client *Client) *clientSession {
+	return &clientSession{
+		client:  client,
+		pending: make(map[uint64][]byte),
+	}
+}
+
+func (s *clientSession) getToken() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.token
+}
+
+// 链接建立后，如果之前有会话则请求恢复
+func (s *clientSession) onConnStart(conn ziface.IConnection) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.token == "" {
+		return
+	}
+	s.resuming = true
+	s.freshToken = ""
+
+	data := make([]byte, 8+len(s.token))
+	binary.BigEndian.PutUint64(data, s.lastSeq)
+	copy(data[8:], s.token)
+	if err := conn.SendBuffMsg(ziface.SessionResumeMsgID, data); err != nil {
+		zlog.Ins().ErrorF("client resume session err: %v", err)
+	}
+}
+
+// 收到服务端下发的令牌
+func (s *clientSession) handleToken(request ziface.IRequest) {
+	token := string(request.GetData())
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.resuming {
+		s.freshToken = token
+		return
+	}
+	if token != s.token {
+		s.resetLocked(token)
+	}
+}
+
+// 收到恢复请求的结果
+func (s *clientSession) handleResume(request ziface.IRequest) {
+	data := request.GetData()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !s.resuming {
+		return
+	}
+	s.resuming = false
+	if len(data) > 0 && data[0] == ziface.SessionResumeOK {
+		return
+	}
+	// 恢复失败，使用新链接的会话
+	zlog.Ins().ErrorF("client resume session failed, token=%s", s.token)
+	s.resetLocked(s.freshToken)
+}
+
+func (s *clientSession) resetLocked(token string) {
+	s.token = token
+	s.lastSeq = 0
+	s.pending = make(map[uint64][]byte)
+}
+
+// 收到会话消息，按seq顺序还原为原始消息交给路由处理
+func (s *clientSession) handleData(request ziface.IRequest) {
+	data := request.GetData()
+	if len(data) < sessionDataHeadLen {
+		return
+	}
+	seq := binary.BigEndian.Uint64(data)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if seq <= s.lastSeq {
+		// 恢复会话时重发的已处理消息
+		return
+	}
+	msg := make([]byte, len(data))
+	copy(msg, data)
+	s.pending[seq] = msg
+
+	conn := request.GetConnection()
+	for {
+		msg, ok := s.pending[s.lastSeq+1]
+		if !ok {
+			break
+		}
+		delete(s.pending, s.lastSeq+1)
+		s.lastSeq++
+		s.dispatch(conn, msg)
+	}
+
+	ack := make([]byte, 8)
+	binary.BigEndian.PutUint64(ack, s.lastSeq)
+	_ = conn.SendBuffMsg(ziface.SessionAckMsgID, ack)
+}
+
+func (s *clientSession) dispatch(conn ziface.IConnection, msg []byte) {
+	msgID := binary.BigEndian.Uint32(msg[8:])
+	frame, err := s.client.GetPacket().Pack(zpack.NewMsgPackage(msgID, msg[sessionDataHeadLen:]))
+	if err != nil {
+		zlog.Ins().ErrorF("client session pack msgID=%d err: %v", msgID, err)
+		return
+	}
+	s.client.GetMsgHandler().Execute(newReadRequest(conn, frame))
+}
+
+// 会话层的路由
+type clientSessionRouter struct {
+	BaseRouter
+	handle func(request ziface.IRequest)
+}
+
+func (r *clientSessionRouter) Handle(request ziface.IRequest) {
+	r.handle(request)
+}
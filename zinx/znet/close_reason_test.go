@@ -0,0 +1,179 @@
+package znet
+
+import (
+	"errors"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zpack"
+)
+
+type closeEvent struct {
+	hook   string
+	reason ziface.CloseReason
+	err    error
+}
+
+// 启动一个记录链接生命周期事件的Server
+func startCloseReasonServer(t *testing.T) (*PipeListener, ziface.IServer, chan closeEvent, chan ziface.IConnection) {
+	events := make(chan closeEvent, 8)
+	started := make(chan ziface.IConnection, 1)
+	record := func(hook string) func(conn ziface.IConnection) {
+		return func(conn ziface.IConnection) {
+			reason, err := conn.GetCloseReason()
+			events <- closeEvent{hook: hook, reason: reason, err: err}
+		}
+	}
+
+	listener := NewPipeListener()
+	s := NewServer()
+	s.SetOnConnStart(func(conn ziface.IConnection) {
+		started <- conn
+	})
+	s.SetOnConnBeforeClose(record("before_close"))
+	s.SetOnConnStop(record("stop"))
+	s.SetOnConnRemoved(func(conn ziface.IConnection) {
+		// 移除后ConnManager中不再有该链接
+		_, err := s.GetConnMgr().Get(conn.GetConnID())
+		assert.NotNil(t, err)
+		record("removed")(conn)
+	})
+	s.StartWithListener(listener)
+	return listener, s, events, started
+}
+
+func waitCloseEvents(t *testing.T, events chan closeEvent, n int) []closeEvent {
+	result := make([]closeEvent, 0, n)
+	for len(result) < n {
+		select {
+		case e := <-events:
+			result = append(result, e)
+		case <-time.After(time.Second):
+			t.Fatalf("wait close events timeout, got %+v", result)
+		}
+	}
+	return result
+}
+
+func TestCloseReasonRemoteClosed(t *testing.T) {
+	listener, s, events, started := startCloseReasonServer(t)
+	defer s.Stop()
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	<-started
+	conn.Close()
+
+	result := waitCloseEvents(t, events, 3)
+	assert.Equal(t, []string{"before_close", "stop", "removed"}, []string{result[0].hook, result[1].hook, result[2].hook})
+	for _, e := range result {
+		assert.Equal(t, ziface.CloseReasonRemoteClosed, e.reason)
+		assert.True(t, errors.Is(e.err, io.EOF))
+	}
+}
+
+func TestCloseReasonKickedWithFinalMsg(t *testing.T) {
+	listener, s, events, started := startCloseReasonServer(t)
+	defer s.Stop()
+
+	// 即将关闭时仍可以发送最后的消息
+	s.SetOnConnBeforeClose(func(conn ziface.IConnection) {
+		assert.Nil(t, conn.SendBuffMsg(2, []byte("kicked")))
+		assert.Nil(t, conn.Flush())
+		reason, _ := conn.GetCloseReason()
+		events <- closeEvent{hook: "before_close", reason: reason}
+	})
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+	serverConn := <-started
+
+	kickErr := errors.New("duplicate login")
+	go serverConn.StopWithReason(ziface.CloseReasonKicked, kickErr)
+
+	dp := zpack.NewDataPack()
+	head := make([]byte, dp.GetHeadLen())
+	_, err = io.ReadFull(conn, head)
+	assert.Nil(t, err)
+	msg, _ := dp.Unpack(head)
+	data := make([]byte, msg.GetDataLen())
+	_, err = io.ReadFull(conn, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "kicked", string(data))
+
+	result := waitCloseEvents(t, events, 3)
+	for _, e := range result {
+		assert.Equal(t, ziface.CloseReasonKicked, e.reason)
+	}
+	assert.Equal(t, kickErr, result[1].err)
+
+	// 之后的Stop不会覆盖第一次的原因
+	serverConn.Stop()
+	reason, err := serverConn.GetCloseReason()
+	assert.Equal(t, ziface.CloseReasonKicked, reason)
+	assert.Equal(t, kickErr, err)
+}
+
+func TestCloseReasonPacketTooLarge(t *testing.T) {
+	listener, s, events, started := startCloseReasonServer(t)
+	defer s.Stop()
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+	<-started
+
+	packet, _ := zpack.NewDataPack().Pack(zpack.NewMsgPackage(1, make([]byte, zconf.GlobalObject.MaxPacketSize+1)))
+	go conn.Write(packet)
+
+	result := waitCloseEvents(t, events, 3)
+	assert.Equal(t, ziface.CloseReasonPacketTooLarge, result[0].reason)
+	assert.True(t, errors.Is(result[0].err, ErrPacketTooLarge))
+}
+
+func TestCloseReasonServerStop(t *testing.T) {
+	listener, s, events, started := startCloseReasonServer(t)
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+	<-started
+
+	s.Stop()
+	result := waitCloseEvents(t, events, 3)
+	assert.Equal(t, ziface.CloseReasonServerStop, result[0].reason)
+	assert.Equal(t, ziface.CloseReasonServerStop, result[2].reason)
+}
+
+type panicInterceptor struct{}
+
+func (p *panicInterceptor) Intercept(chain ziface.IChain) ziface.IcResp {
+	panic("decode panic")
+}
+
+func TestWebsocketCloseReasonPanic(t *testing.T) {
+	s := NewServer()
+	s.AddInterceptor(&panicInterceptor{})
+	started := make(chan ziface.IConnection, 1)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	httpServer := httptest.NewServer(s.WebsocketHandler())
+	defer httpServer.Close()
+	defer s.Stop()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	serverConn := <-started
+
+	// 读goroutine中的panic只关闭当前链接
+	packet, _ := zpack.NewDataPack().Pack(zpack.NewMsgPackage(1, []byte("ping")))
+	assert.Nil(t, conn.WriteMessage(websocket.BinaryMessage, packet))
+	assert.Equal(t, ziface.CloseReasonPanic, waitConnClosed(t, serverConn, time.Second))
+}
@@ -0,0 +1,166 @@
+package znet
+
+import (
+	"sync"
+	"time"
+	"zinx_server/zinx/ziface"
+)
+
+/*
+	链接属性，Connection与WsConnection共用
+	带有效期的属性通过定时器到期移除，属性变化的Hook函数在锁外调用
+*/
+
+type propertyTimer struct {
+	timer    *time.Timer
+	expireAt time.Time
+}
+
+// 会话迁移时保存的属性值以及到期时间，expireAt为零值表示没有有效期
+type propertyValue struct {
+	value    interface{}
+	expireAt time.Time
+}
+
+type connProperty struct {
+	lock   sync.RWMutex
+	values map[string]interface{}
+	// 带有效期属性的过期定时器
+	timers map[string]*propertyTimer
+	hooks  []ziface.PropertyChangeHook
+}
+
+func (p *connProperty) set(conn ziface.IConnection, key string, value interface{}, ttl time.Duration) {
+	p.lock.Lock()
+	if p.values == nil {
+		p.values = make(map[string]interface{})
+	}
+	old := p.values[key]
+	p.values[key] = value
+	p.stopTimerLocked(key)
+	if ttl > 0 {
+		p.startTimerLocked(conn, key, ttl)
+	}
+	hooks := p.hooks
+	p.lock.Unlock()
+
+	callPropertyHooks(hooks, conn, key, old, value)
+}
+
+func (p *connProperty) get(key string) (interface{}, bool) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	value, ok := p.values[key]
+	return value, ok
+}
+
+func (p *connProperty) remove(conn ziface.IConnection, key string) {
+	p.lock.Lock()
+	old, ok := p.values[key]
+	delete(p.values, key)
+	p.stopTimerLocked(key)
+	hooks := p.hooks
+	p.lock.Unlock()
+
+	if ok {
+		callPropertyHooks(hooks, conn, key, old, nil)
+	}
+}
+
+// 属性到期，期间重新设置过的属性不会被移除
+func (p *connProperty) expire(conn ziface.IConnection, key string, timer *propertyTimer) {
+	p.lock.Lock()
+	if p.timers[key] != timer {
+		p.lock.Unlock()
+		return
+	}
+	old := p.values[key]
+	delete(p.values, key)
+	delete(p.timers, key)
+	hooks := p.hooks
+	p.lock.Unlock()
+
+	callPropertyHooks(hooks, conn, key, old, nil)
+}
+
+func (p *connProperty) startTimerLocked(conn ziface.IConnection, key string, ttl time.Duration) {
+	if p.timers == nil {
+		p.timers = make(map[string]*propertyTimer)
+	}
+	timer := &propertyTimer{expireAt: time.Now().Add(ttl)}
+	timer.timer = time.AfterFunc(ttl, func() {
+		p.expire(conn, key, timer)
+	})
+	p.timers[key] = timer
+}
+
+func (p *connProperty) stopTimerLocked(key string) {
+	if timer, ok := p.timers[key]; ok {
+		timer.timer.Stop()
+		delete(p.timers, key)
+	}
+}
+
+func (p *connProperty) addHook(hook ziface.PropertyChangeHook) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// 拷贝后追加，已经取出的hooks不受影响
+	hooks := make([]ziface.PropertyChangeHook, len(p.hooks), len(p.hooks)+1)
+	copy(hooks, p.hooks)
+	p.hooks = append(hooks, hook)
+}
+
+// 链接释放时停止所有过期定时器，属性仍然可以读取，到期时间保留给会话迁移使用
+func (p *connProperty) stopTimers() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for _, timer := range p.timers {
+		timer.timer.Stop()
+	}
+}
+
+// 拷贝当前的属性以及各自的到期时间
+func (p *connProperty) snapshot() map[string]propertyValue {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	values := make(map[string]propertyValue, len(p.values))
+	for key, value := range p.values {
+		v := propertyValue{value: value}
+		if timer, ok := p.timers[key]; ok {
+			v.expireAt = timer.expireAt
+		}
+		values[key] = v
+	}
+	return values
+}
+
+// 恢复属性并按照剩余的有效期重新开始计时，已经到期的属性不再恢复，不触发Hook函数
+func (p *connProperty) restore(conn ziface.IConnection, values map[string]propertyValue) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.values == nil {
+		p.values = make(map[string]interface{}, len(values))
+	}
+	now := time.Now()
+	for key, v := range values {
+		if !v.expireAt.IsZero() && !v.expireAt.After(now) {
+			continue
+		}
+		p.values[key] = v.value
+		p.stopTimerLocked(key)
+		if !v.expireAt.IsZero() {
+			p.startTimerLocked(conn, key, v.expireAt.Sub(now))
+		}
+	}
+}
+
+func callPropertyHooks(hooks []ziface.PropertyChangeHook, conn ziface.IConnection, key string, oldValue, newValue interface{}) {
+	for _, hook := range hooks {
+		hook(conn, key, oldValue, newValue)
+	}
+}
@@ -0,0 +1,99 @@
+package znet
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"zinx_server/zinx/ziface"
+)
+
+type propertyChange struct {
+	oldValue, newValue int32
+}
+
+func TestConnectionTypedProperty(t *testing.T) {
+	listener, s, _, started := startCloseReasonServer(t)
+	defer s.Stop()
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+	serverConn := <-started
+
+	pIDKey := ziface.NewKey[int32]("pID")
+	changes := make(chan propertyChange, 4)
+	pIDKey.OnChange(serverConn, func(conn ziface.IConnection, oldValue, newValue int32) {
+		changes <- propertyChange{oldValue, newValue}
+	})
+
+	_, ok := pIDKey.Get(serverConn)
+	assert.False(t, ok)
+	assert.Equal(t, int32(-1), pIDKey.GetOr(serverConn, -1))
+
+	pIDKey.Set(serverConn, 1)
+	pIDKey.Set(serverConn, 2)
+	pID, ok := pIDKey.Get(serverConn)
+	assert.True(t, ok)
+	assert.Equal(t, int32(2), pID)
+
+	// 与字符串key的接口共用同一份属性
+	value, err := serverConn.GetProperty("pID")
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), value)
+	serverConn.SetProperty("pID", "not int32")
+	_, ok = pIDKey.Get(serverConn)
+	assert.False(t, ok)
+
+	pIDKey.Remove(serverConn)
+	_, err = serverConn.GetProperty("pID")
+	assert.NotNil(t, err)
+
+	assert.Equal(t, propertyChange{0, 1}, <-changes)
+	assert.Equal(t, propertyChange{1, 2}, <-changes)
+	assert.Equal(t, propertyChange{2, 0}, <-changes)
+	assert.Equal(t, propertyChange{0, 0}, <-changes)
+}
+
+func TestConnectionPropertyTTL(t *testing.T) {
+	listener, s, _, started := startCloseReasonServer(t)
+	defer s.Stop()
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+	serverConn := <-started
+
+	expired := make(chan string, 1)
+	serverConn.AddPropertyChangeHook(func(conn ziface.IConnection, key string, oldValue, newValue interface{}) {
+		if newValue == nil {
+			expired <- key
+		}
+	})
+
+	tokenKey := ziface.NewKeyWithTTL[string]("token", 50*time.Millisecond)
+	tokenKey.Set(serverConn, "abc")
+	// 重新设置之后按照新的有效期计算
+	time.Sleep(30 * time.Millisecond)
+	tokenKey.Set(serverConn, "def")
+	time.Sleep(30 * time.Millisecond)
+	token, ok := tokenKey.Get(serverConn)
+	assert.True(t, ok)
+	assert.Equal(t, "def", token)
+
+	select {
+	case key := <-expired:
+		assert.Equal(t, "token", key)
+	case <-time.After(time.Second):
+		t.Fatal("wait property expired timeout")
+	}
+	_, ok = tokenKey.Get(serverConn)
+	assert.False(t, ok)
+
+	// 不带有效期的设置会取消之前的有效期
+	serverConn.SetPropertyWithTTL("name", "zinx", 20*time.Millisecond)
+	serverConn.SetProperty("name", "zinx")
+	time.Sleep(50 * time.Millisecond)
+	name, err := serverConn.GetProperty("name")
+	assert.Nil(t, err)
+	assert.Equal(t, "zinx", name)
+}
@@ -0,0 +1,101 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"zinx_server/zinx/ziface"
+)
+
+/*
+	链接的流量统计，Connection与WsConnection共用
+*/
+
+type connStats struct {
+	bytesIn, bytesOut atomic.Uint64
+	msgIn, msgOut     atomic.Uint64
+	decodeErrors      atomic.Uint64
+
+	connectedAt time.Time
+	// 最后一次读写的时间(UnixNano)
+	lastActivity atomic.Int64
+}
+
+func (s *connStats) init() {
+	s.connectedAt = time.Now()
+	s.lastActivity.Store(s.connectedAt.UnixNano())
+}
+
+// 从链接中读取到n字节数据
+func (s *connStats) onRead(n int) {
+	s.bytesIn.Add(uint64(n))
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+// 收到一条完整的消息
+func (s *connStats) onMsgIn() {
+	s.msgIn.Add(1)
+}
+
+// 写出msgs条消息，共n字节
+func (s *connStats) onWrite(n int, msgs int) {
+	s.bytesOut.Add(uint64(n))
+	s.msgOut.Add(uint64(msgs))
+	s.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (s *connStats) onWriteBatch(batch [][]byte) {
+	n := 0
+	for _, data := range batch {
+		n += len(data)
+	}
+	s.onWrite(n, len(batch))
+}
+
+func (s *connStats) onDecodeError() {
+	s.decodeErrors.Add(1)
+}
+
+// 发送队列相关的统计由调用方根据发送队列填写
+func (s *connStats) snapshot() ziface.ConnStats {
+	return ziface.ConnStats{
+		BytesIn:      s.bytesIn.Load(),
+		BytesOut:     s.bytesOut.Load(),
+		MsgIn:        s.msgIn.Load(),
+		MsgOut:       s.msgOut.Load(),
+		DecodeErrors: s.decodeErrors.Load(),
+		ConnectedAt:  s.connectedAt,
+		LastActivity: time.Unix(0, s.lastActivity.Load()),
+	}
+}
+
+// 发送队列中被丢弃的消息数量
+func sendQueueDropped(q *sendQueue) uint64 {
+	var dropped uint64
+	for _, lane := range q.stats() {
+		dropped += lane.Dropped
+	}
+	return dropped
+}
+
+// 解码数据帧出错
+var ErrDecodeFrame = errors.New("decode frame failed")
+
+// 解码读取到的数据，解码器遇到非法数据时会panic，这里转换为错误返回
+func decodeFrames(decoder ziface.IFrameDecoder, frames [][]byte, data []byte) (result [][]byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrDecodeFrame, r)
+		}
+	}()
+	return decoder.DecodeTo(frames, data), nil
+}
+
+// 处理读取到的数据出错时链接关闭的原因
+func decodeCloseReason(err error) ziface.CloseReason {
+	if errors.Is(err, ErrPacketTooLarge) {
+		return ziface.CloseReasonPacketTooLarge
+	}
+	return ziface.CloseReasonDecodeError
+}
@@ -0,0 +1,96 @@
+package znet
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zpack"
+)
+
+func TestConnectionStats(t *testing.T) {
+	listener, s, events, started := startCloseReasonServer(t)
+	defer s.Stop()
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+	serverConn := <-started
+
+	stats := serverConn.GetStats()
+	assert.False(t, stats.ConnectedAt.IsZero())
+	assert.Equal(t, uint64(0), stats.BytesIn)
+
+	dp := zpack.NewDataPack()
+	packet, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("ping")))
+	_, err = conn.Write(append(packet, packet...))
+	assert.Nil(t, err)
+	assert.Eventually(t, func() bool { return serverConn.GetStats().MsgIn == 2 }, time.Second, 10*time.Millisecond)
+
+	// 内存管道的写操作需要对端同时读取
+	reply := make([]byte, int(dp.GetHeadLen())+len("pong"))
+	read := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(conn, reply)
+		read <- err
+	}()
+	assert.Nil(t, serverConn.SendMsg(2, []byte("pong")))
+	assert.Nil(t, <-read)
+
+	stats = serverConn.GetStats()
+	assert.Equal(t, uint64(2*len(packet)), stats.BytesIn)
+	assert.Equal(t, uint64(len(reply)), stats.BytesOut)
+	assert.Equal(t, uint64(1), stats.MsgOut)
+	assert.Equal(t, uint64(0), stats.DecodeErrors)
+	assert.False(t, stats.LastActivity.Before(stats.ConnectedAt))
+
+	total := s.GetConnMgr().GetStats()
+	assert.Equal(t, 1, total.ConnNum)
+	assert.Equal(t, stats.BytesIn, total.BytesIn)
+	assert.Equal(t, uint64(2), total.MsgIn)
+
+	// 超过MaxPacketSize的数据包计入解码错误，断开之后的统计仍然计入汇总
+	packet, _ = dp.Pack(zpack.NewMsgPackage(1, make([]byte, zconf.GlobalObject.MaxPacketSize+1)))
+	go conn.Write(packet)
+	result := waitCloseEvents(t, events, 3)
+	assert.Equal(t, ziface.CloseReasonPacketTooLarge, result[0].reason)
+	assert.Equal(t, uint64(1), serverConn.GetStats().DecodeErrors)
+
+	total = s.GetConnMgr().GetStats()
+	assert.Equal(t, 0, total.ConnNum)
+	assert.Equal(t, uint64(2), total.MsgIn)
+	assert.Equal(t, uint64(1), total.MsgOut)
+	assert.Equal(t, uint64(1), total.DecodeErrors)
+}
+
+func TestWebsocketConnectionStats(t *testing.T) {
+	s := NewServer()
+	started := make(chan ziface.IConnection, 1)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	httpServer := httptest.NewServer(s.WebsocketHandler())
+	defer httpServer.Close()
+	defer s.Stop()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	serverConn := <-started
+
+	// SendMsg与Send一样计入发送统计
+	assert.Nil(t, serverConn.SendMsg(2, []byte("pong")))
+	_, reply, err := conn.ReadMessage()
+	assert.Nil(t, err)
+
+	stats := serverConn.GetStats()
+	assert.Equal(t, uint64(len(reply)), stats.BytesOut)
+	assert.Equal(t, uint64(1), stats.MsgOut)
+
+	total := s.GetConnMgr().GetStats()
+	assert.Equal(t, uint64(len(reply)), total.BytesOut)
+	assert.Equal(t, uint64(1), total.MsgOut)
+}
@@ -0,0 +1,156 @@
+package znet
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+)
+
+/*
+	链接的读/写/空闲超时，与心跳检测相互独立
+	读超时和空闲超时通过socket的读deadline实现：deadline = min(最后读取时间+读超时, 最后读写时间+空闲超时)，
+	每次读写之后重新计算，写超时在每次写出之前设置写deadline
+	reactor模式下不使用读deadline，由reactor定时检查是否超时
+*/
+
+// 可以设置读写deadline的链接，net.Conn与websocket.Conn均满足
+type deadlineConn interface {
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+}
+
+type connTimeout struct {
+	// 通过读deadline检测超时的链接，reactor模式下为空
+	conn deadlineConn
+
+	// time.Duration，为0表示不开启
+	read, write, idle int64
+	// 最后一次读取到数据的时间以及最后一次读写的时间(UnixNano)
+	lastRead, lastIO int64
+	// 是否设置过写deadline，关闭写超时之后需要清除
+	writeDeadline int32
+
+	// 保证读deadline按照计算的先后顺序设置
+	lock sync.Mutex
+}
+
+func (t *connTimeout) init(conn deadlineConn) {
+	t.conn = conn
+	t.read = int64(zconf.GlobalObject.ReadTimeoutDuration())
+	t.write = int64(zconf.GlobalObject.WriteTimeoutDuration())
+	t.idle = int64(zconf.GlobalObject.IdleTimeoutDuration())
+
+	now := time.Now().UnixNano()
+	t.lastRead, t.lastIO = now, now
+}
+
+// 开始读取数据之前调用，从此时开始计算超时
+func (t *connTimeout) start() {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&t.lastRead, now)
+	atomic.StoreInt64(&t.lastIO, now)
+	t.applyReadDeadline()
+}
+
+func (t *connTimeout) setRead(timeout time.Duration) {
+	atomic.StoreInt64(&t.read, int64(timeout))
+	t.applyReadDeadline()
+}
+
+func (t *connTimeout) setWrite(timeout time.Duration) {
+	atomic.StoreInt64(&t.write, int64(timeout))
+}
+
+func (t *connTimeout) setIdle(timeout time.Duration) {
+	atomic.StoreInt64(&t.idle, int64(timeout))
+	t.applyReadDeadline()
+}
+
+// 读取到数据之后调用
+func (t *connTimeout) onRead() {
+	if atomic.LoadInt64(&t.read) == 0 && atomic.LoadInt64(&t.idle) == 0 {
+		return
+	}
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&t.lastRead, now)
+	atomic.StoreInt64(&t.lastIO, now)
+	t.applyReadDeadline()
+}
+
+// 写出数据之前调用，设置本次写出的deadline
+func (t *connTimeout) beforeWrite(conn deadlineConn) {
+	if write := atomic.LoadInt64(&t.write); write > 0 {
+		atomic.StoreInt32(&t.writeDeadline, 1)
+		_ = conn.SetWriteDeadline(time.Now().Add(time.Duration(write)))
+	} else if atomic.CompareAndSwapInt32(&t.writeDeadline, 1, 0) {
+		// 写超时被关闭，清除之前设置的deadline，否则deadline过后的写操作都会失败
+		_ = conn.SetWriteDeadline(time.Time{})
+	}
+}
+
+// 写出数据之后调用，写操作会推迟空闲超时
+func (t *connTimeout) onWrite() {
+	if atomic.LoadInt64(&t.idle) == 0 {
+		return
+	}
+	atomic.StoreInt64(&t.lastIO, time.Now().UnixNano())
+	t.applyReadDeadline()
+}
+
+// 计算下一次超时的时间，为0表示不会超时
+func (t *connTimeout) deadline() int64 {
+	var deadline int64
+	if read := atomic.LoadInt64(&t.read); read > 0 {
+		deadline = atomic.LoadInt64(&t.lastRead) + read
+	}
+	if idle := atomic.LoadInt64(&t.idle); idle > 0 {
+		if d := atomic.LoadInt64(&t.lastIO) + idle; deadline == 0 || d < deadline {
+			deadline = d
+		}
+	}
+	return deadline
+}
+
+func (t *connTimeout) applyReadDeadline() {
+	if t.conn == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if deadline := t.deadline(); deadline > 0 {
+		_ = t.conn.SetReadDeadline(time.Unix(0, deadline))
+	} else {
+		_ = t.conn.SetReadDeadline(time.Time{})
+	}
+}
+
+// 判断now时链接是否已经超时，返回对应的关闭原因，未超时返回CloseReasonNone
+func (t *connTimeout) expired(now time.Time) ziface.CloseReason {
+	nano := now.UnixNano()
+	if idle := atomic.LoadInt64(&t.idle); idle > 0 && nano >= atomic.LoadInt64(&t.lastIO)+idle {
+		return ziface.CloseReasonIdleTimeout
+	}
+	if read := atomic.LoadInt64(&t.read); read > 0 && nano >= atomic.LoadInt64(&t.lastRead)+read {
+		return ziface.CloseReasonReadTimeout
+	}
+	return ziface.CloseReasonNone
+}
+
+// 判断错误是否由deadline超时引起
+func isTimeoutErr(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// 写出数据失败时链接关闭的原因
+func writeCloseReason(err error) ziface.CloseReason {
+	if isTimeoutErr(err) {
+		return ziface.CloseReasonWriteTimeout
+	}
+	return ziface.CloseReasonWriteError
+}
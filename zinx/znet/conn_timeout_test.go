@@ -0,0 +1,128 @@
+package znet
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zinx_server/zinx/ziface"
+)
+
+func waitConnClosed(t *testing.T, conn ziface.IConnection, timeout time.Duration) ziface.CloseReason {
+	select {
+	case <-conn.Context().Done():
+	case <-time.After(timeout):
+		t.Fatal("connection is not closed")
+	}
+	reason, _ := conn.GetCloseReason()
+	return reason
+}
+
+func TestConnReadTimeout(t *testing.T) {
+	s := NewServer()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	// 不需要心跳检测也可以清理不再发送数据的链接
+	c := newServerConn(s, serverConn, 1, "pipe")
+	c.SetReadTimeout(50 * time.Millisecond)
+	go c.Start()
+
+	start := time.Now()
+	assert.Equal(t, ziface.CloseReasonReadTimeout, waitConnClosed(t, c, time.Second))
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestConnIdleTimeout(t *testing.T) {
+	s := NewServer()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		_, _ = io.Copy(io.Discard, clientConn)
+	}()
+
+	c := newServerConn(s, serverConn, 1, "pipe")
+	c.SetIdleTimeout(100 * time.Millisecond)
+	go c.Start()
+
+	// 持续写出数据时链接不会空闲超时
+	for i := 0; i < 6; i++ {
+		time.Sleep(40 * time.Millisecond)
+		assert.Nil(t, c.SendMsg(1, []byte("ping")))
+	}
+	assert.Nil(t, c.Context().Err())
+
+	assert.Equal(t, ziface.CloseReasonIdleTimeout, waitConnClosed(t, c, time.Second))
+}
+
+func TestConnWriteTimeout(t *testing.T) {
+	s := NewServer()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	// 对端不读取数据，写操作一直阻塞
+	c := newServerConn(s, serverConn, 1, "pipe")
+	c.SetWriteTimeout(50 * time.Millisecond)
+	go c.Start()
+
+	assert.NotNil(t, c.SendMsg(1, []byte("ping")))
+	assert.Equal(t, ziface.CloseReasonWriteTimeout, waitConnClosed(t, c, time.Second))
+
+	// 缓冲发送同样受写超时限制
+	serverConn, clientConn = net.Pipe()
+	defer clientConn.Close()
+	c = newServerConn(s, serverConn, 2, "pipe")
+	c.SetWriteTimeout(50 * time.Millisecond)
+	go c.Start()
+
+	assert.Nil(t, c.SendBuffMsg(1, []byte("ping")))
+	assert.Equal(t, ziface.CloseReasonWriteTimeout, waitConnClosed(t, c, time.Second))
+}
+
+func TestConnWriteTimeoutDisable(t *testing.T) {
+	s := NewServer()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		_, _ = io.Copy(io.Discard, clientConn)
+	}()
+
+	c := newServerConn(s, serverConn, 1, "pipe")
+	c.SetWriteTimeout(50 * time.Millisecond)
+	go c.Start()
+	defer c.Stop()
+	assert.Nil(t, c.SendMsg(1, []byte("ping")))
+
+	// 关闭写超时之后，之前设置的deadline不再生效
+	c.SetWriteTimeout(0)
+	time.Sleep(80 * time.Millisecond)
+	assert.Nil(t, c.SendMsg(1, []byte("ping")))
+	assert.Nil(t, c.Context().Err())
+}
+
+func TestWebsocketWriteTimeout(t *testing.T) {
+	s := NewServer()
+	started := make(chan ziface.IConnection, 1)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	httpServer := httptest.NewServer(s.WebsocketHandler())
+	defer httpServer.Close()
+	defer s.Stop()
+
+	// 对端不读取数据，socket缓冲区写满之后SendMsg同样受写超时限制
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	serverConn := <-started
+	serverConn.SetWriteTimeout(50 * time.Millisecond)
+
+	data := make([]byte, 64*1024)
+	for i := 0; i < 1024 && err == nil; i++ {
+		err = serverConn.SendMsg(1, data)
+	}
+	assert.NotNil(t, err)
+	assert.Equal(t, ziface.CloseReasonWriteTimeout, waitConnClosed(t, serverConn, time.Second))
+}
@@ -2,10 +2,12 @@ package znet
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
+	"io"
 	"net"
 	"strconv"
 	"sync"
@@ -15,6 +17,7 @@ import (
 	"zinx_server/zinx/zinterceptor"
 	"zinx_server/zinx/zlog"
 	"zinx_server/zinx/zpack"
+	"zinx_server/zinx/zutils"
 )
 
 /*
@@ -37,16 +40,14 @@ type Connection struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	//有缓冲管道，用于读写Goroutine之间的消息通信
-	msgBuffChan chan []byte
+	//有缓冲发送队列，用于读写Goroutine之间的消息通信
+	sendQueue *sendQueue
 
 	//用户收发消息的Lock
 	msgLock sync.RWMutex
 
 	//链接属性集合
-	property map[string]interface{}
-	//保护链接属性的锁
-	propertyLock sync.RWMutex
+	property connProperty
 
 	//当前的链接状态
 	isClosed bool
@@ -58,6 +59,16 @@ type Connection struct {
 	onConnStart func(conn ziface.IConnection)
 	//当前连接断开时的Hook函数
 	onConnStop func(conn ziface.IConnection)
+	//当前连接即将关闭时的Hook函数
+	onConnBeforeClose func(conn ziface.IConnection)
+	//当前连接从ConnManager中移除后的Hook函数
+	onConnRemoved func(conn ziface.IConnection)
+
+	//链接关闭的原因，只记录第一次停止时的原因
+	closeLock   sync.Mutex
+	closing     bool
+	closeReason ziface.CloseReason
+	closeErr    error
 
 	// Data packet packaging method
 	// (数据报文封包方式)
@@ -66,11 +77,19 @@ type Connection struct {
 	// Framedecoder for solving fragmentation and packet sticking problems
 	// (断粘包解码器)
 	frameDecoder ziface.IFrameDecoder
+	// 复用的解码结果切片，只在读取数据的goroutine中使用
+	frames [][]byte
 
 	// 最后一次活动时间
 	lastActivityTime time.Time
 	// 心跳检测器
 	hc ziface.IHeartbeatChecker
+	// 会话管理器，未开启会话层时为空
+	sessionMgr *SessionManager
+	// 读/写/空闲超时
+	timeout connTimeout
+	// 流量统计
+	stats connStats
 
 	// 链接名称，默认与创建链接的Server/Client的Name一致
 	name string
@@ -80,22 +99,40 @@ type Connection struct {
 
 	// 当前链接的远程地址
 	remoteAddr string
+
+	// 接收该链接的监听器名称，客户端链接为空
+	listenerName string
+
+	// reactor模式下负责读取该链接的reactor，为空则使用读goroutine
+	reactor      *reactor
+	reactorEntry *reactorEntry
+	stopOnce     sync.Once
+	// reactor模式下链接的注册与释放互斥，链接可能在注册过程中被并发关闭(如Server.Shutdown)
+	reactorLock     sync.Mutex
+	reactorStarted  bool
+	reactorReleased bool
+	// reactor模式下worker任务队列已满时积压的请求，积压期间暂停读取该链接
+	backlogLock sync.Mutex
+	backlog     []ziface.IRequest
+	backlogging bool
 }
 
 // 创建一个Server服务端特性的连接的方法
-func newServerConn(server ziface.IServer, conn net.Conn, connID uint64) *Connection {
+func newServerConn(server ziface.IServer, conn net.Conn, connID uint64, listenerName string) *Connection {
 	c := &Connection{
-		conn:        conn,
-		connID:      connID,
-		connIdStr:   strconv.FormatUint(connID, 10),
-		isClosed:    false,
-		msgBuffChan: nil,
-		property:    nil,
-		name:        server.ServerName(),
-		localAddr:   conn.LocalAddr().String(),
-		remoteAddr:  conn.RemoteAddr().String(),
+		conn:         conn,
+		connID:       connID,
+		connIdStr:    strconv.FormatUint(connID, 10),
+		isClosed:     false,
+		name:         server.ServerName(),
+		localAddr:    conn.LocalAddr().String(),
+		remoteAddr:   conn.RemoteAddr().String(),
+		listenerName: listenerName,
 	}
 
+	// 在创建时即生成ctx，使得链接在Start之前也可以被安全地Stop
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
 	lengthField := server.GetLengthField()
 	if lengthField != nil {
 		c.frameDecoder = zinterceptor.NewFrameDecoder(*lengthField)
@@ -105,8 +142,18 @@ func newServerConn(server ziface.IServer, conn net.Conn, connID uint64) *Connect
 	c.packet = server.GetPacket()
 	c.onConnStart = server.GetOnConnStart()
 	c.onConnStop = server.GetOnConnStop()
+	c.onConnBeforeClose = server.GetOnConnBeforeClose()
+	c.onConnRemoved = server.GetOnConnRemoved()
+	if mgr, ok := server.GetSessionMgr().(*SessionManager); ok {
+		c.sessionMgr = mgr
+	}
 	c.msgHandler = server.GetMsgHandler()
 
+	c.sendQueue = newSendQueue(c)
+	c.timeout.init(conn)
+	c.stats.init()
+	c.sendQueue.onWatermark = server.GetOnSendQueueWatermark()
+
 	//将当前的Conn与Server的ConnManager绑定
 	c.connManager = server.GetConnMgr()
 
@@ -119,17 +166,17 @@ func newServerConn(server ziface.IServer, conn net.Conn, connID uint64) *Connect
 // 创建一个Client服务端特性的连接的方法
 func newClientConn(client ziface.IClient, conn net.Conn) ziface.IConnection {
 	c := &Connection{
-		conn:        conn,
-		connID:      0,  // client ignore
-		connIdStr:   "", // client ignore
-		isClosed:    false,
-		msgBuffChan: nil,
-		property:    nil,
-		name:        client.GetName(),
-		localAddr:   conn.LocalAddr().String(),
-		remoteAddr:  conn.RemoteAddr().String(),
+		conn:       conn,
+		connID:     0,  // client ignore
+		connIdStr:  "", // client ignore
+		isClosed:   false,
+		name:       client.GetName(),
+		localAddr:  conn.LocalAddr().String(),
+		remoteAddr: conn.RemoteAddr().String(),
 	}
 
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
 	lengthField := client.GetLengthField()
 	if lengthField != nil {
 		c.frameDecoder = zinterceptor.NewFrameDecoder(*lengthField)
@@ -140,6 +187,10 @@ func newClientConn(client ziface.IClient, conn net.Conn) ziface.IConnection {
 	c.onConnStop = client.GetOnConnStop()
 	c.msgHandler = client.GetMsgHandler()
 
+	c.sendQueue = newSendQueue(c)
+	c.timeout.init(conn)
+	c.stats.init()
+
 	return c
 }
 
@@ -151,52 +202,109 @@ func (c *Connection) StartReader() {
 	defer func() {
 		if err := recover(); err != nil {
 			zlog.Ins().ErrorF("connID=%d, panic err=%v", c.GetConnID(), err)
+			c.StopWithReason(ziface.CloseReasonPanic, fmt.Errorf("%v", err))
 		}
 	}()
 
+	// 读缓冲区在整个链接期间复用，handleData不会持有其中的数据
+	buffer := zutils.GetBuffer(int(zconf.GlobalObject.IOReadBuffSize))
+	defer zutils.PutBuffer(buffer)
+
+	c.timeout.start()
 	for {
 		select {
 		case <-c.ctx.Done():
 			return
 		default:
-			buffer := make([]byte, zconf.GlobalObject.IOReadBuffSize)
-
 			// 从conn的IO中读取数据到内存缓存buffer中
 			n, err := c.conn.Read(buffer)
+			if err != nil && isTimeoutErr(err) {
+				reason := c.timeout.expired(time.Now())
+				if reason == ziface.CloseReasonNone {
+					// 读deadline已被之后的读写推迟
+					c.timeout.applyReadDeadline()
+					continue
+				}
+				zlog.Ins().ErrorF("connID=%d %s, close it", c.connID, reason)
+				c.StopWithReason(reason, err)
+				return
+			}
 			if err != nil {
 				zlog.Ins().ErrorF("read msg head [read datalen=%d], error = %s", n, err)
+				c.StopWithReason(readCloseReason(err), err)
 				return
 			}
-			zlog.Ins().DebugF("read buffer %s \n", hex.EncodeToString(buffer[0:n]))
-			//zlog.Ins().DebugF("read buffer %s \n", string(buffer[0:n]))
-			// 正常读取到对端数据，更新心跳检测Active状态
-			if n > 0 && c.hc != nil {
-				c.updateActivity()
+			c.timeout.onRead()
+			c.stats.onRead(n)
+			if err = c.handleData(buffer[0:n]); err != nil {
+				c.StopWithReason(decodeCloseReason(err), err)
+				return
 			}
+		}
+	}
+}
 
-			// 处理自定义协议断粘包问题
-			if c.frameDecoder != nil {
-				// 为读取到的0-n个字节的数据进行解码
-				bufArrays := c.frameDecoder.Decode(buffer[0:n])
-				if bufArrays == nil {
-					continue
-				}
-				for _, bytes := range bufArrays {
-					msg := zpack.NewMessage(uint32(len(bytes)), bytes)
-					zlog.Ins().DebugF("[Server read msg] %v \n", msg)
-					// 得到当前客户端请求的Request数据
-					req := NewRequest(c, msg)
-					c.msgHandler.Execute(req)
-				}
-			} else {
-				msg := zpack.NewMessage(uint32(n), buffer[0:n])
-				zlog.Ins().DebugF("[Server read msg] %v \n", msg)
-				// 得到当前客户端请求的Request数据
-				req := NewRequest(c, msg)
-				c.msgHandler.Execute(req)
+// 收到的数据包超过MaxPacketSize
+var ErrPacketTooLarge = errors.New("received packet exceeds MaxPacketSize")
+
+// 根据读取数据时的错误判断链接关闭的原因
+func readCloseReason(err error) ziface.CloseReason {
+	if errors.Is(err, io.EOF) {
+		return ziface.CloseReasonRemoteClosed
+	}
+	return ziface.CloseReasonReadError
+}
+
+// 校验解码出的数据包长度，数据部分不能超过MaxPacketSize
+func checkPacketSize(packet ziface.IDataPack, frame []byte) error {
+	maxSize := zconf.GlobalObject.MaxPacketSize
+	if maxSize == 0 || packet == nil {
+		return nil
+	}
+	if size := len(frame) - int(packet.GetHeadLen()); size > int(maxSize) {
+		return fmt.Errorf("%w: %d > %d", ErrPacketTooLarge, size, maxSize)
+	}
+	return nil
+}
+
+// 处理从链接中读取到的数据，解码后投递给worker工作池
+// data只在调用期间有效，调用方可以复用data所在的缓冲区
+// 返回错误表示收到了无法解码或者超过MaxPacketSize的数据包，需要关闭链接
+func (c *Connection) handleData(data []byte) error {
+	if zlog.DebugEnabled() {
+		zlog.Ins().DebugF("read buffer %s \n", hex.EncodeToString(data))
+	}
+	// 正常读取到对端数据，更新心跳检测Active状态
+	if len(data) > 0 && c.hc != nil {
+		c.updateActivity()
+	}
+
+	// 处理自定义协议断粘包问题
+	if c.frameDecoder != nil {
+		// 为读取到的0-n个字节的数据进行解码
+		frames, err := decodeFrames(c.frameDecoder, c.frames[:0], data)
+		c.frames = frames
+		if err != nil {
+			c.stats.onDecodeError()
+			return err
+		}
+		for _, frame := range c.frames {
+			if err := checkPacketSize(c.packet, frame); err != nil {
+				c.stats.onDecodeError()
+				return err
 			}
+			// 得到当前客户端请求的Request数据
+			c.stats.onMsgIn()
+			req := newReadRequest(c, frame)
+			c.msgHandler.Execute(req)
 		}
+	} else {
+		// 得到当前客户端请求的Request数据
+		c.stats.onMsgIn()
+		req := newReadRequest(c, data)
+		c.msgHandler.Execute(req)
 	}
+	return nil
 }
 
 // 链接的写业务方法
@@ -205,24 +313,56 @@ func (c *Connection) StartWriter() {
 	zlog.Ins().InfoF("Writer Goroutine is running")
 	defer zlog.Ins().InfoF("%s [conn Writer exit!]", c.RemoteAddr().String())
 
-	//不断阻塞等待channel消息，进行写给客户端
-	for {
-		select {
-		case data, ok := <-c.msgBuffChan:
-			if ok {
-				//有数据要写给客户端
-				if _, err := c.conn.Write(data); err != nil {
-					zlog.Ins().ErrorF("Send Buff Data error:, %s Conn Writer exit", err)
-					return
-				}
-			} else {
-				fmt.Println("msgBuffChan is Closed")
-				break
+	//不断阻塞等待队列中的消息，合并写给客户端
+	if err := c.sendQueue.writeLoop(c.ctx, c.writeBatch); err != nil && c.ctx.Err() == nil {
+		zlog.Ins().ErrorF("Send Buff Data error:, %s Conn Writer exit", err)
+		// 写出失败的链接已经不可用
+		c.StopWithReason(writeCloseReason(err), err)
+	}
+}
+
+// 合并写出一批消息
+func (c *Connection) writeBatch(batch [][]byte) error {
+	c.timeout.beforeWrite(c.conn)
+	err := c.writeBuffers(batch)
+	if err == nil {
+		c.timeout.onWrite()
+		c.stats.onWriteBatch(batch)
+	}
+	return err
+}
+
+// tcp/unix链接使用writev一次写出，udp链接需要保持每条消息的边界逐条写出，其余链接(TLS/KCP等)拼接后一次写出
+func (c *Connection) writeBuffers(batch [][]byte) error {
+	if len(batch) == 1 {
+		_, err := c.conn.Write(batch[0])
+		return err
+	}
+
+	switch c.conn.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		buffers := net.Buffers(batch)
+		_, err := buffers.WriteTo(c.conn)
+		return err
+	case *net.UDPConn, *udpPeerConn:
+		for _, data := range batch {
+			if _, err := c.conn.Write(data); err != nil {
+				return err
 			}
-		case <-c.ctx.Done():
-			//代表Reader已经退出，此时Writer也要退出
-			return
 		}
+		return nil
+	default:
+		size := 0
+		for _, data := range batch {
+			size += len(data)
+		}
+		buf := zutils.GetBuffer(size)[:0]
+		for _, data := range batch {
+			buf = append(buf, data...)
+		}
+		_, err := c.conn.Write(buf)
+		zutils.PutBuffer(buf)
+		return err
 	}
 }
 
@@ -233,11 +373,26 @@ func (c *Connection) Start() {
 			zlog.Ins().ErrorF("Connection Start() error: %v", err)
 		}
 	}()
-	c.ctx, c.cancel = context.WithCancel(context.Background())
+	// TLS链接先完成握手，校验客户端证书
+	if err := tlsHandshake(c.ctx, c.conn); err != nil {
+		zlog.Ins().ErrorF("%s tls handshake err: %v", c.remoteAddr, err)
+		c.closeBeforeStart(err)
+		return
+	}
+
+	// 开启会话层时先创建会话，OnConnStart中即可获取到
+	if c.sessionMgr != nil {
+		c.sessionMgr.onConnStart(c)
+	}
 
 	// 按照用户传递进来的 创建连接时需要处理的业务，执行hook方法
 	c.callOnConnStart()
 
+	if c.reactor != nil {
+		c.startWithReactor()
+		return
+	}
+
 	// 启动心跳检测
 	if c.hc != nil {
 		c.hc.Start()
@@ -260,9 +415,88 @@ func (c *Connection) Start() {
 	}
 }
 
+// reactor模式下启动链接，由reactor负责读取数据以及心跳检测，不占用goroutine
+func (c *Connection) startWithReactor() {
+	c.reactorLock.Lock()
+	// 注册之前链接已经被关闭
+	if c.reactorReleased {
+		c.reactorLock.Unlock()
+		return
+	}
+
+	if c.hc != nil {
+		if _, ok := c.hc.(reactorHeartbeat); !ok {
+			c.hc.Start()
+		}
+		c.updateActivity()
+	}
+
+	c.workerID = useWorker(c)
+	c.reactorStarted = true
+
+	// reactor模式下不使用读deadline，由reactor定时检查读超时和空闲超时
+	c.timeout.conn = nil
+	c.timeout.start()
+
+	err := c.reactor.add(c)
+	c.reactorLock.Unlock()
+	if err != nil {
+		zlog.Ins().ErrorF("%s add to reactor err: %v", c.remoteAddr, err)
+		c.Stop()
+	}
+}
+
 // 停止链接 结束当前链接的工作
 func (c *Connection) Stop() {
+	c.StopWithReason(ziface.CloseReasonStop, nil)
+}
+
+// 以指定的原因停止链接，只有第一次调用时的原因会被记录
+// 第一次调用时先执行OnConnBeforeClose，此时链接仍可以发送消息，之后再通知读写goroutine退出
+func (c *Connection) StopWithReason(reason ziface.CloseReason, err error) {
+	if !c.setCloseReason(reason, err) {
+		return
+	}
+	c.callOnConnBeforeClose()
+
 	c.cancel()
+
+	// reactor模式下没有等待ctx的goroutine，直接释放链接
+	if c.reactor != nil {
+		c.stopOnce.Do(func() {
+			c.reactorLock.Lock()
+			c.reactorReleased = true
+			started := c.reactorStarted
+			c.reactor.remove(c)
+			c.reactorLock.Unlock()
+
+			c.finalizer()
+			if started {
+				freeWorker(c)
+			}
+		})
+	}
+}
+
+// 记录关闭原因，返回false表示链接已经在停止中
+func (c *Connection) setCloseReason(reason ziface.CloseReason, err error) bool {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+
+	if c.closing {
+		return false
+	}
+	c.closing = true
+	c.closeReason, c.closeErr = reason, err
+	return true
+}
+
+// 获取链接关闭的原因以及导致关闭的错误
+func (c *Connection) GetCloseReason() (ziface.CloseReason, error) {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+
+	return c.closeReason, c.closeErr
 }
 
 // 获取当前链接的绑定socket conn
@@ -315,51 +549,36 @@ func (c *Connection) LocalAddrString() string {
 
 func (c *Connection) Send(data []byte) error {
 	c.msgLock.RLock()
-	defer c.msgLock.RUnlock()
-
 	if c.isClosed == true {
+		c.msgLock.RUnlock()
 		return errors.New("connection closed when send msg")
 	}
 
-	_, err := c.conn.Write(data)
+	c.timeout.beforeWrite(c.conn)
+	n, err := c.conn.Write(data)
+	c.msgLock.RUnlock()
+
 	if err != nil {
 		zlog.Ins().ErrorF("SendMsg err data = %+v, err = %+v", data, err)
+		if isTimeoutErr(err) {
+			// 写超时的链接中可能残留了不完整的数据包，已经不可用
+			c.StopWithReason(ziface.CloseReasonWriteTimeout, err)
+		}
 		return err
 	}
+	c.timeout.onWrite()
+	c.stats.onWrite(n, 1)
 
 	return nil
 }
 
 func (c *Connection) SendToQueue(data []byte) error {
-	c.msgLock.RLock()
-	defer c.msgLock.RUnlock()
-
-	if c.msgBuffChan == nil {
-		c.msgBuffChan = make(chan []byte, zconf.GlobalObject.MaxMsgChanLen)
-		// 开启用于写回客户端数据流程的Goroutine
-		// 此方法只读取MsgBuffChan中的数据没调用SendBuffMsg可以分配内存和启用协程
-		go c.StartWriter()
-	}
-
-	idleTimeout := time.NewTimer(5 * time.Millisecond)
-	defer idleTimeout.Stop()
-
-	if c.isClosed == true {
-		return errors.New("connection closed when send buff msg")
-	}
-
 	if data == nil {
 		zlog.Ins().ErrorF("Pack data is nil")
 		return errors.New("pack data is nil")
 	}
 
-	// Send timeout
-	select {
-	case <-idleTimeout.C:
-		return errors.New("send buff msg timeout")
-	case c.msgBuffChan <- data:
-		return nil
-	}
+	return c.pushSendQueue(context.Background(), data, ziface.SendPriorityNormal)
 }
 
 // 提供一个SendMsg方法 将我们要发送给客户端的数据，先进行封包，再发送
@@ -368,11 +587,14 @@ func (c *Connection) SendMsg(msgId uint32, data []byte) error {
 		return errors.New("connection closed when send msg")
 	}
 	// Pack data and send it
-	msg, err := c.packet.Pack(zpack.NewMsgPackage(msgId, data))
+	msg, pooled, err := packMsg(c.packet, msgId, data)
 	if err != nil {
 		zlog.Ins().ErrorF("Pack error msg ID = %d", msgId)
 		return errors.New("Pack error msg ")
 	}
+	if pooled {
+		defer zutils.PutBuffer(msg)
+	}
 
 	err = c.Send(msg)
 	if err != nil {
@@ -383,55 +605,128 @@ func (c *Connection) SendMsg(msgId uint32, data []byte) error {
 	return nil
 }
 
+// 直接发送携带请求ID的消息
+func (c *Connection) SendMsgWithRequestID(msgId uint32, requestID uint32, data []byte) error {
+	msg, err := packRequestIDMsg(c.packet, msgId, requestID, data)
+	if err != nil {
+		return err
+	}
+	defer zutils.PutBuffer(msg)
+
+	return c.Send(msg)
+}
+
 // 提供一个SendMsg方法 将我们要发送给客户端的数据，先进行封包，再发送(有缓冲)
 func (c *Connection) SendBuffMsg(msgId uint32, data []byte) error {
-	if c.isClosed == true {
-		return errors.New("connection closed when send buff msg")
-	}
-	if c.msgBuffChan == nil {
-		c.msgBuffChan = make(chan []byte, zconf.GlobalObject.MaxMsgChanLen)
-		// 开启用于写回客户端数据流程的Goroutine
-		// 此方法只读取MsgBuffChan中的数据没调用SendBuffMsg可以分配内存和启用协程
-		go c.StartWriter()
-	}
+	return c.SendBuffMsgContext(context.Background(), msgId, data)
+}
+
+// 有缓冲发送，队列已满时按照链接的溢出策略处理，block/timeout策略下最多等待到ctx结束
+func (c *Connection) SendBuffMsgContext(ctx context.Context, msgId uint32, data []byte) error {
+	return c.sendBuffMsg(ctx, msgId, data, ziface.SendPriorityNormal)
+}
 
-	idleTimeout := time.NewTimer(5 * time.Millisecond)
-	defer idleTimeout.Stop()
+// 按优先级有缓冲发送，写goroutine总是先写出高优先级通道中的消息
+func (c *Connection) SendBuffMsgWithPriority(msgId uint32, data []byte, priority ziface.SendPriority) error {
+	return c.sendBuffMsg(context.Background(), msgId, data, priority)
+}
 
+// 链接是否已关闭由pushSendQueue在msgLock读锁内判断，高水位回调等场景下可能与链接释放并发调用
+func (c *Connection) sendBuffMsg(ctx context.Context, msgId uint32, data []byte, priority ziface.SendPriority) error {
 	msg, err := c.packet.Pack(zpack.NewMsgPackage(msgId, data))
 	if err != nil {
 		zlog.Ins().ErrorF("Pack error msg ID = %d", msgId)
 		return errors.New("Pack error msg ")
 	}
 
-	// send timeout
-	select {
-	case <-idleTimeout.C:
-		return errors.New("send buff msg timeout")
-	case c.msgBuffChan <- msg:
-		return nil
+	return c.pushSendQueue(ctx, msg, priority)
+}
+
+// 放入缓冲发送队列，首次使用时创建队列并启动写goroutine
+func (c *Connection) pushSendQueue(ctx context.Context, data []byte, priority ziface.SendPriority) error {
+	c.msgLock.RLock()
+	if c.isClosed == true {
+		c.msgLock.RUnlock()
+		return ErrSendQueueClosed
 	}
+	if c.sendQueue.init() {
+		// 开启用于写回客户端数据流程的Goroutine
+		// 没有调用过SendBuffMsg的链接不会分配队列内存和启用协程
+		go c.StartWriter()
+	}
+	disconnect, overHigh, err := c.sendQueue.push(ctx, c.ctx, data, priority)
+	c.msgLock.RUnlock()
+
+	// 关闭链接需要获取msgLock写锁，高水位回调中也可能再次发送或关闭链接，均在释放读锁之后进行
+	if overHigh {
+		c.sendQueue.notifyHigh()
+	}
+	if disconnect {
+		c.StopWithReason(ziface.CloseReasonSlowConsumer, err)
+	}
+	return err
 }
 
-// 设置链接属性
-func (c *Connection) SetProperty(key string, value interface{}) {
-	c.propertyLock.Lock()
-	defer c.propertyLock.Unlock()
+// 等待调用之前通过SendBuffMsg/SendToQueue放入队列的消息全部写出
+func (c *Connection) Flush() error {
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
 
-	//添加一个链接属性
-	if c.property == nil {
-		c.property = make(map[string]interface{})
+	if c.isClosed == true {
+		return ErrSendQueueClosed
 	}
+	if c.sendQueue.init() {
+		go c.StartWriter()
+	}
+	return c.sendQueue.flush(c.ctx)
+}
 
-	c.property[key] = value
+// 设置缓冲发送队列已满时的处理策略
+func (c *Connection) SetSendQueuePolicy(policy string) error {
+	return c.sendQueue.setPolicy(policy)
+}
+
+// 设置缓冲发送队列的高/低水位线以及回调
+func (c *Connection) SetSendQueueWatermark(high, low int, callback func(conn ziface.IConnection, overHigh bool)) {
+	c.sendQueue.setWatermark(high, low, callback)
+}
+
+// 缓冲发送队列中尚未写出的消息数量
+func (c *Connection) GetSendQueueLen() int {
+	return c.sendQueue.depth()
+}
+
+// 缓冲发送队列的容量
+func (c *Connection) GetSendQueueCap() int {
+	return c.sendQueue.capacity()
+}
+
+// 缓冲发送队列各优先级通道的统计
+func (c *Connection) GetSendQueueStats() []ziface.SendLaneStats {
+	return c.sendQueue.stats()
+}
+
+// 获取链接的流量统计
+func (c *Connection) GetStats() ziface.ConnStats {
+	stats := c.stats.snapshot()
+	stats.SendDropped = sendQueueDropped(c.sendQueue)
+	stats.QueueLen = c.sendQueue.depth()
+	return stats
+}
+
+// 设置链接属性
+func (c *Connection) SetProperty(key string, value interface{}) {
+	c.property.set(c, key, value, 0)
+}
+
+// 设置带有效期的链接属性
+func (c *Connection) SetPropertyWithTTL(key string, value interface{}, ttl time.Duration) {
+	c.property.set(c, key, value, ttl)
 }
 
 // 获取链接属性
 func (c *Connection) GetProperty(key string) (interface{}, error) {
-	c.propertyLock.RLock()
-	defer c.propertyLock.RUnlock()
-
-	if value, ok := c.property[key]; ok {
+	if value, ok := c.property.get(key); ok {
 		return value, nil
 	}
 
@@ -440,11 +735,12 @@ func (c *Connection) GetProperty(key string) (interface{}, error) {
 
 // 移除链接属性
 func (c *Connection) RemoveProperty(key string) {
-	c.propertyLock.Lock()
-	defer c.propertyLock.Unlock()
+	c.property.remove(c, key)
+}
 
-	//删除属性
-	delete(c.property, key)
+// 添加链接属性变化的Hook函数
+func (c *Connection) AddPropertyChangeHook(hook ziface.PropertyChangeHook) {
+	c.property.addHook(hook)
 }
 
 // 调用onConnStart Hook函数
@@ -455,6 +751,32 @@ func (c *Connection) callOnConnStart() {
 	}
 }
 
+// 拷贝当前的链接属性，会话在链接之间迁移时使用
+func (c *Connection) snapshotProperties() map[string]propertyValue {
+	return c.property.snapshot()
+}
+
+// 恢复会话保存的链接属性
+func (c *Connection) restoreProperties(properties map[string]propertyValue) {
+	c.property.restore(c, properties)
+}
+
+// 调用onConnBeforeClose Hook函数
+func (c *Connection) callOnConnBeforeClose() {
+	if c.onConnBeforeClose != nil {
+		zlog.Ins().InfoF("ZINX CallOnConnBeforeClose....")
+		c.onConnBeforeClose(c)
+	}
+}
+
+// 调用onConnRemoved Hook函数
+func (c *Connection) callOnConnRemoved() {
+	if c.onConnRemoved != nil {
+		zlog.Ins().InfoF("ZINX CallOnConnRemoved....")
+		c.onConnRemoved(c)
+	}
+}
+
 // 调用onConnStop Hook函数
 func (c *Connection) callOnConnStop() {
 	if c.onConnStop != nil {
@@ -483,15 +805,41 @@ func (c *Connection) SetHeartBeat(checker ziface.IHeartbeatChecker) {
 	c.hc = checker
 }
 
+// 设置读超时
+func (c *Connection) SetReadTimeout(timeout time.Duration) {
+	c.timeout.setRead(timeout)
+}
+
+// 设置写超时
+func (c *Connection) SetWriteTimeout(timeout time.Duration) {
+	c.timeout.setWrite(timeout)
+}
+
+// 设置空闲超时
+func (c *Connection) SetIdleTimeout(timeout time.Duration) {
+	c.timeout.setIdle(timeout)
+}
+
 func (c *Connection) finalizer() {
 	// 如果用户注册了该链接， 那么这里直接调用关闭回调业务
 	c.callOnConnStop()
 
+	if c.sessionMgr != nil {
+		c.sessionMgr.onConnStop(c)
+	}
+
+	if c.release() {
+		c.callOnConnRemoved()
+	}
+}
+
+// 关闭socket并从ConnManager中移除，返回false表示链接已经被释放过
+func (c *Connection) release() bool {
 	c.msgLock.Lock()
 	defer c.msgLock.Unlock()
 
 	if c.isClosed == true {
-		return
+		return false
 	}
 
 	if c.hc != nil {
@@ -504,16 +852,69 @@ func (c *Connection) finalizer() {
 		c.connManager.Remove(c)
 	}
 
-	if c.msgBuffChan != nil {
-		close(c.msgBuffChan)
-	}
+	c.sendQueue.close()
+	c.property.stopTimers()
 
 	c.isClosed = true
 
-	zlog.Ins().InfoF("Conn Stop()...ConnID = %d", c.connID)
+	zlog.Ins().InfoF("Conn Stop()...ConnID = %d, reason = %s", c.connID, c.closeReason)
+	return true
+}
+
+// 链接未能成功启动时关闭链接，不调用OnConnStart/OnConnStop
+func (c *Connection) closeBeforeStart(err error) {
+	c.setCloseReason(ziface.CloseReasonHandshakeFailed, err)
+	c.cancel()
+
+	c.msgLock.Lock()
+	defer c.msgLock.Unlock()
 
+	_ = c.conn.Close()
+	if c.connManager != nil {
+		c.connManager.Remove(c)
+	}
+	c.isClosed = true
+}
+
+// 缓冲发送队列中尚未写出的消息数量(包括已取出正在写的消息)
+func (c *Connection) pendingSendCount() int {
+	return c.sendQueue.depth()
+}
+
+// 获取接收该链接的监听器名称
+func (c *Connection) GetListenerName() string {
+	return c.listenerName
+}
+
+// 获取TLS链接中已通过校验的对端证书
+func (c *Connection) GetPeerCertificate() *x509.Certificate {
+	return peerCertificate(c.conn)
 }
 
 func (c *Connection) Context() context.Context {
 	return c.ctx
 }
+
+// 封包，封包方式支持ziface.IDataPackAppender时使用缓冲池，pooled为true时需要在使用完毕后调用zutils.PutBuffer归还
+func packMsg(packet ziface.IDataPack, msgID uint32, data []byte) (msg []byte, pooled bool, err error) {
+	if appender, ok := packet.(ziface.IDataPackAppender); ok {
+		buf := zutils.GetBuffer(int(packet.GetHeadLen()) + len(data))
+		return appender.AppendPack(buf[:0], msgID, data), true, nil
+	}
+
+	msg, err = packet.Pack(zpack.NewMsgPackage(msgID, data))
+	return msg, false, err
+}
+
+// 链接的封包方式不支持携带请求ID
+var ErrRequestIDNotSupported = errors.New("data pack does not support request id")
+
+// 携带请求ID封包，返回的缓冲区使用完毕后需要调用zutils.PutBuffer归还
+func packRequestIDMsg(packet ziface.IDataPack, msgID uint32, requestID uint32, data []byte) ([]byte, error) {
+	pack, ok := packet.(ziface.IDataPackRequestID)
+	if !ok {
+		return nil, ErrRequestIDNotSupported
+	}
+	buf := zutils.GetBuffer(int(packet.GetHeadLen()) + len(data))
+	return pack.AppendPackWithRequestID(buf[:0], msgID, requestID, data), nil
+}
@@ -3,6 +3,7 @@ package znet
 import (
 	"errors"
 	"strconv"
+	"sync"
 	"zinx_server/zinx/ziface"
 	"zinx_server/zinx/zlog"
 	"zinx_server/zinx/zutils"
@@ -13,6 +14,10 @@ import (
 */
 type ConnManager struct {
 	connections zutils.ShardLockMaps
+
+	// 已经移除的链接的流量统计累计
+	closedLock  sync.Mutex
+	closedStats ziface.ConnMgrStats
 }
 
 // 创建当前链接的方法
@@ -31,8 +36,10 @@ func (connMgr *ConnManager) Add(conn ziface.IConnection) {
 
 // 删除链接
 func (connMgr *ConnManager) Remove(conn ziface.IConnection) {
-	//删除连接信息
-	connMgr.connections.Remove(conn.GetConnIdStr())
+	//删除连接信息，只有第一次移除时累计链接的流量统计
+	if _, ok := connMgr.connections.Pop(conn.GetConnIdStr()); ok {
+		connMgr.addClosedStats(conn.GetStats())
+	}
 	zlog.Ins().InfoF("connection Remove ConnID=%d successfully: conn num = %d", conn.GetConnID(), connMgr.Len())
 }
 
@@ -64,16 +71,16 @@ func (connMgr *ConnManager) Len() int {
 
 // 清除并终止所有链接
 func (connMgr *ConnManager) ClearConn() {
-	cb := func(key string, val interface{}, exists bool) bool {
-		if conn, ok := val.(ziface.IConnection); ok {
-			conn.Stop()
-			return true
-		}
-		return false
-	}
-
 	for item := range connMgr.connections.IterBuffered() {
-		connMgr.connections.RemoveCb(item.Key, cb)
+		// 不能在持有分片锁时关闭链接，reactor模式下链接会同步调用Remove
+		if conn, ok := item.Val.(ziface.IConnection); ok {
+			conn.StopWithReason(ziface.CloseReasonServerStop, nil)
+		}
+		if v, ok := connMgr.connections.Pop(item.Key); ok {
+			if conn, ok := v.(ziface.IConnection); ok {
+				connMgr.addClosedStats(conn.GetStats())
+			}
+		}
 	}
 
 	zlog.Ins().InfoF("Clear All Connections successfully: conn num = %d", connMgr.Len())
@@ -124,3 +131,39 @@ func (connMgr *ConnManager) Range2(cb func(string, ziface.IConnection, interface
 
 	return err
 }
+
+// 获取所有链接的流量统计汇总
+func (connMgr *ConnManager) GetStats() ziface.ConnMgrStats {
+	connMgr.closedLock.Lock()
+	total := connMgr.closedStats
+	connMgr.closedLock.Unlock()
+
+	connMgr.connections.IterCb(func(key string, v interface{}) {
+		conn, ok := v.(ziface.IConnection)
+		if !ok {
+			return
+		}
+		stats := conn.GetStats()
+		total.ConnNum++
+		total.BytesIn += stats.BytesIn
+		total.BytesOut += stats.BytesOut
+		total.MsgIn += stats.MsgIn
+		total.MsgOut += stats.MsgOut
+		total.DecodeErrors += stats.DecodeErrors
+		total.SendDropped += stats.SendDropped
+		total.QueueLen += stats.QueueLen
+	})
+	return total
+}
+
+func (connMgr *ConnManager) addClosedStats(stats ziface.ConnStats) {
+	connMgr.closedLock.Lock()
+	defer connMgr.closedLock.Unlock()
+
+	connMgr.closedStats.BytesIn += stats.BytesIn
+	connMgr.closedStats.BytesOut += stats.BytesOut
+	connMgr.closedStats.MsgIn += stats.MsgIn
+	connMgr.closedStats.MsgOut += stats.MsgOut
+	connMgr.closedStats.DecodeErrors += stats.DecodeErrors
+	connMgr.closedStats.SendDropped += stats.SendDropped
+}
@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 	"zinx_server/zinx/ziface"
-	"zinx_server/zinx/zlog"
 )
 
 const (
@@ -22,12 +21,12 @@ const (
 	用来存放一些RouterSlicesMode下的路由可用的默认中间件
 */
 
-// 接受业务执行上产生的panic并且尝试记录现场信息
+// 接受业务执行上产生的panic并且尝试记录现场信息，交给Server的错误处理函数
 func RouterRecovery(request ziface.IRequest) {
 	defer func() {
 		if err := recover(); err != nil {
 			panicInfo := getInfo(StackBegin)
-			zlog.Ins().ErrorF("MsgId:%d Handler panic: info:%s err:%v", request.GetMsgID(), panicInfo, err)
+			request.SetError(fmt.Errorf("%w: %v info:%s", ErrRouterPanic, err, panicInfo))
 		}
 	}()
 	request.RouterSlicesNext()
@@ -34,7 +34,7 @@ type HeartBeatDefaultRouter struct {
 func NewHeartbeatChecker(interval time.Duration) ziface.IHeartbeatChecker {
 	heartbeat := HeartbeatChecker{
 		interval: interval,
-		quitChan: make(chan bool),
+		quitChan: make(chan bool, 1),
 
 		//均使用默认的心跳消息生成函数和远程连接不存活时的处理方式
 		makeMsg:          makeDefaultMsg,
@@ -62,7 +62,7 @@ func makeDefaultMsg(conn ziface.IConnection) []byte {
 // 默认的心跳检测函数
 func notAliveDefaultFunc(conn ziface.IConnection) {
 	fmt.Printf("Remote connection %s is not alive, stop it", conn.RemoteAddr())
-	conn.Stop()
+	conn.StopWithReason(ziface.CloseReasonHeartbeatTimeout, nil)
 }
 
 // 设置用户自定义的远程连接不存活时的处理方法
@@ -115,7 +115,11 @@ func (h *HeartbeatChecker) Start() {
 // 停止心跳检测
 func (h *HeartbeatChecker) Stop() {
 	fmt.Printf("heartbeat checker stop, connID=%+v", h.conn.GetConnID())
-	h.quitChan <- true
+	// reactor模式下没有开启检测goroutine，不能阻塞
+	select {
+	case h.quitChan <- true:
+	default:
+	}
 }
 
 // 发送心跳报文
@@ -140,7 +144,7 @@ func (h *HeartbeatChecker) BindConn(conn ziface.IConnection) {
 func (h *HeartbeatChecker) Clone() ziface.IHeartbeatChecker {
 	heartbeat := &HeartbeatChecker{
 		interval:         h.interval,
-		quitChan:         make(chan bool),
+		quitChan:         make(chan bool, 1),
 		beatFunc:         h.beatFunc,
 		makeMsg:          h.makeMsg,
 		onRemoteNotAlive: h.onRemoteNotAlive,
@@ -152,6 +156,10 @@ func (h *HeartbeatChecker) Clone() ziface.IHeartbeatChecker {
 	return heartbeat
 }
 
+func (h *HeartbeatChecker) getInterval() time.Duration {
+	return h.interval
+}
+
 func (h *HeartbeatChecker) MsgID() uint32 {
 	return h.msgID
 }
@@ -0,0 +1,23 @@
+package znet
+
+import (
+	"github.com/xtaci/kcp-go"
+	"zinx_server/zinx/zconf"
+)
+
+/*
+	KCP会话参数设置，服务端与客户端共用同一套配置
+*/
+
+// 按照全局配置调整KCP会话的传输参数
+func setKcpSessionOptions(sess *kcp.UDPSession) {
+	sess.SetStreamMode(zconf.GlobalObject.KcpStreamModeValue())
+	sess.SetWindowSize(zconf.GlobalObject.KcpSendWindow, zconf.GlobalObject.KcpRecvWindow)
+	sess.SetNoDelay(
+		zconf.GlobalObject.KcpNoDelayValue(),
+		zconf.GlobalObject.KcpInterval,
+		zconf.GlobalObject.KcpResendValue(),
+		zconf.GlobalObject.KcpNcValue(),
+	)
+	sess.SetACKNoDelay(zconf.GlobalObject.KcpACKNoDelay)
+}
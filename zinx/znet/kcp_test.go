@@ -0,0 +1,68 @@
+package znet
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+)
+
+// 等待Server的所有监听器开启，返回指定UDP/KCP监听器实际绑定的端口
+func listenerUDPPort(t *testing.T, s *Server, name string) int {
+	select {
+	case <-s.listenersReady:
+	case <-time.After(3 * time.Second):
+		t.Fatal("listeners not ready")
+	}
+	s.socketsLock.Lock()
+	defer s.socketsLock.Unlock()
+	return s.sockets[name].(*net.UDPConn).LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestKcpServerAndClient(t *testing.T) {
+	workerPoolSize := zconf.GlobalObject.WorkerPoolSize
+	defer func() { zconf.GlobalObject.WorkerPoolSize = workerPoolSize }()
+
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{{Name: "kcp", Mode: zconf.ServerModeKcp, Host: "127.0.0.1"}}
+	s.AddRouter(1, &poolEchoRouter{})
+	s.Start()
+	defer s.Stop()
+	port := listenerUDPPort(t, s, "kcp")
+
+	router := &pipeClientRouter{replies: make(chan string, 1)}
+	client := NewKcpClient("127.0.0.1", port)
+	client.AddRouter(1, router)
+	client.SetOnConnStart(func(conn ziface.IConnection) {
+		_ = conn.SendMsg(1, []byte("ping over kcp"))
+	})
+	client.Start()
+	defer client.Stop()
+
+	// 消息经过FrameDecoder、MsgHandle和路由处理后返回
+	select {
+	case reply := <-router.replies:
+		assert.Equal(t, "ping over kcp", reply)
+	case <-time.After(3 * time.Second):
+		t.Fatal("kcp reply timeout")
+	}
+	assert.Equal(t, 1, s.GetConnMgr().Len())
+	_ = s.GetConnMgr().Range(func(connID uint64, conn ziface.IConnection, _ interface{}) error {
+		assert.Equal(t, s.Listeners[0].GetName(), conn.GetListenerName())
+		return nil
+	}, nil)
+}
+
+func TestKcpConfigExplicitZero(t *testing.T) {
+	streamMode, nc := zconf.GlobalObject.KcpStreamMode, zconf.GlobalObject.KcpNc
+	defer func() {
+		zconf.GlobalObject.KcpStreamMode, zconf.GlobalObject.KcpNc = streamMode, nc
+	}()
+
+	off, zero := false, 0
+	zconf.UserConfToGlobal(&zconf.Config{KcpStreamMode: &off, KcpNc: &zero})
+	assert.False(t, zconf.GlobalObject.KcpStreamModeValue())
+	assert.Equal(t, 0, zconf.GlobalObject.KcpNcValue())
+}
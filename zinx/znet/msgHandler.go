@@ -2,8 +2,10 @@ package znet
 
 import (
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"zinx_server/zinx/zconf"
 	"zinx_server/zinx/ziface"
 	"zinx_server/zinx/zlog"
@@ -21,7 +23,7 @@ const (
 
 // 对消息的处理回调模块
 type MsgHandle struct {
-	//存放每个MsgID所对应的处理方法
+	//存放每个MsgID所对应的处理方法，读写时使用RouterSlices的锁
 	Apis map[uint32]ziface.IRouter
 	//负责Worker取任务的消息队列
 	TaskQueue []chan ziface.IRequest
@@ -35,6 +37,15 @@ type MsgHandle struct {
 	// 空闲worker集合，用于zconf.WorkerModeBind
 	freeWorkers  map[uint32]struct{}
 	freeWorkerMu sync.Mutex
+
+	// 已投递但尚未处理完成的任务数量
+	inFlight int64
+	// 优雅关闭开始后置为1，不再接收新读取到的消息
+	draining int32
+
+	// 没有绑定路由以及路由处理出错时的处理函数，读写时使用RouterSlices的锁
+	notFoundHandler ziface.NotFoundHandler
+	errorHandler    ziface.ErrorHandler
 }
 
 // 默认必经的数据处理拦截器
@@ -44,16 +55,22 @@ func (mh *MsgHandle) Intercept(chain ziface.IChain) ziface.IcResp {
 		switch request.(type) {
 		case ziface.IRequest:
 			iRequest := request.(ziface.IRequest)
-			if zconf.GlobalObject.WorkerPoolSize > 0 {
+			if !mh.acceptTask() {
+				zlog.Ins().DebugF("connID=%d msgID=%d is dropped while draining", iRequest.GetConnection().GetConnID(), iRequest.GetMsgID())
+				iRequest.Release()
+				return nil
+			}
+			if mh.WorkerPoolSize > 0 {
 				// 已经启动工作池机制，将消息交给worker处理
-				mh.SendMsgToTaskQueue(iRequest)
+				mh.pushTaskQueue(iRequest)
 			} else {
 				// 从绑定好的消息和对应的处理方法中执行对应的Handler方法
-				if !zconf.GlobalObject.RouterSlicesMode {
-					go mh.doMsgHandle(iRequest, WorkerIDWithoutWorkerPool)
-				} else if zconf.GlobalObject.RouterSlicesMode {
-					go mh.doMsgHandlerSlices(iRequest, WorkerIDWithoutWorkerPool)
-				}
+				go func() {
+					defer atomic.AddInt64(&mh.inFlight, -1)
+					mh.dispatch(iRequest, WorkerIDWithoutWorkerPool)
+					// 路由处理完成，回收请求
+					iRequest.Release()
+				}()
 			}
 
 		}
@@ -82,19 +99,44 @@ func newMsgHandle() *MsgHandle {
 		RouterSlices:   NewRouterSlices(),
 		builder:        newChainBuilder(),
 	}
+	// 同一个msgID只能绑定一种路由方式，调用时已经持有RouterSlices的锁
+	handle.RouterSlices.registered = func(msgId uint32) bool {
+		_, ok := handle.Apis[msgId]
+		return ok
+	}
 	// 此处必须把msgHandler 添加到责任链中，并且是责任链的最后一环，在msghandler中进行解码后由router做数据分发
 	handle.builder.Tail(handle)
 	return handle
 }
 
+// 客户端使用的MsgHandle，只开启一个worker，保证消息按照收到的顺序处理
+// 不修改全局的WorkerPoolSize，同一进程中的Server不受影响
+func newClientMsgHandle() *MsgHandle {
+	handle := newMsgHandle()
+	handle.WorkerPoolSize = 1
+	handle.TaskQueue = make([]chan ziface.IRequest, handle.WorkerPoolSize)
+	if handle.freeWorkers != nil {
+		handle.freeWorkers = map[uint32]struct{}{0: {}}
+	}
+	return handle
+}
+
 // 为消息添加具体的处理逻辑
 func (mh *MsgHandle) AddRouter(msgID uint32, router ziface.IRouter) {
+	mh.RouterSlices.Lock()
+	defer mh.RouterSlices.Unlock()
+
 	//1 判断 当前msg绑定的API处理方式是否已经存在
 	if _, ok := mh.Apis[msgID]; ok {
 		//id已经注册了
 		msgErr := fmt.Sprintf("repeated api , msgID = %+v\n", msgID)
 		panic(msgErr)
 	}
+	if _, ok := mh.RouterSlices.Apis[msgID]; ok {
+		//id已经通过切片路由注册了
+		msgErr := fmt.Sprintf("repeated api , msgID = %+v is already bound to router slices\n", msgID)
+		panic(msgErr)
+	}
 
 	//2 添加msg与API的绑定关系
 	mh.Apis[msgID] = router
@@ -116,6 +158,53 @@ func (mh *MsgHandle) Use(Handlers ...ziface.RouterHandler) ziface.IRouterSlices
 	return mh.RouterSlices
 }
 
+// 移除msgID绑定的路由，已经开始处理的请求不受影响
+func (mh *MsgHandle) RemoveRouter(msgID uint32) bool {
+	mh.RouterSlices.Lock()
+	defer mh.RouterSlices.Unlock()
+
+	_, ok := mh.Apis[msgID]
+	delete(mh.Apis, msgID)
+	if mh.RouterSlices.removeLocked(msgID) {
+		ok = true
+	}
+	return ok
+}
+
+// 将msgID绑定到router，替换已经绑定的路由
+func (mh *MsgHandle) ReplaceRouter(msgID uint32, router ziface.IRouter) {
+	mh.RouterSlices.Lock()
+	defer mh.RouterSlices.Unlock()
+
+	mh.RouterSlices.removeLocked(msgID)
+	mh.Apis[msgID] = router
+}
+
+// 将msgID绑定到路由切片，替换已经绑定的路由，替换后不再属于之前的分组
+func (mh *MsgHandle) ReplaceRouterSlices(msgID uint32, handlers ...ziface.RouterHandler) {
+	mh.RouterSlices.Lock()
+	defer mh.RouterSlices.Unlock()
+
+	delete(mh.Apis, msgID)
+	mh.RouterSlices.setLocked(msgID, nil, handlers)
+}
+
+// 设置收到没有绑定路由的msgID时的处理函数
+func (mh *MsgHandle) SetNotFoundHandler(handler ziface.NotFoundHandler) {
+	mh.RouterSlices.Lock()
+	defer mh.RouterSlices.Unlock()
+
+	mh.notFoundHandler = handler
+}
+
+// 设置路由处理出错时的处理函数
+func (mh *MsgHandle) SetErrorHandler(handler ziface.ErrorHandler) {
+	mh.RouterSlices.Lock()
+	defer mh.RouterSlices.Unlock()
+
+	mh.errorHandler = handler
+}
+
 // 启动一个Worker工作池（开启工作池的动作只能发生一次，一个框架只能有一个工作池）
 func (mh *MsgHandle) StartWorkerPool() {
 	//根据workerPoolSize 分别开启Worker，每个Work用一个go来承载
@@ -143,23 +232,56 @@ func (mh *MsgHandle) startOneWorker(workerID int, taskQueue chan ziface.IRequest
 				//内部函数调用request
 				mh.doFuncHandler(req, workerID)
 			case ziface.IRequest:
-				if !zconf.GlobalObject.RouterSlicesMode {
-					mh.doMsgHandle(req, workerID)
-				} else if zconf.GlobalObject.RouterSlicesMode {
-					mh.doMsgHandlerSlices(req, workerID)
-				}
+				mh.dispatch(req, workerID)
+				// 路由处理完成，回收请求
+				req.Release()
 			}
+			atomic.AddInt64(&mh.inFlight, -1)
 		}
 	}
 }
 
 // 将消息交给TaskQueue，由Worker进行处理
 func (mh *MsgHandle) SendMsgToTaskQueue(request ziface.IRequest) {
+	atomic.AddInt64(&mh.inFlight, 1)
+	mh.pushTaskQueue(request)
+}
+
+// 优雅关闭开始后不再接收新的任务，返回true时任务已计入inFlight
+// 先计数再检查，保证stopAccepting之后读取到的inFlight包含所有已接收的任务
+func (mh *MsgHandle) acceptTask() bool {
+	atomic.AddInt64(&mh.inFlight, 1)
+	if atomic.LoadInt32(&mh.draining) == 1 {
+		atomic.AddInt64(&mh.inFlight, -1)
+		return false
+	}
+	return true
+}
+
+// 停止接收新读取到的消息，已经投递的任务仍会处理完毕
+func (mh *MsgHandle) stopAccepting() {
+	atomic.StoreInt32(&mh.draining, 1)
+}
+
+// 投递已计入inFlight的任务
+func (mh *MsgHandle) pushTaskQueue(request ziface.IRequest) {
 	workerID := request.GetConnection().GetWorkerID()
-	zlog.Ins().DebugF("Add ConnID=%d request msgID=%d to workerID=%d", request.GetConnection().GetConnID(), request.GetMsgID(), workerID)
+	if zlog.DebugEnabled() {
+		zlog.Ins().DebugF("Add ConnID=%d request msgID=%d to workerID=%d", request.GetConnection().GetConnID(), request.GetMsgID(), workerID)
+		zlog.Ins().DebugF("SendMsgToTaskQueue-->%s", hex.EncodeToString(request.GetData()))
+	}
 	// Send the request message to the task queue
+	// reactor模式下在poller中投递，不能因为某个worker繁忙而阻塞其他链接的读取
+	if c, ok := request.GetConnection().(*Connection); ok && c.reactorEntry != nil {
+		c.dispatchTask(mh.TaskQueue[workerID], request)
+		return
+	}
 	mh.TaskQueue[workerID] <- request
-	zlog.Ins().DebugF("SendMsgToTaskQueue-->%s", hex.EncodeToString(request.GetData()))
+}
+
+// 获取已投递但尚未处理完成的任务数量
+func (mh *MsgHandle) GetInFlightTaskCount() int64 {
+	return atomic.LoadInt64(&mh.inFlight)
 }
 
 // 执行责任链上的拦截器方法
@@ -210,42 +332,81 @@ func freeWorker(conn ziface.IConnection) {
 	}
 }
 
-// 调度/执行对应Router消息处理方法
-func (mh *MsgHandle) doMsgHandle(request ziface.IRequest, workerID int) {
-	defer func() {
-		if err := recover(); err != nil {
-			zlog.Ins().ErrorF("workerID: %d doMsgHandler panic: %v", workerID, err)
+// 路由处理时发生panic
+var ErrRouterPanic = errors.New("router panic")
+
+// 根据msgID绑定的路由方式执行对应的处理方法
+func (mh *MsgHandle) dispatch(request ziface.IRequest, workerID int) {
+	msgID := request.GetMsgID()
+
+	mh.RouterSlices.RLock()
+	router, isRouter := mh.Apis[msgID]
+	handlers, isSlices := mh.RouterSlices.Apis[msgID]
+	notFoundHandler, errorHandler := mh.notFoundHandler, mh.errorHandler
+	mh.RouterSlices.RUnlock()
+
+	var err error
+	switch {
+	case isRouter:
+		err = mh.doMsgHandle(request, router)
+	case isSlices:
+		err = mh.doMsgHandlerSlices(request, handlers)
+	default:
+		if notFoundHandler == nil {
+			zlog.Ins().ErrorF("api msgID = %d is not FOUND!", msgID)
+			return
 		}
-	}()
+		callRouteHook(workerID, msgID, func() { notFoundHandler(request) })
+		return
+	}
 
-	//1 从Request中找到MsgID
-	handler, ok := mh.Apis[request.GetMsgID()]
-	if !ok {
-		zlog.Ins().ErrorF("api msgID = %d is not FOUND!", request.GetMsgID())
+	if err == nil {
+		err = request.GetError()
+	}
+	if err == nil {
 		return
 	}
+	if errorHandler == nil {
+		zlog.Ins().ErrorF("workerID: %d msgID: %d handle err: %v", workerID, msgID, err)
+		return
+	}
+	callRouteHook(workerID, msgID, func() { errorHandler(request, err) })
+}
+
+// 调度/执行对应Router消息处理方法，发生panic时返回错误
+func (mh *MsgHandle) doMsgHandle(request ziface.IRequest, router ziface.IRouter) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrRouterPanic, r)
+		}
+	}()
 
-	//2 Request请求绑定Router对应关系
-	request.BindRouter(handler)
+	//Request请求绑定Router对应关系
+	request.BindRouter(router)
 	request.Call()
+	return nil
 }
 
-func (mh *MsgHandle) doMsgHandlerSlices(request ziface.IRequest, workerID int) {
+func (mh *MsgHandle) doMsgHandlerSlices(request ziface.IRequest, handlers []ziface.RouterHandler) (err error) {
 	defer func() {
-		if err := recover(); err != nil {
-			zlog.Ins().ErrorF("workerID: %d doMsgHandler panic: %v", workerID, err)
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrRouterPanic, r)
 		}
 	}()
 
-	msgId := request.GetMsgID()
-	handlers, ok := mh.RouterSlices.GetHandlers(msgId)
-	if !ok {
-		zlog.Ins().ErrorF("api msgID = %d is not FOUND!", request.GetMsgID())
-		return
-	}
-
 	request.BindRouterSlices(handlers)
 	request.RouterSlicesNext()
+	return nil
+}
+
+// 执行没有绑定路由以及处理出错时的处理函数，避免其中的panic影响worker
+func callRouteHook(workerID int, msgID uint32, hook func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			zlog.Ins().ErrorF("workerID: %d msgID: %d route hook panic: %v", workerID, msgID, r)
+		}
+	}()
+	hook()
 }
 
 func (mh *MsgHandle) doFuncHandler(request ziface.IFuncRequest, workerID int) {
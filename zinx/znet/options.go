@@ -1,6 +1,12 @@
 package znet
 
-import "zinx_server/zinx/ziface"
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"zinx_server/zinx/ziface"
+)
 
 type Option func(s *Server)
 
@@ -11,6 +17,20 @@ func WithPacket(pack ziface.IDataPack) Option {
 	}
 }
 
+// 优雅关闭服务器时，在关闭链接之前给每个客户端发送一条告别消息
+func WithGoodbyeMsg(msgID uint32, data []byte) Option {
+	return func(s *Server) {
+		s.SetGoodbyeMsg(msgID, data)
+	}
+}
+
+// 将websocket监听器挂载到已有的http.Handler上，websocket路径以外的请求以及非升级请求都交给该handler处理
+func WithHttpHandler(handler http.Handler) Option {
+	return func(s *Server) {
+		s.SetHttpHandler(handler)
+	}
+}
+
 // Options for Client
 type ClientOption func(c ziface.IClient)
 
@@ -28,3 +48,32 @@ func WithNameClient(name string) ClientOption {
 		c.SetName(name)
 	}
 }
+
+// Set the tls config used by NewTLSClient/NewWssClient, e.g. client certificate for mTLS and RootCAs
+// (设置TLS客户端的TLS配置，如mTLS使用的客户端证书以及校验服务端证书的CA)
+func WithTLSConfigClient(config *tls.Config) ClientOption {
+	return func(c ziface.IClient) {
+		if cli, ok := c.(*Client); ok {
+			cli.tlsConfig = config
+		}
+	}
+}
+
+// Set the dial function used to establish the raw connection, e.g. PipeListener.DialContext for in-memory tests
+// (设置客户端建立原始链接的拨号方法，如测试中使用PipeListener.DialContext建立内存链接，不适用于kcp客户端)
+func WithDialerClient(dial func(ctx context.Context, network, address string) (net.Conn, error)) ClientOption {
+	return func(c ziface.IClient) {
+		if cli, ok := c.(*Client); ok {
+			cli.dialFunc = dial
+		}
+	}
+}
+
+// Set the websocket path the client connects to (设置websocket客户端请求的路径)
+func WithWsPathClient(path string) ClientOption {
+	return func(c ziface.IClient) {
+		if cli, ok := c.(*Client); ok {
+			cli.wsPath = path
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package znet
+
+import (
+	"context"
+	"net"
+	"sync"
+)
+
+/*
+	基于net.Pipe的内存监听器，不占用真实端口，主要用于测试
+	Server通过StartWithListener在其上启动，Client通过WithDialerClient(listener.DialContext)链接
+*/
+
+// 内存管道的地址
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+type PipeListener struct {
+	conns     chan net.Conn
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func NewPipeListener() *PipeListener {
+	return &PipeListener{
+		conns:  make(chan net.Conn),
+		closed: make(chan struct{}),
+	}
+}
+
+func (l *PipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *PipeListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closed)
+	})
+	return nil
+}
+
+func (l *PipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// 建立一条内存链接，返回客户端一端，服务端一端由Accept返回
+func (l *PipeListener) Dial() (net.Conn, error) {
+	return l.DialContext(context.Background(), "pipe", "pipe")
+}
+
+// 与net.Dialer.DialContext签名一致，network和address会被忽略
+func (l *PipeListener) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	serverConn, clientConn := net.Pipe()
+
+	select {
+	case l.conns <- serverConn:
+		return clientConn, nil
+	case <-l.closed:
+		return nil, &net.OpError{Op: "dial", Net: "pipe", Err: net.ErrClosed}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,372 @@
+package znet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zinx_server/zinx/zlog"
+)
+
+/*
+	HAProxy PROXY protocol v1/v2
+	部署在四层负载均衡之后时，负载均衡会在每个TCP连接的最前面写入一个PROXY头，携带真实的客户端地址，
+	这里在accept阶段解析该头部，使得Connection.RemoteAddr()返回真实的客户端地址
+	只有来自可信地址(负载均衡)的连接才会解析PROXY头，避免客户端伪造地址
+	协议文档: https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt
+*/
+
+const (
+	// 读取PROXY头的超时时间
+	proxyProtoHeaderTimeout = 5 * time.Second
+	// v1头部的最大长度(包括\r\n)
+	proxyProtoV1MaxLen = 107
+	// v2头部固定部分的长度
+	proxyProtoV2HeaderLen = 16
+	// 已完成PROXY头解析、等待被Accept的链接队列长度
+	proxyProtoAcceptBacklog = 128
+)
+
+var (
+	proxyProtoV1Sig = []byte("PROXY ")
+	proxyProtoV2Sig = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A}
+
+	errProxyProtoMalformed = errors.New("malformed proxy protocol header")
+	errProxyProtoNoTrusted = errors.New("proxy protocol enabled without trusted sources, set ProxyProtocolTrusted")
+)
+
+type proxyProtoAcceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// 解析PROXY头的监听器
+// 为了不让慢速的对端阻塞accept，每个链接的PROXY头在单独的goroutine中解析，解析完成后才会被Accept返回
+type proxyProtoListener struct {
+	net.Listener
+
+	// 可信的来源地址，不在其中的来源不解析PROXY头
+	trusted []*net.IPNet
+
+	results   chan proxyProtoAcceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+	// 底层监听器退出的原因
+	err error
+}
+
+// 带有PROXY头中真实地址的链接
+type proxyProtoConn struct {
+	net.Conn
+	// 解析PROXY头时预读的数据
+	reader *bufio.Reader
+
+	remoteAddr net.Addr
+	localAddr  net.Addr
+}
+
+func newProxyProtoListener(listener net.Listener, trusted []string) (*proxyProtoListener, error) {
+	nets, err := parseTrustedNets(trusted)
+	if err != nil {
+		return nil, err
+	}
+	// 没有配置可信来源时拒绝开启，否则任何客户端都可以通过PROXY头伪造地址
+	if len(nets) == 0 {
+		return nil, errProxyProtoNoTrusted
+	}
+
+	l := &proxyProtoListener{
+		Listener: listener,
+		trusted:  nets,
+		results:  make(chan proxyProtoAcceptResult, proxyProtoAcceptBacklog),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+
+	return l, nil
+}
+
+// 解析可信来源列表，支持CIDR以及单个IP
+func parseTrustedNets(trusted []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(trusted))
+	for _, item := range trusted {
+		item = strings.TrimSpace(item)
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy protocol trusted address: %s", item)
+			}
+			if ip.To4() != nil {
+				item += "/32"
+			} else {
+				item += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy protocol trusted address: %s", item)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func (l *proxyProtoListener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range l.trusted {
+		if ipNet.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+func (l *proxyProtoListener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				l.closeOnce.Do(func() {
+					l.err = err
+					close(l.done)
+				})
+				return
+			}
+			l.deliver(proxyProtoAcceptResult{err: err})
+			continue
+		}
+
+		// 不可信的来源不解析PROXY头，直接使用其真实地址
+		if !l.isTrusted(conn.RemoteAddr()) {
+			l.deliver(proxyProtoAcceptResult{conn: conn})
+			continue
+		}
+
+		go func(conn net.Conn) {
+			proxyConn, err := newProxyProtoConn(conn)
+			if err != nil {
+				zlog.Ins().ErrorF("read proxy protocol header from %s err: %v", conn.RemoteAddr(), err)
+				_ = conn.Close()
+				return
+			}
+			l.deliver(proxyProtoAcceptResult{conn: proxyConn})
+		}(conn)
+	}
+}
+
+func (l *proxyProtoListener) deliver(result proxyProtoAcceptResult) {
+	select {
+	case l.results <- result:
+	case <-l.done:
+		if result.conn != nil {
+			_ = result.conn.Close()
+		}
+	}
+}
+
+func (l *proxyProtoListener) Accept() (net.Conn, error) {
+	select {
+	case result := <-l.results:
+		return result.conn, result.err
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *proxyProtoListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() {
+		l.err = net.ErrClosed
+		close(l.done)
+	})
+	return err
+}
+
+// 读取并解析链接最前面的PROXY头
+// 没有PROXY头或者为LOCAL/UNKNOWN类型时，使用链接本身的地址
+func newProxyProtoConn(conn net.Conn) (*proxyProtoConn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(proxyProtoHeaderTimeout)); err != nil {
+		return nil, err
+	}
+
+	c := &proxyProtoConn{
+		Conn:   conn,
+		reader: bufio.NewReader(conn),
+	}
+	src, dst, err := readProxyHeader(c.reader)
+	if err != nil {
+		return nil, err
+	}
+	c.remoteAddr = src
+	c.localAddr = dst
+
+	if err = conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *proxyProtoConn) Read(b []byte) (int, error) {
+	// 先读完解析头部时预读的数据，之后直接读取底层链接
+	if c.reader != nil {
+		if c.reader.Buffered() > 0 {
+			return c.reader.Read(b)
+		}
+		c.reader = nil
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *proxyProtoConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyProtoConn) LocalAddr() net.Addr {
+	if c.localAddr != nil {
+		return c.localAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+// 根据签名判断PROXY头的版本并解析，src/dst为nil表示使用链接本身的地址
+func readProxyHeader(r *bufio.Reader) (src, dst net.Addr, err error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch first[0] {
+	case proxyProtoV1Sig[0]:
+		sig, err := r.Peek(len(proxyProtoV1Sig))
+		if err != nil || !bytes.Equal(sig, proxyProtoV1Sig) {
+			return nil, nil, nil
+		}
+		return readProxyHeaderV1(r)
+	case proxyProtoV2Sig[0]:
+		sig, err := r.Peek(len(proxyProtoV2Sig))
+		if err != nil || !bytes.Equal(sig, proxyProtoV2Sig) {
+			return nil, nil, nil
+		}
+		return readProxyHeaderV2(r)
+	default:
+		return nil, nil, nil
+	}
+}
+
+// v1: "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	line := make([]byte, 0, proxyProtoV1MaxLen)
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+		if len(line) >= proxyProtoV1MaxLen {
+			return nil, nil, errProxyProtoMalformed
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errProxyProtoMalformed
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+	if len(fields) < 2 {
+		return nil, nil, errProxyProtoMalformed
+	}
+	if fields[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, nil, errProxyProtoMalformed
+	}
+
+	src, err := parseProxyV1Addr(fields[2], fields[4])
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := parseProxyV1Addr(fields[3], fields[5])
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func parseProxyV1Addr(ip, port string) (*net.TCPAddr, error) {
+	addr := &net.TCPAddr{IP: net.ParseIP(ip)}
+	if addr.IP == nil {
+		return nil, errProxyProtoMalformed
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, errProxyProtoMalformed
+	}
+	addr.Port = int(p)
+	return addr, nil
+}
+
+// v2: 12字节签名 + 版本/命令(1) + 地址族/协议(1) + 地址长度(2) + 地址 + TLV
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, net.Addr, error) {
+	header := make([]byte, proxyProtoV2HeaderLen)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+
+	verCmd := header[12]
+	famProto := header[13]
+	length := binary.BigEndian.Uint16(header[14:16])
+
+	if verCmd>>4 != 2 {
+		return nil, nil, errProxyProtoMalformed
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, nil, err
+	}
+
+	// LOCAL命令为负载均衡自身的健康检查等，使用链接本身的地址
+	switch verCmd & 0x0F {
+	case 0x00:
+		return nil, nil, nil
+	case 0x01:
+	default:
+		return nil, nil, errProxyProtoMalformed
+	}
+
+	switch famProto {
+	case 0x11: // TCP over IPv4
+		if len(payload) < 12 {
+			return nil, nil, errProxyProtoMalformed
+		}
+		src := &net.TCPAddr{IP: net.IP(payload[0:4]), Port: int(binary.BigEndian.Uint16(payload[8:10]))}
+		dst := &net.TCPAddr{IP: net.IP(payload[4:8]), Port: int(binary.BigEndian.Uint16(payload[10:12]))}
+		return src, dst, nil
+	case 0x21: // TCP over IPv6
+		if len(payload) < 36 {
+			return nil, nil, errProxyProtoMalformed
+		}
+		src := &net.TCPAddr{IP: net.IP(payload[0:16]), Port: int(binary.BigEndian.Uint16(payload[32:34]))}
+		dst := &net.TCPAddr{IP: net.IP(payload[16:32]), Port: int(binary.BigEndian.Uint16(payload[34:36]))}
+		return src, dst, nil
+	default:
+		// 其他地址族(UDP/unix等)不在TCP监听器上使用，忽略地址信息
+		return nil, nil, nil
+	}
+}
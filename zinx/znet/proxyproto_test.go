@@ -0,0 +1,90 @@
+package znet
+
+import (
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+)
+
+func TestProxyProtoListener(t *testing.T) {
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	listener, err := newProxyProtoListener(raw, []string{"127.0.0.1"})
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	accept := func(header []byte) net.Conn {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		assert.Nil(t, err)
+		_, _ = client.Write(append(header, []byte("hello")...))
+		t.Cleanup(func() { _ = client.Close() })
+
+		conn, err := listener.Accept()
+		assert.Nil(t, err)
+		return conn
+	}
+	readHello := func(conn net.Conn) {
+		buf := make([]byte, 5)
+		_, err := io.ReadFull(conn, buf)
+		assert.Nil(t, err)
+		assert.Equal(t, "hello", string(buf))
+	}
+
+	// v1
+	conn := accept([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 8999\r\n"))
+	assert.Equal(t, "192.168.0.1:56324", conn.RemoteAddr().String())
+	assert.Equal(t, "192.168.0.11:8999", conn.LocalAddr().String())
+	readHello(conn)
+
+	// v2
+	header := append([]byte{}, proxyProtoV2Sig...)
+	header = append(header, 0x21, 0x11, 0x00, 0x0C)
+	header = append(header, 10, 0, 0, 1, 10, 0, 0, 2)
+	header = binary.BigEndian.AppendUint16(header, 40000)
+	header = binary.BigEndian.AppendUint16(header, 8999)
+	conn = accept(header)
+	assert.Equal(t, "10.0.0.1:40000", conn.RemoteAddr().String())
+	readHello(conn)
+
+	// 没有PROXY头时使用链接本身的地址
+	conn = accept(nil)
+	assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+	readHello(conn)
+}
+
+func TestProxyProtoUntrusted(t *testing.T) {
+	raw, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	listener, err := newProxyProtoListener(raw, []string{"10.0.0.0/8"})
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	header := "PROXY TCP4 192.168.0.1 192.168.0.11 56324 8999\r\n"
+	client, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer client.Close()
+	_, _ = client.Write([]byte(header))
+
+	// 不可信的来源不能伪造地址，PROXY头作为普通数据交给业务层
+	conn, err := listener.Accept()
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1", conn.RemoteAddr().(*net.TCPAddr).IP.String())
+	buf := make([]byte, len(header))
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, header, string(buf))
+
+	// 关闭后Accept返回net.ErrClosed
+	assert.Nil(t, listener.Close())
+	_, err = listener.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+
+	// 没有配置可信来源时拒绝开启，不能信任所有来源
+	raw, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer raw.Close()
+	_, err = newProxyProtoListener(raw, nil)
+	assert.ErrorIs(t, err, errProxyProtoNoTrusted)
+}
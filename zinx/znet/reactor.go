@@ -0,0 +1,91 @@
+package znet
+
+import (
+	"runtime"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zlog"
+)
+
+// reactor模式下由reactor统一触发的心跳检测，HeartbeatChecker实现了该接口
+// 用户自定义的IHeartbeatChecker如果没有实现，仍使用各自的goroutine检测
+type reactorHeartbeat interface {
+	getInterval() time.Duration
+	check() error
+}
+
+// 链接由reactor触发心跳检测的间隔，为0表示不由reactor检测
+func reactorHeartbeatInterval(c *Connection) time.Duration {
+	if c.hc == nil {
+		return 0
+	}
+	hc, ok := c.hc.(reactorHeartbeat)
+	if !ok {
+		return 0
+	}
+	return hc.getInterval()
+}
+
+// reactor模式下向worker任务队列投递请求，不阻塞poller
+// 队列已满时请求放入链接的积压队列并暂停读取该链接，由单独的goroutine按顺序投递完后再恢复读取
+func (c *Connection) dispatchTask(queue chan ziface.IRequest, request ziface.IRequest) {
+	c.backlogLock.Lock()
+	defer c.backlogLock.Unlock()
+
+	if !c.backlogging {
+		select {
+		case queue <- request:
+			return
+		default:
+		}
+		c.backlogging = true
+		c.reactorEntry.pause()
+		go c.drainBacklog(queue)
+	}
+	c.backlog = append(c.backlog, request)
+}
+
+func (c *Connection) drainBacklog(queue chan ziface.IRequest) {
+	for {
+		c.backlogLock.Lock()
+		if len(c.backlog) == 0 {
+			c.backlogging = false
+			c.reactorEntry.resume()
+			c.backlogLock.Unlock()
+			return
+		}
+		request := c.backlog[0]
+		c.backlog[0] = nil
+		c.backlog = c.backlog[1:]
+		c.backlogLock.Unlock()
+
+		queue <- request
+	}
+}
+
+// 按照配置开启reactor，不支持时退回到goroutine模式
+func (s *Server) startReactor() {
+	if zconf.GlobalObject.NetMode != zconf.NetModeReactor {
+		return
+	}
+
+	pollerNum := zconf.GlobalObject.ReactorPollerNum
+	if pollerNum <= 0 {
+		pollerNum = runtime.NumCPU()
+	}
+
+	r, err := newReactor(pollerNum)
+	if err != nil {
+		zlog.Ins().ErrorF("[Start] start reactor err: %v, use goroutine net mode", err)
+		return
+	}
+	s.reactor = r
+	zlog.Ins().InfoF("[Start] Zinx server name %s, reactor net mode with %d pollers", s.Name, pollerNum)
+}
+
+func (s *Server) stopReactor() {
+	if s.reactor != nil {
+		s.reactor.close()
+	}
+}
@@ -0,0 +1,326 @@
+//go:build linux
+
+package znet
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zlog"
+)
+
+/*
+	reactor网络模型
+	由少量poller goroutine通过epoll监听所有链接的可读事件，链接可读时在poller中读取数据并解码，
+	再投递到MsgHandle的worker工作池，链接空闲时不占用任何goroutine以及读缓冲区
+	心跳检测也由reactor统一定时触发，不再为每个链接开启心跳goroutine
+*/
+
+const (
+	// 每次epoll_wait最多返回的事件数量
+	reactorMaxEvents = 128
+	// epoll_wait的超时时间(单位：毫秒)，用于检查reactor是否已关闭
+	reactorWaitTimeoutMs = 1000
+	// 心跳检测的精度
+	reactorHeartbeatTick = time.Second
+)
+
+type reactor struct {
+	pollers []*poller
+	next    uint32
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+type poller struct {
+	epfd int
+
+	// fd -> 链接
+	conns     map[int]*reactorEntry
+	connsLock sync.RWMutex
+
+	// 读缓冲区，只在poller goroutine中使用，所有链接共用
+	buffer []byte
+}
+
+// 注册到poller上的链接
+type reactorEntry struct {
+	conn    *Connection
+	fd      int
+	rawConn syscall.RawConn
+	poller  *poller
+
+	// 下一次心跳检测的时间(UnixNano)
+	nextBeat int64
+}
+
+func newReactor(pollerNum int) (*reactor, error) {
+	r := &reactor{
+		pollers: make([]*poller, 0, pollerNum),
+		done:    make(chan struct{}),
+	}
+
+	for i := 0; i < pollerNum; i++ {
+		epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+		if err != nil {
+			r.close()
+			return nil, err
+		}
+		p := &poller{
+			epfd:   epfd,
+			conns:  make(map[int]*reactorEntry),
+			buffer: make([]byte, zconf.GlobalObject.IOReadBuffSize),
+		}
+		r.pollers = append(r.pollers, p)
+		go p.loop(r.done)
+	}
+	go r.heartbeatLoop()
+
+	return r, nil
+}
+
+// 链接是否可以交给reactor处理
+// 只有直接持有socket的tcp/unix链接可以，TLS等带有用户态缓冲的链接仍使用读goroutine
+func reactorSupported(conn net.Conn) bool {
+	switch conn.(type) {
+	case *net.TCPConn, *net.UnixConn:
+		return true
+	default:
+		return false
+	}
+}
+
+// 将链接注册到其中一个poller上
+func (r *reactor) add(c *Connection) error {
+	sc, ok := c.conn.(syscall.Conn)
+	if !ok {
+		return errors.New("connection does not support syscall.Conn")
+	}
+	rawConn, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	fd := -1
+	if err = rawConn.Control(func(s uintptr) {
+		fd = int(s)
+	}); err != nil {
+		return err
+	}
+
+	p := r.pollers[atomic.AddUint32(&r.next, 1)%uint32(len(r.pollers))]
+	entry := &reactorEntry{
+		conn:    c,
+		fd:      fd,
+		rawConn: rawConn,
+		poller:  p,
+	}
+	if interval := reactorHeartbeatInterval(c); interval > 0 {
+		entry.nextBeat = time.Now().Add(interval).UnixNano()
+	}
+
+	// 注册之后poller随时可能读取该链接，需要先关联好entry
+	c.reactorEntry = entry
+	p.connsLock.Lock()
+	p.conns[fd] = entry
+	p.connsLock.Unlock()
+
+	event := &syscall.EpollEvent{Events: syscall.EPOLLIN | syscall.EPOLLRDHUP, Fd: int32(fd)}
+	if err = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, fd, event); err != nil {
+		p.remove(entry)
+		return err
+	}
+
+	return nil
+}
+
+// 将链接从poller上移除，需要在关闭socket之前调用
+func (r *reactor) remove(c *Connection) {
+	if c.reactorEntry != nil {
+		c.reactorEntry.poller.remove(c.reactorEntry)
+	}
+}
+
+// 关闭所有poller，已注册的链接需要先被关闭
+func (r *reactor) close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+}
+
+func (p *poller) loop(done chan struct{}) {
+	defer syscall.Close(p.epfd)
+
+	events := make([]syscall.EpollEvent, reactorMaxEvents)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		n, err := syscall.EpollWait(p.epfd, events, reactorWaitTimeoutMs)
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			zlog.Ins().ErrorF("reactor epoll wait err: %v", err)
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			p.connsLock.RLock()
+			entry, ok := p.conns[int(events[i].Fd)]
+			p.connsLock.RUnlock()
+			if !ok {
+				continue
+			}
+			p.read(entry)
+		}
+	}
+}
+
+// 读取链接上已到达的数据并投递给worker工作池
+// 采用水平触发，一次没有读完的数据会在下一次epoll_wait时继续读取
+func (p *poller) read(entry *reactorEntry) {
+	c := entry.conn
+
+	var n int
+	var readErr error
+	err := entry.rawConn.Read(func(fd uintptr) bool {
+		n, readErr = syscall.Read(int(fd), p.buffer)
+		// 不论是否读到数据都直接返回，避免阻塞poller
+		return true
+	})
+	if err == nil {
+		err = readErr
+	}
+	if errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EINTR) {
+		return
+	}
+	if err == nil && n <= 0 {
+		err = io.EOF
+	}
+	if err != nil {
+		zlog.Ins().ErrorF("%s reactor read [read datalen=%d], error = %v", c.RemoteAddr(), n, err)
+		// 关闭链接会调用用户的OnConnStop，不在poller中执行
+		p.remove(entry)
+		go c.StopWithReason(readCloseReason(err), err)
+		return
+	}
+
+	c.timeout.onRead()
+	c.stats.onRead(n)
+
+	// 读缓冲区会被其他链接复用，handleData不会持有其中的数据
+	if err = c.handleData(p.buffer[:n]); err != nil {
+		p.remove(entry)
+		go c.StopWithReason(decodeCloseReason(err), err)
+	}
+}
+
+// 暂停监听链接的可读事件，已经从poller上移除的链接不再处理，避免影响复用了该fd的新链接
+func (e *reactorEntry) pause() {
+	e.poller.modify(e, 0)
+}
+
+// 恢复监听链接的可读事件
+func (e *reactorEntry) resume() {
+	e.poller.modify(e, syscall.EPOLLIN|syscall.EPOLLRDHUP)
+}
+
+func (p *poller) modify(entry *reactorEntry, events uint32) {
+	p.connsLock.RLock()
+	defer p.connsLock.RUnlock()
+
+	if cur, ok := p.conns[entry.fd]; !ok || cur != entry {
+		return
+	}
+	event := &syscall.EpollEvent{Events: events, Fd: int32(entry.fd)}
+	_ = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_MOD, entry.fd, event)
+}
+
+func (p *poller) remove(entry *reactorEntry) {
+	p.connsLock.Lock()
+	if cur, ok := p.conns[entry.fd]; ok && cur == entry {
+		delete(p.conns, entry.fd)
+	}
+	p.connsLock.Unlock()
+
+	_ = syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, entry.fd, nil)
+}
+
+// 统一为所有注册的链接执行心跳检测
+func (r *reactor) heartbeatLoop() {
+	ticker := time.NewTicker(reactorHeartbeatTick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			for _, p := range r.pollers {
+				p.checkHeartbeat(now)
+				p.checkTimeout(now)
+			}
+		case <-r.done:
+			return
+		}
+	}
+}
+
+func (p *poller) checkHeartbeat(now time.Time) {
+	due := make([]*reactorEntry, 0)
+
+	p.connsLock.RLock()
+	for _, entry := range p.conns {
+		if entry.nextBeat > 0 && now.UnixNano() >= entry.nextBeat {
+			due = append(due, entry)
+		}
+	}
+	p.connsLock.RUnlock()
+
+	for _, entry := range due {
+		interval := reactorHeartbeatInterval(entry.conn)
+		if interval <= 0 {
+			continue
+		}
+		entry.nextBeat = now.Add(interval).UnixNano()
+
+		// 发送心跳报文可能阻塞，不在reactor中执行
+		hc := entry.conn.hc.(reactorHeartbeat)
+		go func() {
+			_ = hc.check()
+		}()
+	}
+}
+
+// 检查链接的读超时和空闲超时，精度为reactorHeartbeatTick
+func (p *poller) checkTimeout(now time.Time) {
+	type expiredEntry struct {
+		entry  *reactorEntry
+		reason ziface.CloseReason
+	}
+	expired := make([]expiredEntry, 0)
+
+	p.connsLock.RLock()
+	for _, entry := range p.conns {
+		if reason := entry.conn.timeout.expired(now); reason != ziface.CloseReasonNone {
+			expired = append(expired, expiredEntry{entry: entry, reason: reason})
+		}
+	}
+	p.connsLock.RUnlock()
+
+	for _, e := range expired {
+		zlog.Ins().ErrorF("connID=%d %s, close it", e.entry.conn.connID, e.reason)
+		p.remove(e.entry)
+		go e.entry.conn.StopWithReason(e.reason, os.ErrDeadlineExceeded)
+	}
+}
@@ -0,0 +1,238 @@
+//go:build linux
+
+package znet
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zpack"
+)
+
+func TestReactorNetMode(t *testing.T) {
+	netMode := zconf.GlobalObject.NetMode
+	zconf.GlobalObject.NetMode = zconf.NetModeReactor
+	defer func() { zconf.GlobalObject.NetMode = netMode }()
+
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{{Mode: zconf.ServerModeTcp, Host: "127.0.0.1", Port: 18777}}
+	s.AddRouter(1, &PingRouter{})
+	s.Start()
+	defer s.Stop()
+	time.Sleep(time.Millisecond * 100)
+	assert.NotNil(t, s.reactor)
+
+	// 空闲链接不占用goroutine
+	goroutines := runtime.NumGoroutine()
+	conns := make([]net.Conn, 0, 100)
+	for i := 0; i < 100; i++ {
+		conn, err := net.Dial("tcp", "127.0.0.1:18777")
+		assert.Nil(t, err)
+		conns = append(conns, conn)
+	}
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, 100, s.GetConnMgr().Len())
+	assert.Less(t, runtime.NumGoroutine()-goroutines, 20)
+
+	// 请求仍然投递到worker工作池处理
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	pack, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("ping")))
+	_, err := conns[0].Write(pack)
+	assert.Nil(t, err)
+
+	expected := []string{"before ping ....\n", "ping...ping...ping\n", "After ping .....\n"}
+	_ = conns[0].SetReadDeadline(time.Now().Add(time.Second))
+	for _, data := range expected {
+		headData := make([]byte, dp.GetHeadLen())
+		_, err = io.ReadFull(conns[0], headData)
+		assert.Nil(t, err)
+		msgHead, _ := dp.Unpack(headData)
+		body := make([]byte, msgHead.GetDataLen())
+		_, err = io.ReadFull(conns[0], body)
+		assert.Nil(t, err)
+		assert.Equal(t, data, string(body))
+	}
+
+	// 对端关闭后链接被移除
+	for _, conn := range conns {
+		_ = conn.Close()
+	}
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, 0, s.GetConnMgr().Len())
+}
+
+func TestReactorHeartbeat(t *testing.T) {
+	netMode := zconf.GlobalObject.NetMode
+	zconf.GlobalObject.NetMode = zconf.NetModeReactor
+	defer func() { zconf.GlobalObject.NetMode = netMode }()
+
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{{Mode: zconf.ServerModeTcp, Host: "127.0.0.1", Port: 18778}}
+	s.StartHeartBeat(time.Second)
+	s.Start()
+	defer s.Stop()
+	time.Sleep(time.Millisecond * 100)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:18778")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// 心跳报文由reactor统一触发
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+	headData := make([]byte, dp.GetHeadLen())
+	_, err = io.ReadFull(conn, headData)
+	assert.Nil(t, err)
+	msgHead, _ := dp.Unpack(headData)
+	assert.Equal(t, ziface.HeartBeatDefaultMsgID, msgHead.GetMsgID())
+}
+
+func TestReactorIdleTimeout(t *testing.T) {
+	netMode, idleTimeout := zconf.GlobalObject.NetMode, zconf.GlobalObject.IdleTimeout
+	zconf.GlobalObject.NetMode = zconf.NetModeReactor
+	zconf.GlobalObject.IdleTimeout = 500
+	defer func() {
+		zconf.GlobalObject.NetMode = netMode
+		zconf.GlobalObject.IdleTimeout = idleTimeout
+	}()
+
+	reasons := make(chan ziface.CloseReason, 1)
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{{Mode: zconf.ServerModeTcp, Host: "127.0.0.1", Port: 18779}}
+	s.SetOnConnStop(func(conn ziface.IConnection) {
+		reason, _ := conn.GetCloseReason()
+		reasons <- reason
+	})
+	s.Start()
+	defer s.Stop()
+	time.Sleep(time.Millisecond * 100)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:18779")
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// 空闲超时由reactor定时检查
+	select {
+	case reason := <-reasons:
+		assert.Equal(t, ziface.CloseReasonIdleTimeout, reason)
+	case <-time.After(3 * time.Second):
+		t.Fatal("idle connection is not closed")
+	}
+}
+
+func TestReactorShutdown(t *testing.T) {
+	netMode := zconf.GlobalObject.NetMode
+	zconf.GlobalObject.NetMode = zconf.NetModeReactor
+	defer func() { zconf.GlobalObject.NetMode = netMode }()
+
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{{Name: "reactor", Mode: zconf.ServerModeTcp, Host: "127.0.0.1"}}
+	s.Start()
+	addr := listenerAddr(t, s, "reactor")
+	assert.NotNil(t, s.reactor)
+
+	for i := 0; i < 10; i++ {
+		conn, err := net.Dial("tcp", addr)
+		assert.Nil(t, err)
+		defer conn.Close()
+	}
+	assert.Eventually(t, func() bool {
+		return s.GetConnMgr().Len() == 10
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// reactor模式下关闭链接会同步从ConnMgr中移除，优雅关闭不能因此死锁
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		done <- s.Shutdown(ctx)
+	}()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown deadlock in reactor mode")
+	}
+	assert.Equal(t, 0, s.GetConnMgr().Len())
+}
+
+type reactorBlockRouter struct {
+	BaseRouter
+	release  chan struct{}
+	received chan string
+}
+
+func (r *reactorBlockRouter) Handle(request ziface.IRequest) {
+	<-r.release
+	r.received <- string(request.GetData())
+}
+
+func TestReactorWorkerQueueFull(t *testing.T) {
+	defer func(netMode string, poolSize, taskLen uint32, pollerNum int) {
+		zconf.GlobalObject.NetMode = netMode
+		zconf.GlobalObject.WorkerPoolSize = poolSize
+		zconf.GlobalObject.MaxWorkerTaskLen = taskLen
+		zconf.GlobalObject.ReactorPollerNum = pollerNum
+	}(zconf.GlobalObject.NetMode, zconf.GlobalObject.WorkerPoolSize, zconf.GlobalObject.MaxWorkerTaskLen, zconf.GlobalObject.ReactorPollerNum)
+	zconf.GlobalObject.NetMode = zconf.NetModeReactor
+	zconf.GlobalObject.WorkerPoolSize = 2
+	zconf.GlobalObject.MaxWorkerTaskLen = 1
+	zconf.GlobalObject.ReactorPollerNum = 1
+
+	router := &reactorBlockRouter{release: make(chan struct{}), received: make(chan string, 8)}
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{{Name: "reactor", Mode: zconf.ServerModeTcp, Host: "127.0.0.1"}}
+	s.AddRouter(1, router)
+	s.AddRouter(2, &poolEchoRouter{})
+	started := make(chan ziface.IConnection, 2)
+	s.SetOnConnStart(func(conn ziface.IConnection) { started <- conn })
+	s.Start()
+	defer s.Stop()
+	addr := listenerAddr(t, s, "reactor")
+
+	slow, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer slow.Close()
+	slowConn := <-started
+	fast, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer fast.Close()
+	fastConn := <-started
+
+	// 慢链接的worker阻塞且任务队列已满
+	dp := zpack.NewDataPack()
+	for _, data := range []string{"a", "b", "c", "d", "e"} {
+		pack, _ := dp.Pack(zpack.NewMsgPackage(1, []byte(data)))
+		_, err = slow.Write(pack)
+		assert.Nil(t, err)
+	}
+	assert.Eventually(t, func() bool { return slowConn.GetStats().MsgIn >= 3 }, time.Second, 10*time.Millisecond)
+
+	// 同一poller上其他链接的读取不受影响
+	pack, _ := dp.Pack(zpack.NewMsgPackage(2, []byte("ping")))
+	_, err = fast.Write(pack)
+	assert.Nil(t, err)
+	_ = fast.SetReadDeadline(time.Now().Add(time.Second))
+	reply := make([]byte, len(pack))
+	_, err = io.ReadFull(fast, reply)
+	assert.Nil(t, err)
+	assert.Equal(t, pack, reply)
+	assert.NotEqual(t, slowConn.GetWorkerID(), fastConn.GetWorkerID())
+
+	// 积压的请求按顺序处理
+	close(router.release)
+	for _, data := range []string{"a", "b", "c", "d", "e"} {
+		select {
+		case received := <-router.received:
+			assert.Equal(t, data, received)
+		case <-time.After(time.Second):
+			t.Fatal("backlog request is not handled")
+		}
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package znet
+
+import (
+	"errors"
+	"net"
+)
+
+// 非Linux平台不支持reactor网络模型，链接仍然使用读goroutine
+type reactor struct{}
+
+type reactorEntry struct{}
+
+func newReactor(pollerNum int) (*reactor, error) {
+	return nil, errors.New("reactor net mode is only supported on linux")
+}
+
+func reactorSupported(conn net.Conn) bool {
+	return false
+}
+
+func (r *reactor) add(c *Connection) error {
+	return errors.New("reactor net mode is only supported on linux")
+}
+
+func (r *reactor) remove(c *Connection) {}
+
+func (r *reactor) close() {}
+
+func (e *reactorEntry) pause() {}
+
+func (e *reactorEntry) resume() {}
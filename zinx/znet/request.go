@@ -1,9 +1,11 @@
 package znet
 
 import (
+	"errors"
 	"sync"
 	"zinx_server/zinx/zconf"
 	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zpack"
 )
 
 const (
@@ -20,11 +22,19 @@ type Request struct {
 	msg      ziface.IMessage        // 客户端请求的数据
 	router   ziface.IRouter         // 请求处理的函数
 	steps    ziface.HandleStep      // 用来控制路由函数执行
-	stepLock *sync.RWMutex          // 并发互斥
+	stepLock sync.RWMutex           // 并发互斥
 	needNext bool                   // 是否需要执行下一个路由函数
 	icResp   ziface.IcResp          // 拦截器返回数据
 	handlers []ziface.RouterHandler // 路由函数切片
 	index    int8                   // 路由函数切片索引
+	pooled   bool                   // 是否来自对象池
+	err      error                  // 处理过程中报告的错误
+}
+
+var requestPool = sync.Pool{
+	New: func() interface{} {
+		return new(Request)
+	},
 }
 
 // 得到当前链接
@@ -46,6 +56,35 @@ func (r *Request) GetMessage() ziface.IMessage {
 	return r.msg
 }
 
+// 报告处理出错，路由处理完成后交给错误处理函数
+func (r *Request) SetError(err error) {
+	r.err = err
+}
+
+func (r *Request) GetError() error {
+	return r.err
+}
+
+// 获取请求ID，消息不携带请求ID时返回0
+func (r *Request) GetRequestID() uint32 {
+	if msg, ok := r.msg.(ziface.IRequestIDMessage); ok {
+		return msg.GetRequestID()
+	}
+	return 0
+}
+
+// 请求不携带请求ID，对端不是通过Call发出的请求
+var ErrNoRequestID = errors.New("request has no request id")
+
+// 使用与请求相同的消息ID和请求ID回复对端
+func (r *Request) Reply(data []byte) error {
+	requestID := r.GetRequestID()
+	if requestID == 0 {
+		return ErrNoRequestID
+	}
+	return r.conn.SendMsgWithRequestID(r.GetMsgID(), requestID, data)
+}
+
 func (r *Request) BindRouter(router ziface.IRouter) {
 	r.router = router
 }
@@ -88,8 +127,9 @@ func (r *Request) Call() {
 	r.steps = PRE_HANDLE
 }
 
+// 终止后续处理函数，根据请求绑定的路由方式决定
 func (r *Request) Abort() {
-	if zconf.GlobalObject.RouterSlicesMode {
+	if r.handlers != nil {
 		r.index = int8(len(r.handlers))
 	} else {
 		r.stepLock.Lock()
@@ -122,11 +162,62 @@ func (r *Request) SetResponse(response ziface.IcResp) {
 
 func NewRequest(conn ziface.IConnection, msg ziface.IMessage) ziface.IRequest {
 	req := new(Request)
-	req.steps = PRE_HANDLE
-	req.conn = conn
-	req.msg = msg
-	req.stepLock = new(sync.RWMutex)
-	req.needNext = true
-	req.index = -1
+	req.reset(conn, msg)
 	return req
 }
+
+// 从对象池中获取Request，路由处理完成后由框架调用Release归还
+func GetRequest(conn ziface.IConnection, msg ziface.IMessage) ziface.IRequest {
+	req := requestPool.Get().(*Request)
+	req.reset(conn, msg)
+	req.pooled = true
+	return req
+}
+
+func (r *Request) reset(conn ziface.IConnection, msg ziface.IMessage) {
+	r.steps = PRE_HANDLE
+	r.conn = conn
+	r.msg = msg
+	r.needNext = true
+	r.index = -1
+	r.err = nil
+}
+
+// 拷贝的请求持有独立的消息数据，不会随原请求被回收
+// 拦截器返回的数据只做浅拷贝
+func (r *Request) Copy() ziface.IRequest {
+	data := make([]byte, len(r.msg.GetData()))
+	copy(data, r.msg.GetData())
+	msg := zpack.NewMessageByMsgId(r.msg.GetMsgID(), r.msg.GetDataLen(), data)
+	msg.SetRequestID(r.GetRequestID())
+
+	req := new(Request)
+	req.reset(r.conn, msg)
+	req.icResp = r.icResp
+	return req
+}
+
+// 归还通过GetRequest获取的请求，以及其中可以释放的消息
+// 归还之后不能再使用该请求以及GetData返回的数据
+func (r *Request) Release() {
+	if !r.pooled {
+		return
+	}
+	if msg, ok := r.msg.(interface{ Release() }); ok {
+		msg.Release()
+	}
+	*r = Request{}
+	requestPool.Put(r)
+}
+
+// 根据读取到的数据创建请求，data所在的读缓冲区会被复用，这里总是拷贝一份
+// 开启RequestPoolMode时数据拷贝到缓冲池中，随Request一起释放
+func newReadRequest(conn ziface.IConnection, data []byte) ziface.IRequest {
+	if zconf.GlobalObject.RequestPoolMode {
+		return GetRequest(conn, zpack.GetMessage(0, data))
+	}
+
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	return NewRequest(conn, zpack.NewMessage(uint32(len(buf)), buf))
+}
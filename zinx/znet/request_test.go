@@ -0,0 +1,131 @@
+package znet
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zlog"
+	"zinx_server/zinx/zpack"
+)
+
+type benchEchoRouter struct {
+	BaseRouter
+	done chan struct{}
+}
+
+func (r *benchEchoRouter) Handle(request ziface.IRequest) {
+	_ = request.GetConnection().SendMsg(request.GetMsgID(), request.GetData())
+	r.done <- struct{}{}
+}
+
+func TestRequestCopyAndRelease(t *testing.T) {
+	req := GetRequest(nil, zpack.GetMessage(1, []byte("zinx")))
+	copied := req.Copy()
+	req.Release()
+
+	// 拷贝的请求不受原请求回收的影响
+	assert.Equal(t, uint32(1), copied.GetMsgID())
+	assert.Equal(t, "zinx", string(copied.GetData()))
+	copied.Release()
+	assert.Equal(t, "zinx", string(copied.GetData()))
+}
+
+type poolEchoRouter struct {
+	BaseRouter
+}
+
+func (r *poolEchoRouter) Handle(request ziface.IRequest) {
+	_ = request.GetConnection().SendMsg(request.GetMsgID(), request.GetData())
+}
+
+func TestRequestPoolMode(t *testing.T) {
+	defer func(mode bool) { zconf.GlobalObject.RequestPoolMode = mode }(zconf.GlobalObject.RequestPoolMode)
+	zconf.GlobalObject.RequestPoolMode = true
+
+	listener := NewPipeListener()
+	s := NewServer()
+	s.AddRouter(1, &poolEchoRouter{})
+	s.StartWithListener(listener)
+	defer s.Stop()
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	dp := zpack.NewDataPack()
+	go func() {
+		for i := 0; i < 100; i++ {
+			packet, _ := dp.Pack(zpack.NewMsgPackage(1, []byte(fmt.Sprintf("ping-%d", i))))
+			if _, err := conn.Write(packet); err != nil {
+				return
+			}
+		}
+	}()
+
+	// 请求被回收复用后，回复的数据仍然与请求一致
+	for i := 0; i < 100; i++ {
+		head := make([]byte, dp.GetHeadLen())
+		_, err = io.ReadFull(conn, head)
+		assert.Nil(t, err)
+		msg, err := dp.Unpack(head)
+		assert.Nil(t, err)
+		data := make([]byte, msg.GetDataLen())
+		_, err = io.ReadFull(conn, data)
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf("ping-%d", i), string(data))
+	}
+}
+
+// 一条消息从读取、解码、路由处理到回写的完整路径
+func benchmarkMessagePath(b *testing.B, requestPoolMode bool) {
+	defer func(mode bool) { zconf.GlobalObject.RequestPoolMode = mode }(zconf.GlobalObject.RequestPoolMode)
+	zconf.GlobalObject.RequestPoolMode = requestPoolMode
+
+	zlog.SetLogLevel(zlog.LogError)
+	defer zlog.SetLogLevel(zlog.LogDebug)
+
+	router := &benchEchoRouter{done: make(chan struct{})}
+	s := NewServer().(*Server)
+	s.AddRouter(1, router)
+	s.startMsgHandler()
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go func() {
+		_, _ = io.Copy(io.Discard, clientConn)
+	}()
+	c := newServerConn(s, serverConn, 1, "bench")
+	go c.StartReader()
+	defer c.Stop()
+
+	packet, _ := zpack.NewDataPack().Pack(zpack.NewMsgPackage(1, make([]byte, 128)))
+
+	// 客户端持续写入请求
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if _, err := clientConn.Write(packet); err != nil {
+				return
+			}
+		}
+	}()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		<-router.done
+	}
+}
+
+// go test -run=^$ -bench=MessagePath ./znet
+func BenchmarkMessagePath(b *testing.B) {
+	b.Run("alloc", func(b *testing.B) {
+		benchmarkMessagePath(b, false)
+	})
+	b.Run("pool", func(b *testing.B) {
+		benchmarkMessagePath(b, true)
+	})
+}
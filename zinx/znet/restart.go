@@ -0,0 +1,307 @@
+package znet
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/zlog"
+)
+
+/*
+	热重启
+	新启动一个进程并将所有监听套接字交接给它，旧进程通过优雅关闭处理完已有链接后退出，
+	整个过程中监听端口不会关闭，新链接由新进程接收
+	注意：KCP/UDP的会话状态保存在旧进程中，无法交接，这部分对端需要重新建立会话
+*/
+
+const (
+	// 父进程通过该环境变量告知子进程继承的监听器名称列表(JSON数组)，第i个监听器的文件描述符为3+i
+	envInheritedListeners = "ZINX_INHERITED_LISTENERS"
+	// 父进程通过该环境变量告知子进程就绪管道的文件描述符，子进程重建所有监听器后向其写入一个字节
+	envReadyFd = "ZINX_READY_FD"
+	// 子进程继承的第一个文件描述符，0/1/2为标准输入输出
+	inheritedFdStart = 3
+)
+
+// 新进程未能在HotRestartTimeout内就绪
+var ErrHotRestartTimeout = errors.New("hot restart: wait for new process ready timeout")
+
+// 可以交接给新进程的监听套接字
+type inheritableSocket interface {
+	File() (*os.File, error)
+}
+
+var (
+	inheritedOnce  sync.Once
+	inheritedLock  sync.Mutex
+	inheritedFiles map[string]*os.File
+	// 向父进程通知就绪的管道，非热重启启动时为nil
+	readyFile *os.File
+)
+
+// 解析父进程传递下来的监听套接字以及就绪管道
+func loadInheritedFiles() {
+	inheritedFiles = make(map[string]*os.File)
+
+	if value := os.Getenv(envReadyFd); value != "" {
+		_ = os.Unsetenv(envReadyFd)
+		if fd, err := strconv.Atoi(value); err == nil {
+			readyFile = os.NewFile(uintptr(fd), "zinx-ready")
+		} else {
+			zlog.Ins().ErrorF("parse %s err: %v", envReadyFd, err)
+		}
+	}
+
+	value := os.Getenv(envInheritedListeners)
+	if value == "" {
+		return
+	}
+	// 避免再次fork时被子进程误用
+	_ = os.Unsetenv(envInheritedListeners)
+
+	var names []string
+	if err := json.Unmarshal([]byte(value), &names); err != nil {
+		zlog.Ins().ErrorF("parse %s err: %v", envInheritedListeners, err)
+		return
+	}
+
+	for i, name := range names {
+		inheritedFiles[name] = os.NewFile(uintptr(inheritedFdStart+i), name)
+	}
+}
+
+// 取出父进程传递下来的指定名称的监听套接字，每个套接字只能被取出一次
+func takeInheritedFile(name string) (*os.File, bool) {
+	inheritedOnce.Do(loadInheritedFiles)
+
+	inheritedLock.Lock()
+	defer inheritedLock.Unlock()
+
+	f, ok := inheritedFiles[name]
+	if ok {
+		delete(inheritedFiles, name)
+	}
+	return f, ok
+}
+
+// 取出向父进程通知就绪的管道，只能被取出一次
+func takeReadyFile() (*os.File, bool) {
+	inheritedOnce.Do(loadInheritedFiles)
+
+	inheritedLock.Lock()
+	defer inheritedLock.Unlock()
+
+	f := readyFile
+	readyFile = nil
+	return f, f != nil
+}
+
+// 获取父进程传递下来的流式监听器(tcp/websocket/unix)
+func inheritedListener(name string) (net.Listener, bool, error) {
+	f, ok := takeInheritedFile(name)
+	if !ok {
+		return nil, false, nil
+	}
+	defer f.Close()
+
+	listener, err := net.FileListener(f)
+	if err != nil {
+		return nil, true, err
+	}
+	zlog.Ins().InfoF("inherit listener %s from parent process", name)
+	return listener, true, nil
+}
+
+// 获取父进程传递下来的数据报套接字(kcp/udp)
+func inheritedPacketConn(name string) (net.PacketConn, bool, error) {
+	f, ok := takeInheritedFile(name)
+	if !ok {
+		return nil, false, nil
+	}
+	defer f.Close()
+
+	conn, err := net.FilePacketConn(f)
+	if err != nil {
+		return nil, true, err
+	}
+	zlog.Ins().InfoF("inherit packet conn %s from parent process", name)
+	return conn, true, nil
+}
+
+// 记录当前Server已开启的监听套接字，热重启时交接给子进程
+// sock为nil表示该监听器无法交接，仅记录其已开启
+func (s *Server) trackSocket(name string, sock inheritableSocket) {
+	s.socketsLock.Lock()
+	defer s.socketsLock.Unlock()
+
+	if sock != nil {
+		if s.sockets == nil {
+			s.sockets = make(map[string]inheritableSocket)
+		}
+		s.sockets[name] = sock
+	}
+
+	s.listenerOpened++
+	if s.listenersReady != nil && s.listenerOpened == s.listenerCount {
+		close(s.listenersReady)
+	}
+}
+
+// 所有监听器开启后，通过就绪管道通知父进程
+// 如果某个监听器开启失败导致进程退出，父进程会读到EOF
+func (s *Server) notifyParentReady(f *os.File) {
+	defer f.Close()
+
+	select {
+	case <-s.listenersReady:
+	case <-s.exitChan:
+		return
+	}
+	if _, err := f.Write([]byte{1}); err != nil {
+		zlog.Ins().ErrorF("[RESTART] notify parent process ready err: %v", err)
+		return
+	}
+	zlog.Ins().InfoF("[RESTART] Zinx server name %s, all listeners ready, notify parent process", s.Name)
+}
+
+// 等待子进程通过就绪管道发来就绪通知
+func waitChildReady(r *os.File, timeout time.Duration) error {
+	result := make(chan error, 1)
+	go func() {
+		// 子进程退出时，管道的写端全部关闭，这里读到EOF
+		_, err := io.ReadFull(r, make([]byte, 1))
+		result <- err
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-result:
+		if err != nil {
+			return fmt.Errorf("hot restart: new process exited before ready: %w", err)
+		}
+		return nil
+	case <-timer.C:
+		// 关闭读端，结束上面的读取
+		_ = r.Close()
+		return ErrHotRestartTimeout
+	}
+}
+
+// 热重启失败，监听套接字仍由当前进程使用，恢复unix socket文件的自动删除
+func (s *Server) restoreUnlinkOnClose() {
+	s.socketsLock.Lock()
+	defer s.socketsLock.Unlock()
+
+	for _, sock := range s.sockets {
+		if ul, ok := sock.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(true)
+		}
+	}
+}
+
+// 启动一个新的进程，并将当前所有的监听套接字交接给它
+// 新进程重建所有监听器并通知就绪后才返回，新进程启动失败或超时未就绪时返回错误，当前进程应继续提供服务
+func (s *Server) forkChild() error {
+	s.socketsLock.Lock()
+	names := make([]string, 0, len(s.sockets))
+	files := make([]*os.File, 0, len(s.sockets))
+	for name, sock := range s.sockets {
+		// 子进程会继续使用该socket文件，当前进程关闭监听器时不能将其删除
+		if ul, ok := sock.(*net.UnixListener); ok {
+			ul.SetUnlinkOnClose(false)
+		}
+		f, err := sock.File()
+		if err != nil {
+			s.socketsLock.Unlock()
+			closeFiles(files)
+			return fmt.Errorf("get file of listener %s err: %v", name, err)
+		}
+		names = append(names, name)
+		files = append(files, f)
+	}
+	s.socketsLock.Unlock()
+
+	// 子进程启动后持有自己的文件描述符，当前进程的副本可以关闭
+	defer closeFiles(files)
+
+	value, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+
+	path, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	// 就绪管道，写端交给子进程，放在所有监听套接字之后
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	env := make([]string, 0, len(os.Environ())+2)
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, envInheritedListeners+"=") && !strings.HasPrefix(kv, envReadyFd+"=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, envInheritedListeners+"="+string(value))
+	env = append(env, envReadyFd+"="+strconv.Itoa(inheritedFdStart+len(files)))
+
+	cmd := exec.Command(path, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+	cmd.ExtraFiles = append(files, readyW)
+
+	err = cmd.Start()
+	// 关闭当前进程持有的写端，子进程退出时读端才能读到EOF
+	_ = readyW.Close()
+	if err != nil {
+		s.restoreUnlinkOnClose()
+		return err
+	}
+
+	zlog.Ins().InfoF("[RESTART] Zinx server name %s, new process pid = %d, listeners = %v, wait for ready", s.Name, cmd.Process.Pid, names)
+	if err = waitChildReady(readyR, zconf.GlobalObject.HotRestartTimeoutDuration()); err != nil {
+		// 新进程未能就绪，结束它并由当前进程继续提供服务
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		s.restoreUnlinkOnClose()
+		return err
+	}
+
+	zlog.Ins().InfoF("[RESTART] Zinx server name %s, new process pid = %d is ready", s.Name, cmd.Process.Pid)
+	return nil
+}
+
+// 热重启
+// 启动新进程接管所有监听套接字，新进程就绪后优雅关闭当前进程的所有链接
+// 新进程未能就绪时返回错误，当前进程继续提供服务
+func (s *Server) HotRestart(ctx context.Context) error {
+	if err := s.forkChild(); err != nil {
+		return err
+	}
+	return s.Shutdown(ctx)
+}
+
+func closeFiles(files []*os.File) {
+	for _, f := range files {
+		_ = f.Close()
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package znet
+
+import (
+	"os"
+	"syscall"
+)
+
+// 触发热重启的信号
+var hotRestartSignals = []os.Signal{syscall.SIGUSR2}
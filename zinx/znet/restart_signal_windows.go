@@ -0,0 +1,8 @@
+//go:build windows
+
+package znet
+
+import "os"
+
+// windows下不支持通过信号触发热重启
+var hotRestartSignals []os.Signal
@@ -0,0 +1,103 @@
+package znet
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+)
+
+func TestInheritedListener(t *testing.T) {
+	parent, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.ParseIP("127.0.0.1")})
+	assert.Nil(t, err)
+	defer parent.Close()
+
+	// 模拟父进程交接下来的监听套接字
+	f, err := parent.File()
+	assert.Nil(t, err)
+	inheritedOnce.Do(loadInheritedFiles)
+	inheritedLock.Lock()
+	inheritedFiles["tcp://test"] = f
+	inheritedLock.Unlock()
+
+	_, ok, err := inheritedListener("tcp://unknown")
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	listener, ok, err := inheritedListener("tcp://test")
+	assert.Nil(t, err)
+	assert.True(t, ok)
+	defer listener.Close()
+	assert.Equal(t, parent.Addr().String(), listener.Addr().String())
+
+	// 每个套接字只能被取出一次
+	_, ok, _ = inheritedListener("tcp://test")
+	assert.False(t, ok)
+
+	// 父进程关闭后，继承的监听器仍然可以接收新链接
+	assert.Nil(t, parent.Close())
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	accepted, err := listener.Accept()
+	assert.Nil(t, err)
+	_ = accepted.Close()
+}
+
+func TestWaitChildReady(t *testing.T) {
+	// 子进程通知就绪
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	_, _ = w.Write([]byte{1})
+	assert.Nil(t, waitChildReady(r, time.Second))
+	_ = r.Close()
+	_ = w.Close()
+
+	// 子进程在就绪之前退出
+	r, w, err = os.Pipe()
+	assert.Nil(t, err)
+	_ = w.Close()
+	err = waitChildReady(r, time.Second)
+	assert.NotNil(t, err)
+	assert.NotErrorIs(t, err, ErrHotRestartTimeout)
+	_ = r.Close()
+
+	// 子进程超时未就绪
+	r, w, err = os.Pipe()
+	assert.Nil(t, err)
+	assert.ErrorIs(t, waitChildReady(r, 10*time.Millisecond), ErrHotRestartTimeout)
+	_ = w.Close()
+}
+
+func TestNotifyParentReady(t *testing.T) {
+	r, w, err := os.Pipe()
+	assert.Nil(t, err)
+	defer r.Close()
+
+	// 模拟父进程交接下来的就绪管道
+	inheritedOnce.Do(loadInheritedFiles)
+	inheritedLock.Lock()
+	readyFile = w
+	inheritedLock.Unlock()
+
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{
+		{Mode: zconf.ServerModeTcp, Host: "127.0.0.1"},
+		{Mode: zconf.ServerModeUdp, Host: "127.0.0.1"},
+	}
+	s.Start()
+	defer s.Stop()
+
+	// 所有监听器开启后才通知就绪
+	assert.Nil(t, waitChildReady(r, 3*time.Second))
+	s.socketsLock.Lock()
+	assert.Equal(t, 2, len(s.sockets))
+	s.socketsLock.Unlock()
+
+	// 就绪管道只能被取出一次
+	_, ok := takeReadyFile()
+	assert.False(t, ok)
+}
@@ -0,0 +1,65 @@
+package znet
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"zinx_server/zinx/ziface"
+)
+
+/*
+	路由表信息，可以用于管理后台查看当前注册的路由
+*/
+
+// 获取所有已注册的路由信息，按msgID排序
+func (mh *MsgHandle) GetRoutes() []ziface.RouteInfo {
+	mh.RouterSlices.RLock()
+	defer mh.RouterSlices.RUnlock()
+
+	routes := make([]ziface.RouteInfo, 0, len(mh.Apis)+len(mh.RouterSlices.Apis))
+	for msgID, router := range mh.Apis {
+		routes = append(routes, ziface.RouteInfo{
+			MsgID:    msgID,
+			Style:    ziface.RouteStyleRouter,
+			Handlers: []string{fmt.Sprintf("%T", router)},
+		})
+	}
+	for msgID, handlers := range mh.RouterSlices.Apis {
+		route := mh.RouterSlices.routes[msgID]
+		info := ziface.RouteInfo{
+			MsgID:      msgID,
+			Style:      ziface.RouteStyleSlices,
+			Handlers:   handlerNames(handlers[route.middleware:]),
+			Middleware: handlerNames(handlers[:route.middleware]),
+		}
+		if route.group != nil {
+			info.Group = &ziface.RouteGroup{Start: route.group.start, End: route.group.end}
+		}
+		routes = append(routes, info)
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].MsgID < routes[j].MsgID
+	})
+	return routes
+}
+
+func handlerNames(handlers []ziface.RouterHandler) []string {
+	names := make([]string, 0, len(handlers))
+	for _, handler := range handlers {
+		names = append(names, handlerName(handler))
+	}
+	return names
+}
+
+// 处理函数的名称，如zinx_server/zinx/znet.RouterRecovery
+func handlerName(handler ziface.RouterHandler) string {
+	if handler == nil {
+		return "<nil>"
+	}
+	if fn := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return "<unknown>"
+}
@@ -21,33 +21,80 @@ func (br *BaseRouter) PostHandle(request ziface.IRequest) {}
 type RouterSlices struct {
 	Apis     map[uint32][]ziface.RouterHandler
 	Handlers []ziface.RouterHandler
+	// 路由可以在运行期间修改，MsgHandle.Apis同样使用该锁
 	sync.RWMutex
+
+	// 每个msgID的公共组件数量以及所属分组
+	routes map[uint32]sliceRoute
+
+	// 判断msgId是否已经通过其他方式(IRouter)注册，由MsgHandle设置，调用时已经持有锁
+	registered func(msgId uint32) bool
+}
+
+type sliceRoute struct {
+	// 处理器集合中前middleware个为公共组件
+	middleware int
+	group      *GroupRouter
 }
 
 func NewRouterSlices() *RouterSlices {
 	return &RouterSlices{
 		Apis:     make(map[uint32][]ziface.RouterHandler),
 		Handlers: make([]ziface.RouterHandler, 0, 6),
+		routes:   make(map[uint32]sliceRoute),
 	}
 }
 
 func (r *RouterSlices) Use(handlers ...ziface.RouterHandler) {
+	r.Lock()
+	defer r.Unlock()
+
 	r.Handlers = append(r.Handlers, handlers...)
 }
 
 func (r *RouterSlices) AddHandler(msgId uint32, Handlers ...ziface.RouterHandler) {
+	r.addHandler(msgId, nil, Handlers)
+}
+
+// group不为空时，在业务处理器之前加上分组的公共组件
+func (r *RouterSlices) addHandler(msgId uint32, group *GroupRouter, handlers []ziface.RouterHandler) {
+	r.Lock()
+	defer r.Unlock()
+
 	//查找Apis中是否已经注册该handlers，已注册则panic直接返回
 	if _, ok := r.Apis[msgId]; ok {
 		panic("repeated api, msgId = " + strconv.Itoa(int(msgId)))
 	}
+	if r.registered != nil && r.registered(msgId) {
+		panic("repeated api, msgId = " + strconv.Itoa(int(msgId)) + " is already bound to an IRouter")
+	}
+
+	r.setLocked(msgId, group, handlers)
+}
 
-	finalSize := len(r.Handlers) + len(Handlers)
+// 绑定msgId的处理器集合，已经绑定的会被替换
+func (r *RouterSlices) setLocked(msgId uint32, group *GroupRouter, handlers []ziface.RouterHandler) {
+	var groupHandlers []ziface.RouterHandler
+	if group != nil {
+		groupHandlers = group.Handlers
+	}
 
-	mergedHandlers := make([]ziface.RouterHandler, finalSize)
-	copy(mergedHandlers, r.Handlers)
-	copy(mergedHandlers[len(r.Handlers):], Handlers)
+	middleware := len(r.Handlers) + len(groupHandlers)
+	mergedHandlers := make([]ziface.RouterHandler, 0, middleware+len(handlers))
+	mergedHandlers = append(mergedHandlers, r.Handlers...)
+	mergedHandlers = append(mergedHandlers, groupHandlers...)
+	mergedHandlers = append(mergedHandlers, handlers...)
 
-	r.Apis[msgId] = append(r.Apis[msgId], mergedHandlers...)
+	r.Apis[msgId] = mergedHandlers
+	r.routes[msgId] = sliceRoute{middleware: middleware, group: group}
+}
+
+// 移除msgId的处理器集合，返回是否存在
+func (r *RouterSlices) removeLocked(msgId uint32) bool {
+	_, ok := r.Apis[msgId]
+	delete(r.Apis, msgId)
+	delete(r.routes, msgId)
+	return ok
 }
 
 func (r *RouterSlices) Group(start, end uint32, Handlers ...ziface.RouterHandler) ziface.IGroupRouterSlices {
@@ -66,7 +113,7 @@ type GroupRouter struct {
 	start    uint32
 	end      uint32
 	Handlers []ziface.RouterHandler
-	router   ziface.IRouterSlices
+	router   *RouterSlices
 }
 
 func NewGroup(start, end uint32, router *RouterSlices, Handlers ...ziface.RouterHandler) *GroupRouter {
@@ -89,10 +136,5 @@ func (g *GroupRouter) AddHandler(MsgId uint32, Handlers ...ziface.RouterHandler)
 		panic("add router to group err in msgId:" + strconv.Itoa(int(MsgId)))
 	}
 
-	finalSize := len(g.Handlers) + len(Handlers)
-	mergedHandlers := make([]ziface.RouterHandler, finalSize)
-	copy(mergedHandlers, g.Handlers)
-	copy(mergedHandlers[len(g.Handlers):], Handlers)
-
-	g.router.AddHandler(MsgId, mergedHandlers...)
+	g.router.addHandler(MsgId, g, Handlers)
 }
@@ -1,9 +1,15 @@
 package znet
 
 import (
+	"errors"
 	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strconv"
 	"testing"
+	"time"
 	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zpack"
 )
 
 func A1(request ziface.IRequest) {
@@ -48,3 +54,227 @@ func TestRouterAdd(t *testing.T) {
 
 	}
 }
+
+type abortRouter struct {
+	BaseRouter
+	called chan string
+}
+
+func (r *abortRouter) PreHandle(request ziface.IRequest) {
+	r.called <- "pre"
+	request.Abort()
+}
+
+func (r *abortRouter) Handle(request ziface.IRequest) {
+	r.called <- "handle"
+}
+
+func TestServerMixedRouterStyles(t *testing.T) {
+	listener := NewPipeListener()
+	s := NewServer()
+	called := make(chan string, 4)
+	s.AddRouter(1, &abortRouter{called: called})
+	s.AddRouterSlices(2, func(request ziface.IRequest) {
+		called <- "slice"
+		request.Abort()
+	}, func(request ziface.IRequest) {
+		called <- "after abort"
+	})
+	s.StartWithListener(listener)
+	defer s.Stop()
+
+	// 同一个msgID不能同时绑定两种路由
+	assert.Panics(t, func() { s.AddRouterSlices(1, A1) })
+	assert.Panics(t, func() { s.AddRouter(2, &BaseRouter{}) })
+	assert.Panics(t, func() { s.Group(1, 3).AddHandler(1, A1) })
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	dp := zpack.NewDataPack()
+	for _, msgID := range []uint32{1, 2} {
+		packet, _ := dp.Pack(zpack.NewMsgPackage(msgID, []byte("ping")))
+		_, err = conn.Write(packet)
+		assert.Nil(t, err)
+
+		select {
+		case name := <-called:
+			assert.Equal(t, map[uint32]string{1: "pre", 2: "slice"}[msgID], name)
+		case <-time.After(time.Second):
+			t.Fatalf("msgID=%d not handled", msgID)
+		}
+	}
+	// Abort之后的处理函数不会执行
+	select {
+	case name := <-called:
+		t.Fatalf("unexpected %s", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestGetRoutes(t *testing.T) {
+	mh := newMsgHandle()
+	mh.Use(A1)
+	mh.AddRouter(1, &BaseRouter{})
+	mh.AddRouterSlices(2, A2)
+	group := mh.Group(10, 20, A3)
+	group.AddHandler(10, A4)
+
+	routes := mh.GetRoutes()
+	assert.Equal(t, []ziface.RouteInfo{
+		{MsgID: 1, Style: ziface.RouteStyleRouter, Handlers: []string{"*znet.BaseRouter"}},
+		{MsgID: 2, Style: ziface.RouteStyleSlices, Handlers: []string{handlerName(A2)}, Middleware: []string{handlerName(A1)}},
+		{MsgID: 10, Style: ziface.RouteStyleSlices, Handlers: []string{handlerName(A4)},
+			Middleware: []string{handlerName(A1), handlerName(A3)}, Group: &ziface.RouteGroup{Start: 10, End: 20}},
+	}, routes)
+	assert.Equal(t, "zinx_server/zinx/znet.A4", routes[2].Handlers[0])
+
+	// 替换时可以改变路由方式，替换后不再属于之前的分组
+	mh.ReplaceRouterSlices(1, A5)
+	mh.ReplaceRouter(10, &abortRouter{})
+	assert.True(t, mh.RemoveRouter(2))
+	assert.False(t, mh.RemoveRouter(2))
+
+	routes = mh.GetRoutes()
+	assert.Equal(t, []ziface.RouteInfo{
+		{MsgID: 1, Style: ziface.RouteStyleSlices, Handlers: []string{handlerName(A5)}, Middleware: []string{handlerName(A1)}},
+		{MsgID: 10, Style: ziface.RouteStyleRouter, Handlers: []string{"*znet.abortRouter"}},
+	}, routes)
+
+	// 移除之后可以重新注册
+	assert.NotPanics(t, func() { mh.AddRouter(2, &BaseRouter{}) })
+
+	// 运行期间并发修改以及查看路由
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			mh.ReplaceRouterSlices(3, A6)
+			mh.RemoveRouter(3)
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		mh.dispatch(NewRequest(nil, zpack.NewMsgPackage(3, nil)), 0)
+		mh.GetRoutes()
+	}
+	<-done
+}
+
+func TestServerReplaceRouterAtRuntime(t *testing.T) {
+	listener := NewPipeListener()
+	s := NewServer()
+	called := make(chan string, 16)
+	s.AddRouterSlices(1, func(request ziface.IRequest) {
+		called <- "v1"
+	})
+	s.StartWithListener(listener)
+	defer s.Stop()
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	send := func() {
+		writeSessionMsg(t, conn, 1, []byte("ping"))
+	}
+	expect := func(want string) {
+		select {
+		case name := <-called:
+			assert.Equal(t, want, name)
+		case <-time.After(time.Second):
+			t.Fatalf("%s not called", want)
+		}
+	}
+
+	send()
+	expect("v1")
+
+	s.ReplaceRouterSlices(1, func(request ziface.IRequest) {
+		called <- "v2"
+	})
+	send()
+	expect("v2")
+
+	s.ReplaceRouter(1, &pipeClientRouter{replies: called})
+	send()
+	expect("ping")
+
+	// 移除之后的消息不再处理
+	assert.True(t, s.RemoveRouter(1))
+	send()
+	select {
+	case name := <-called:
+		t.Fatalf("unexpected %s", name)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Empty(t, s.GetRoutes())
+}
+
+type panicRouter struct {
+	BaseRouter
+}
+
+func (r *panicRouter) Handle(request ziface.IRequest) {
+	panic("boom")
+}
+
+func TestServerRouteHooks(t *testing.T) {
+	listener := NewPipeListener()
+	s := NewServer()
+	s.AddRouter(1, &panicRouter{})
+	s.AddRouterSlices(2, func(request ziface.IRequest) {
+		request.SetError(errors.New("bad request"))
+	})
+	s.Use(RouterRecovery)
+	s.AddRouterSlices(3, func(request ziface.IRequest) {
+		panic("boom")
+	})
+
+	errs := make(chan error, 3)
+	s.SetErrorHandler(func(request ziface.IRequest, err error) {
+		errs <- err
+		_ = request.GetConnection().SendMsg(500, []byte(err.Error()))
+	})
+	// 未知的msgID回复错误消息，累计两次之后断开链接
+	strikes := ziface.NewKey[int]("notFoundStrikes")
+	s.SetNotFoundHandler(func(request ziface.IRequest) {
+		conn := request.GetConnection()
+		_ = conn.SendMsg(404, []byte(strconv.Itoa(int(request.GetMsgID()))))
+		n := strikes.GetOr(conn, 0) + 1
+		strikes.Set(conn, n)
+		if n >= 2 {
+			conn.StopWithReason(ziface.CloseReasonKicked, errors.New("too many unknown msgID"))
+		}
+	})
+	s.StartWithListener(listener)
+	defer s.Stop()
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	for _, msgID := range []uint32{1, 3} {
+		writeSessionMsg(t, conn, msgID, nil)
+		replyID, data := readSessionMsg(t, conn)
+		assert.Equal(t, uint32(500), replyID)
+		assert.Contains(t, string(data), "router panic: boom")
+		assert.ErrorIs(t, <-errs, ErrRouterPanic)
+	}
+
+	writeSessionMsg(t, conn, 2, nil)
+	replyID, data := readSessionMsg(t, conn)
+	assert.Equal(t, uint32(500), replyID)
+	assert.Equal(t, "bad request", string(data))
+	assert.EqualError(t, <-errs, "bad request")
+
+	for i := 0; i < 2; i++ {
+		writeSessionMsg(t, conn, 9, nil)
+		replyID, data = readSessionMsg(t, conn)
+		assert.Equal(t, uint32(404), replyID)
+		assert.Equal(t, "9", string(data))
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
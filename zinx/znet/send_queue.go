@@ -0,0 +1,421 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zlog"
+)
+
+/*
+	SendBuffMsg/SendToQueue使用的有缓冲发送队列
+	队列按优先级分为多个通道，写goroutine总是先写出高优先级通道中的消息
+	通道已满时按照链接的溢出策略处理，队列总长度越过高/低水位线时通知应用层，便于应用层对生产者限流
+	写goroutine每次取出队列中已有的全部消息(最多sendQueueMaxBatch条)合并写出，减少系统调用次数
+*/
+
+const (
+	// 一次合并写出的最大消息数量
+	sendQueueMaxBatch = 128
+)
+
+var (
+	ErrSendQueueTimeout  = errors.New("send buff msg timeout")
+	ErrSendQueueFull     = errors.New("send buff msg queue is full")
+	ErrSendQueueClosed   = errors.New("connection closed when send buff msg")
+	ErrSendQueuePriority = errors.New("unknown send buff msg priority")
+)
+
+// 单个优先级通道
+type sendLane struct {
+	ch       chan []byte
+	capacity int
+
+	enqueued uint64
+	sent     uint64
+	dropped  uint64
+}
+
+type sendQueue struct {
+	owner ziface.IConnection
+
+	initOnce sync.Once
+	lanes    [ziface.SendPriorityNum]sendLane
+	// Flush请求，写goroutine写出请求之前已入队的消息后回复
+	flushCh chan chan error
+	// 写goroutine退出时关闭
+	stopped chan struct{}
+	// 合并写的等待窗口
+	flushWindow time.Duration
+
+	// 已放入队列但尚未写出的消息数量(包括已取出正在写的消息)
+	pending int64
+	// 是否已经达到高水位线，回落到低水位线后重置
+	overHigh int32
+
+	lock        sync.RWMutex
+	policy      string
+	timeout     time.Duration
+	high, low   int
+	onWatermark func(conn ziface.IConnection, overHigh bool)
+}
+
+func newSendQueue(owner ziface.IConnection) *sendQueue {
+	q := &sendQueue{
+		owner:       owner,
+		flushWindow: zconf.GlobalObject.WriteFlushWindowDuration(),
+		policy:      zconf.GlobalObject.SendQueuePolicy,
+		timeout:     zconf.GlobalObject.SendQueueTimeoutDuration(),
+		high:        zconf.GlobalObject.SendQueueHighWatermark,
+		low:         zconf.GlobalObject.SendQueueLowWatermark,
+	}
+
+	capacity := int(zconf.GlobalObject.MaxMsgChanLen)
+	for i := range q.lanes {
+		q.lanes[i].capacity = capacity
+	}
+	if zconf.GlobalObject.MaxMsgChanLenHigh != 0 {
+		q.lanes[ziface.SendPriorityHigh].capacity = int(zconf.GlobalObject.MaxMsgChanLenHigh)
+	}
+	if zconf.GlobalObject.MaxMsgChanLenLow != 0 {
+		q.lanes[ziface.SendPriorityLow].capacity = int(zconf.GlobalObject.MaxMsgChanLenLow)
+	}
+	return q
+}
+
+// 首次使用时创建队列，返回true表示本次调用创建了队列，需要启动写goroutine
+func (q *sendQueue) init() bool {
+	created := false
+	q.initOnce.Do(func() {
+		for i := range q.lanes {
+			q.lanes[i].ch = make(chan []byte, q.lanes[i].capacity)
+		}
+		q.flushCh = make(chan chan error)
+		q.stopped = make(chan struct{})
+		created = true
+	})
+	return created
+}
+
+func checkSendQueuePolicy(policy string) error {
+	switch policy {
+	case zconf.SendQueuePolicyTimeout, zconf.SendQueuePolicyBlock, zconf.SendQueuePolicyDropOldest,
+		zconf.SendQueuePolicyDropNewest, zconf.SendQueuePolicyDisconnect:
+		return nil
+	default:
+		return fmt.Errorf("unknown send queue policy: %s", policy)
+	}
+}
+
+func (q *sendQueue) setPolicy(policy string) error {
+	if err := checkSendQueuePolicy(policy); err != nil {
+		return err
+	}
+	q.lock.Lock()
+	q.policy = policy
+	q.lock.Unlock()
+	return nil
+}
+
+func (q *sendQueue) setWatermark(high, low int, callback func(conn ziface.IConnection, overHigh bool)) {
+	q.lock.Lock()
+	q.high, q.low = high, low
+	q.onWatermark = callback
+	q.lock.Unlock()
+}
+
+// 将数据放入对应优先级的通道，disconnect为true表示需要断开该链接，overHigh为true表示本次放入越过了高水位线
+// 调用方需要持有链接的msgLock读锁，保证队列不会在放入期间被关闭
+// 断开链接和高水位回调都可能再次获取msgLock，需要由调用方在释放读锁之后进行
+func (q *sendQueue) push(ctx context.Context, connCtx context.Context, data []byte, priority ziface.SendPriority) (disconnect, overHigh bool, err error) {
+	if priority < 0 || priority >= ziface.SendPriorityNum {
+		return false, false, ErrSendQueuePriority
+	}
+	lane := &q.lanes[priority]
+
+	q.lock.RLock()
+	policy, timeout := q.policy, q.timeout
+	q.lock.RUnlock()
+
+	atomic.AddInt64(&q.pending, 1)
+
+	select {
+	case lane.ch <- data:
+		return false, q.enqueued(lane), nil
+	default:
+	}
+
+	// 通道已满
+	switch policy {
+	case zconf.SendQueuePolicyBlock:
+		select {
+		case lane.ch <- data:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-connCtx.Done():
+			err = ErrSendQueueClosed
+		case <-q.stopped:
+			err = ErrSendQueueClosed
+		}
+	case zconf.SendQueuePolicyDropOldest:
+		for {
+			select {
+			case lane.ch <- data:
+				return false, q.enqueued(lane), nil
+			default:
+			}
+			select {
+			case <-lane.ch:
+				atomic.AddInt64(&q.pending, -1)
+				atomic.AddUint64(&lane.dropped, 1)
+				zlog.Ins().ErrorF("connID=%d send queue is full, drop the oldest msg, priority = %d", q.owner.GetConnID(), priority)
+			default:
+			}
+		}
+	case zconf.SendQueuePolicyDropNewest:
+		err = ErrSendQueueFull
+	case zconf.SendQueuePolicyDisconnect:
+		zlog.Ins().ErrorF("connID=%d send queue is full, disconnect slow consumer", q.owner.GetConnID())
+		disconnect, err = true, ErrSendQueueFull
+	default:
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case lane.ch <- data:
+		case <-timer.C:
+			err = ErrSendQueueTimeout
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-connCtx.Done():
+			err = ErrSendQueueClosed
+		case <-q.stopped:
+			err = ErrSendQueueClosed
+		}
+	}
+
+	if err != nil {
+		atomic.AddInt64(&q.pending, -1)
+		atomic.AddUint64(&lane.dropped, 1)
+		return disconnect, false, err
+	}
+	return false, q.enqueued(lane), nil
+}
+
+// 返回本次放入是否越过了高水位线
+func (q *sendQueue) enqueued(lane *sendLane) bool {
+	atomic.AddUint64(&lane.enqueued, 1)
+	return q.checkHigh()
+}
+
+// 写goroutine主循环，每次按优先级取出一批消息交给write写出，直到ctx结束、队列关闭或写出失败
+func (q *sendQueue) writeLoop(ctx context.Context, write func(batch [][]byte) error) error {
+	defer close(q.stopped)
+	batch := make([][]byte, 0, sendQueueMaxBatch+1)
+
+	for {
+		var (
+			first    []byte
+			hasFirst bool
+			lane     ziface.SendPriority
+			flushed  chan error
+			ok       = true
+		)
+
+		select {
+		case first, ok = <-q.lanes[ziface.SendPriorityHigh].ch:
+			hasFirst, lane = ok, ziface.SendPriorityHigh
+		case first, ok = <-q.lanes[ziface.SendPriorityNormal].ch:
+			hasFirst, lane = ok, ziface.SendPriorityNormal
+		case first, ok = <-q.lanes[ziface.SendPriorityLow].ch:
+			hasFirst, lane = ok, ziface.SendPriorityLow
+		case flushed = <-q.flushCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if !ok {
+			return ErrSendQueueClosed
+		}
+		if hasFirst && q.flushWindow > 0 {
+			flushed = q.wait(ctx)
+		}
+
+		// Flush时一直写到队列为空，保证Flush之前入队的消息都已写出
+		var err error
+		for {
+			var counts [ziface.SendPriorityNum]int
+			batch = q.drain(batch, &counts, first, hasFirst, lane)
+			hasFirst = false
+			if len(batch) == 0 {
+				break
+			}
+			err = write(batch)
+			for i := range batch {
+				batch[i] = nil
+			}
+			batch = batch[:0]
+			q.done(counts)
+			if err != nil || flushed == nil {
+				break
+			}
+		}
+		if flushed != nil {
+			flushed <- err
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// 在合并写窗口内等待更多消息入队，窗口结束或收到Flush请求时返回
+func (q *sendQueue) wait(ctx context.Context) chan error {
+	timer := time.NewTimer(q.flushWindow)
+	defer timer.Stop()
+
+	select {
+	case flushed := <-q.flushCh:
+		return flushed
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// 按优先级从高到低取出队列中当前已有的消息，不等待
+// first为writeLoop已经从lane通道取出的消息，排在该通道其余消息之前，并且一定会放入本批次
+func (q *sendQueue) drain(batch [][]byte, counts *[ziface.SendPriorityNum]int, first []byte, hasFirst bool, lane ziface.SendPriority) [][]byte {
+	for i := range q.lanes {
+		if hasFirst && ziface.SendPriority(i) == lane {
+			batch = append(batch, first)
+			counts[i]++
+		}
+		ch := q.lanes[i].ch
+	drain:
+		for len(batch) < sendQueueMaxBatch {
+			select {
+			case data, ok := <-ch:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, data)
+				counts[i]++
+			default:
+				break drain
+			}
+		}
+	}
+	return batch
+}
+
+// 等待写goroutine写出调用之前已放入队列的所有消息
+// 调用方需要持有链接的msgLock读锁，并且已经通过init创建队列
+func (q *sendQueue) flush(connCtx context.Context) error {
+	reply := make(chan error, 1)
+	select {
+	case q.flushCh <- reply:
+	case <-connCtx.Done():
+		return ErrSendQueueClosed
+	case <-q.stopped:
+		return ErrSendQueueClosed
+	}
+
+	select {
+	case err := <-reply:
+		return err
+	case <-connCtx.Done():
+		return ErrSendQueueClosed
+	case <-q.stopped:
+		return ErrSendQueueClosed
+	}
+}
+
+// 写goroutine每写出一批消息后调用，counts为各优先级通道写出的消息数量
+func (q *sendQueue) done(counts [ziface.SendPriorityNum]int) {
+	n := 0
+	for i, count := range counts {
+		if count > 0 {
+			atomic.AddUint64(&q.lanes[i].sent, uint64(count))
+			n += count
+		}
+	}
+	pending := atomic.AddInt64(&q.pending, -int64(n))
+
+	if atomic.LoadInt32(&q.overHigh) == 0 {
+		return
+	}
+	q.lock.RLock()
+	low, callback := q.low, q.onWatermark
+	q.lock.RUnlock()
+
+	if pending <= int64(low) && atomic.CompareAndSwapInt32(&q.overHigh, 1, 0) && callback != nil {
+		callback(q.owner, false)
+	}
+}
+
+// 队列长度首次达到高水位线时返回true，回落到低水位线之前不会重复返回true
+func (q *sendQueue) checkHigh() bool {
+	q.lock.RLock()
+	high := q.high
+	q.lock.RUnlock()
+
+	if high <= 0 || atomic.LoadInt64(&q.pending) < int64(high) {
+		return false
+	}
+	return atomic.CompareAndSwapInt32(&q.overHigh, 0, 1)
+}
+
+// 通知应用层队列已越过高水位线，调用方不能持有链接的msgLock
+func (q *sendQueue) notifyHigh() {
+	q.lock.RLock()
+	callback := q.onWatermark
+	q.lock.RUnlock()
+
+	if callback != nil {
+		callback(q.owner, true)
+	}
+}
+
+// 队列中尚未写出的消息数量
+func (q *sendQueue) depth() int {
+	return int(atomic.LoadInt64(&q.pending))
+}
+
+// 所有优先级通道的容量之和
+func (q *sendQueue) capacity() int {
+	capacity := 0
+	for i := range q.lanes {
+		capacity += q.lanes[i].capacity
+	}
+	return capacity
+}
+
+// 各优先级通道的统计，按优先级从高到低排列
+func (q *sendQueue) stats() []ziface.SendLaneStats {
+	stats := make([]ziface.SendLaneStats, len(q.lanes))
+	for i := range q.lanes {
+		lane := &q.lanes[i]
+		stats[i] = ziface.SendLaneStats{
+			Priority: ziface.SendPriority(i),
+			Len:      len(lane.ch),
+			Cap:      lane.capacity,
+			Enqueued: atomic.LoadUint64(&lane.enqueued),
+			Sent:     atomic.LoadUint64(&lane.sent),
+			Dropped:  atomic.LoadUint64(&lane.dropped),
+		}
+	}
+	return stats
+}
+
+// 关闭队列，调用方需要持有链接的msgLock写锁
+func (q *sendQueue) close() {
+	for i := range q.lanes {
+		if q.lanes[i].ch != nil {
+			close(q.lanes[i].ch)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package znet
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"net"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+)
+
+func setTestSendQueueCap(q *sendQueue, capacity int) {
+	for i := range q.lanes {
+		q.lanes[i].capacity = capacity
+	}
+}
+
+func newTestSendQueue(t *testing.T, policy string) *sendQueue {
+	q := newSendQueue(&Connection{})
+	setTestSendQueueCap(q, 2)
+	q.init()
+	assert.Nil(t, q.setPolicy(policy))
+	return q
+}
+
+func TestSendQueuePolicy(t *testing.T) {
+	ctx := context.Background()
+
+	q := newTestSendQueue(t, zconf.SendQueuePolicyDropNewest)
+	for i := 0; i < 2; i++ {
+		_, _, err := q.push(ctx, ctx, []byte{byte(i)}, ziface.SendPriorityNormal)
+		assert.Nil(t, err)
+	}
+	_, _, err := q.push(ctx, ctx, []byte{2}, ziface.SendPriorityNormal)
+	assert.Equal(t, ErrSendQueueFull, err)
+	assert.Equal(t, 2, q.depth())
+
+	// 丢弃最早的消息
+	q = newTestSendQueue(t, zconf.SendQueuePolicyDropOldest)
+	for i := 0; i < 3; i++ {
+		_, _, err = q.push(ctx, ctx, []byte{byte(i)}, ziface.SendPriorityNormal)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 2, q.depth())
+	assert.Equal(t, []byte{1}, <-q.lanes[ziface.SendPriorityNormal].ch)
+	assert.Equal(t, []byte{2}, <-q.lanes[ziface.SendPriorityNormal].ch)
+
+	q = newTestSendQueue(t, zconf.SendQueuePolicyDisconnect)
+	q.push(ctx, ctx, []byte{0}, ziface.SendPriorityNormal)
+	q.push(ctx, ctx, []byte{1}, ziface.SendPriorityNormal)
+	disconnect, _, err := q.push(ctx, ctx, []byte{2}, ziface.SendPriorityNormal)
+	assert.True(t, disconnect)
+	assert.Equal(t, ErrSendQueueFull, err)
+
+	q = newTestSendQueue(t, zconf.SendQueuePolicyTimeout)
+	q.push(ctx, ctx, []byte{0}, ziface.SendPriorityNormal)
+	q.push(ctx, ctx, []byte{1}, ziface.SendPriorityNormal)
+	_, _, err = q.push(ctx, ctx, []byte{2}, ziface.SendPriorityNormal)
+	assert.Equal(t, ErrSendQueueTimeout, err)
+
+	// 阻塞直到ctx超时，或者队列出现空位
+	q = newTestSendQueue(t, zconf.SendQueuePolicyBlock)
+	q.push(ctx, ctx, []byte{0}, ziface.SendPriorityNormal)
+	q.push(ctx, ctx, []byte{1}, ziface.SendPriorityNormal)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, _, err = q.push(timeoutCtx, ctx, []byte{2}, ziface.SendPriorityNormal)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		<-q.lanes[ziface.SendPriorityNormal].ch
+		q.done([ziface.SendPriorityNum]int{ziface.SendPriorityNormal: 1})
+	}()
+	_, _, err = q.push(ctx, ctx, []byte{2}, ziface.SendPriorityNormal)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, q.depth())
+
+	assert.NotNil(t, q.setPolicy("unknown"))
+}
+
+func TestSendQueueWatermark(t *testing.T) {
+	ctx := context.Background()
+	q := newTestSendQueue(t, zconf.SendQueuePolicyDropNewest)
+
+	events := make([]bool, 0)
+	q.setWatermark(2, 0, func(conn ziface.IConnection, overHigh bool) {
+		events = append(events, overHigh)
+	})
+
+	_, overHigh, _ := q.push(ctx, ctx, []byte{0}, ziface.SendPriorityNormal)
+	assert.False(t, overHigh)
+	_, overHigh, _ = q.push(ctx, ctx, []byte{1}, ziface.SendPriorityNormal)
+	assert.True(t, overHigh)
+	// 回落到低水位线之前不会再次越过高水位线
+	_, overHigh, _ = q.push(ctx, ctx, []byte{2}, ziface.SendPriorityNormal)
+	assert.False(t, overHigh)
+
+	// 高水位回调由调用方在push之后触发
+	assert.Empty(t, events)
+	q.notifyHigh()
+	assert.Equal(t, []bool{true}, events)
+
+	<-q.lanes[ziface.SendPriorityNormal].ch
+	q.done([ziface.SendPriorityNum]int{ziface.SendPriorityNormal: 1})
+	assert.Equal(t, []bool{true}, events)
+	<-q.lanes[ziface.SendPriorityNormal].ch
+	q.done([ziface.SendPriorityNum]int{ziface.SendPriorityNormal: 1})
+	assert.Equal(t, []bool{true, false}, events)
+}
+
+func TestSendQueueWatermarkCallbackReenter(t *testing.T) {
+	s := NewServer()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	// 对端不读取数据，高水位回调中再次发送并关闭链接不能死锁
+	c := newServerConn(s, serverConn, 1, "pipe")
+	assert.Nil(t, c.SetSendQueuePolicy(zconf.SendQueuePolicyDropNewest))
+	called := make(chan error, 1)
+	c.SetSendQueueWatermark(2, 0, func(conn ziface.IConnection, overHigh bool) {
+		if overHigh {
+			conn.Stop()
+			// 等待链接的释放流程开始获取msgLock写锁
+			time.Sleep(20 * time.Millisecond)
+			called <- conn.SendBuffMsg(2, []byte("slow down"))
+		}
+	})
+	go c.Start()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 4; i++ {
+			_ = c.SendBuffMsg(1, []byte("ping"))
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("watermark callback deadlocked")
+	}
+	assert.Equal(t, ErrSendQueueClosed, <-called)
+}
+
+func TestSendQueueDisconnectSlowConsumer(t *testing.T) {
+	s := NewServer()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	// 对端不读取数据，发送队列很快被填满
+	c := newServerConn(s, serverConn, 1, "pipe")
+	assert.Nil(t, c.SetSendQueuePolicy(zconf.SendQueuePolicyDisconnect))
+	go c.Start()
+
+	var err error
+	for i := 0; i <= c.GetSendQueueCap()+1 && err == nil; i++ {
+		err = c.SendBuffMsg(1, []byte("ping"))
+	}
+	assert.Equal(t, ErrSendQueueFull, err)
+
+	select {
+	case <-c.Context().Done():
+	case <-time.After(time.Second):
+		t.Fatal("slow consumer is not disconnected")
+	}
+}
+
+func TestSendQueueWriteLoopBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newSendQueue(&Connection{})
+	setTestSendQueueCap(q, 8)
+	q.init()
+	for i := 0; i < 3; i++ {
+		q.push(ctx, ctx, []byte{byte(i)}, ziface.SendPriorityNormal)
+	}
+
+	batches := make(chan [][]byte, 8)
+	go q.writeLoop(ctx, func(batch [][]byte) error {
+		copied := make([][]byte, len(batch))
+		copy(copied, batch)
+		batches <- copied
+		return nil
+	})
+
+	// 已入队的消息一次合并写出
+	assert.Equal(t, [][]byte{{0}, {1}, {2}}, <-batches)
+	assert.Nil(t, q.flush(ctx))
+	assert.Equal(t, 0, q.depth())
+
+	q.push(ctx, ctx, []byte{3}, ziface.SendPriorityNormal)
+	assert.Nil(t, q.flush(ctx))
+	assert.Equal(t, [][]byte{{3}}, <-batches)
+	assert.Equal(t, 0, q.depth())
+}
+
+func TestSendQueueFlushWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newSendQueue(&Connection{})
+	setTestSendQueueCap(q, 8)
+	q.flushWindow = 50 * time.Millisecond
+	q.init()
+
+	batches := make(chan int, 8)
+	go q.writeLoop(ctx, func(batch [][]byte) error {
+		batches <- len(batch)
+		return nil
+	})
+
+	// 窗口内陆续到达的消息合并为一批
+	q.push(ctx, ctx, []byte{0}, ziface.SendPriorityNormal)
+	time.Sleep(10 * time.Millisecond)
+	q.push(ctx, ctx, []byte{1}, ziface.SendPriorityNormal)
+	assert.Equal(t, 2, <-batches)
+
+	// Flush不等待窗口结束
+	q.push(ctx, ctx, []byte{2}, ziface.SendPriorityNormal)
+	start := time.Now()
+	assert.Nil(t, q.flush(ctx))
+	assert.Less(t, time.Since(start), q.flushWindow)
+	assert.Equal(t, 1, <-batches)
+}
+
+func TestConnectionFlush(t *testing.T) {
+	s := NewServer()
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	c := newServerConn(s, serverConn, 1, "pipe")
+	go c.Start()
+	defer c.Stop()
+
+	received := make(chan int, 1)
+	go func() {
+		buf := make([]byte, 1024)
+		total := 0
+		for total < 3*(8+4) {
+			n, err := clientConn.Read(buf)
+			if err != nil {
+				break
+			}
+			total += n
+		}
+		received <- total
+	}()
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, c.SendBuffMsg(1, []byte("ping")))
+	}
+	assert.Nil(t, c.Flush())
+	assert.Equal(t, 0, c.GetSendQueueLen())
+	assert.Equal(t, 3*(8+4), <-received)
+}
+
+func TestSendQueuePriority(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	q := newSendQueue(&Connection{})
+	setTestSendQueueCap(q, 4)
+	q.lanes[ziface.SendPriorityHigh].capacity = 1
+	q.init()
+	assert.Nil(t, q.setPolicy(zconf.SendQueuePolicyDropNewest))
+
+	q.push(ctx, ctx, []byte{0}, ziface.SendPriorityLow)
+	q.push(ctx, ctx, []byte{1}, ziface.SendPriorityNormal)
+	q.push(ctx, ctx, []byte{2}, ziface.SendPriorityLow)
+	q.push(ctx, ctx, []byte{3}, ziface.SendPriorityHigh)
+	_, _, err := q.push(ctx, ctx, []byte{4}, ziface.SendPriorityHigh)
+	assert.Equal(t, ErrSendQueueFull, err)
+	_, _, err = q.push(ctx, ctx, []byte{5}, ziface.SendPriority(ziface.SendPriorityNum))
+	assert.Equal(t, ErrSendQueuePriority, err)
+	assert.Equal(t, 9, q.capacity())
+
+	batches := make(chan [][]byte, 1)
+	go q.writeLoop(ctx, func(batch [][]byte) error {
+		copied := make([][]byte, len(batch))
+		copy(copied, batch)
+		batches <- copied
+		return nil
+	})
+
+	// 高优先级通道先写出，同一通道内保持入队顺序
+	assert.Equal(t, [][]byte{{3}, {1}, {0}, {2}}, <-batches)
+	assert.Nil(t, q.flush(ctx))
+
+	stats := q.stats()
+	assert.Equal(t, ziface.SendLaneStats{Priority: ziface.SendPriorityHigh, Cap: 1, Enqueued: 1, Sent: 1, Dropped: 1}, stats[ziface.SendPriorityHigh])
+	assert.Equal(t, ziface.SendLaneStats{Priority: ziface.SendPriorityLow, Cap: 4, Enqueued: 2, Sent: 2}, stats[ziface.SendPriorityLow])
+	assert.Equal(t, 0, q.depth())
+}
@@ -1,18 +1,22 @@
 package znet
 
 import (
-	"crypto/rand"
+	"context"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
+	"github.com/xtaci/kcp-go"
+	"io"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"sync/atomic"
 	"syscall"
 	"time"
+	"zinx_server/zinx/zcodec"
 	"zinx_server/zinx/zconf"
 	"zinx_server/zinx/zdecoder"
 	"zinx_server/zinx/ziface"
@@ -20,6 +24,13 @@ import (
 	"zinx_server/zinx/zpack"
 )
 
+const (
+	// 优雅关闭时检查链接是否处理完毕的间隔
+	shutdownPollInterval = 10 * time.Millisecond
+	// 通过WebsocketHandler挂载到用户http服务中升级的链接所属的监听器名称
+	mountedWebsocketListenerName = "websocket://mounted"
+)
+
 // iServer的接口实现，定义一个Server的服务器模块
 type Server struct {
 	// Name of the server (服务器的名称)
@@ -34,12 +45,19 @@ type Server struct {
 	WsPort int
 	// 服务绑定的kcp 端口 (kcp port the server is bound to)
 	KcpPort int
+	// 服务绑定的udp 端口 (udp port the server is bound to)
+	UdpPort int
+	// 服务绑定的unix domain socket路径 (unix socket path the server is bound to)
+	UnixSocketPath string
+	// 服务同时开启的监听器列表，为空则按照Mode开启 (listeners the server is bound to)
+	Listeners []zconf.ListenerConfig
 
 	// Current server's message handler module, used to bind MsgID to corresponding processing methods
 	// (当前Server的消息管理模块，用来绑定MsgID和对应的处理方法)
 	msgHandler ziface.IMsgHandle
 
 	// Routing mode (路由模式)
+	// 只决定心跳、会话等内置路由的注册方式，AddRouter与AddRouterSlices可以在同一个Server中按msgID混合使用
 	RouterSlicesMode bool
 
 	// Current server's connection manager (当前Server的链接管理器)
@@ -53,13 +71,31 @@ type Server struct {
 	// (该Server的连接断开时的Hook函数)
 	onConnStop func(conn ziface.IConnection)
 
+	// 连接即将关闭时的Hook函数
+	onConnBeforeClose func(conn ziface.IConnection)
+
+	// 连接从ConnManager中移除后的Hook函数
+	onConnRemoved func(conn ziface.IConnection)
+
+	// 链接的缓冲发送队列越过高/低水位线时的Hook函数
+	onSendQueueWatermark func(conn ziface.IConnection, overHigh bool)
+
 	// Data packet encapsulation method
 	// (数据报文封包方式)
 	packet ziface.IDataPack
 
+	// 带类型的路由默认使用的消息编解码器
+	codec ziface.ICodec
+
 	// Asynchronous capture of connection closing status
-	// (异步捕获链接关闭状态)
+	// (异步捕获链接关闭状态，关闭该管道即通知所有监听器退出)
 	exitChan chan struct{}
+	exitOnce sync.Once
+
+	// Goodbye message sent to every connection on Shutdown
+	// (优雅关闭时发送给每个链接的告别消息)
+	goodbyeMsgID uint32
+	goodbyeMsg   []byte
 
 	// Decoder for dealing with message fragmentation and reassembly
 	// (断粘包解码器)
@@ -69,18 +105,37 @@ type Server struct {
 	// (心跳检测器)
 	hc ziface.IHeartbeatChecker
 
+	// 会话管理器，调用StartSession之后开启
+	sessionMgr *SessionManager
+
 	// websocket
 	upgrader *websocket.Upgrader
 
 	// websocket connection authentication
 	websocketAuth func(r *http.Request) error
 
+	// websocket监听器上非升级请求的处理器 (handler for non-websocket requests on websocket listeners)
+	httpHandler http.Handler
+
 	// connection id
 	cID uint64
+
+	// reactor网络模型，为空则每个链接使用读goroutine (epoll reactor, nil in goroutine net mode)
+	reactor *reactor
+
+	// 当前开启的监听套接字，热重启时交接给新进程 (listening sockets handed over on hot restart)
+	sockets     map[string]inheritableSocket
+	socketsLock sync.Mutex
+	// Start开启的监听器数量以及已经开启的数量，全部开启后关闭listenersReady
+	listenerCount  int
+	listenerOpened int
+	listenersReady chan struct{}
+	// Start时预先加载的各监听器TLS配置 (listener name -> tls config)
+	tlsConfigs map[string]*tls.Config
 }
 
 // (根据config创建一个服务器句柄)
-func newServerWithConfig(config *zconf.Config, ipVersion string, opts ...Option) ziface.IServer {
+func newServerWithConfig(config *zconf.Config, ipVersion string, opts ...Option) *Server {
 	s := &Server{
 		Name:             config.Name,
 		IPVersion:        ipVersion,
@@ -88,13 +143,17 @@ func newServerWithConfig(config *zconf.Config, ipVersion string, opts ...Option)
 		Port:             config.TCPPort,
 		WsPort:           config.WsPort,
 		KcpPort:          config.KcpPort,
+		UdpPort:          config.UdpPort,
+		UnixSocketPath:   config.UnixSocketPath,
+		Listeners:        config.Listeners,
 		msgHandler:       newMsgHandle(),
 		RouterSlicesMode: config.RouterSlicesMode,
 		ConnMgr:          NewConnManager(),
-		exitChan:         nil,
+		exitChan:         make(chan struct{}),
 
 		packet:  zpack.Factory().NewPack(ziface.ZinxDataPack),
 		decoder: zdecoder.NewTLVDecoder(), // Default to using TLV decode (默认使用TLV的解码方式)
+		codec:   zcodec.NewJSONCodec(),
 		upgrader: &websocket.Upgrader{
 			ReadBufferSize: int(config.IOReadBuffSize),
 			CheckOrigin: func(r *http.Request) bool {
@@ -127,8 +186,8 @@ func NewUserConfServer(config *zconf.Config, opts ...Option) ziface.IServer {
 
 // 创建一个默认自带一个Recover处理器的服务器句柄
 func NewDefaultRouterSlicesServer(opts ...Option) ziface.IServer {
-	zconf.GlobalObject.RouterSlicesMode = true
 	s := newServerWithConfig(zconf.GlobalObject, "tcp", opts...)
+	s.RouterSlicesMode = true
 	s.Use(RouterRecovery)
 	return s
 }
@@ -161,84 +220,151 @@ func (s *Server) StartConn(conn ziface.IConnection) {
 	conn.Start()
 }
 
-func (s *Server) ListenTcpConn() {
+func (s *Server) ListenTcpConn(lc *zconf.ListenerConfig) {
 	// 1. 获取TCP地址
-	addr, err := net.ResolveTCPAddr(s.IPVersion, fmt.Sprintf("%s:%d", s.IP, s.Port))
+	addr, err := net.ResolveTCPAddr(s.IPVersion, lc.Addr())
 	if err != nil {
 		zlog.Ins().ErrorF("[Start] resolve tcp addr err: %v\n", err)
 		return
 	}
 
-	// 2. 监听TCP
-	var listener net.Listener
-	if zconf.GlobalObject.CertFile != "" && zconf.GlobalObject.PrivateKeyFile != "" {
-		// 读取cerf和key (SSL)
-		crt, err := tls.LoadX509KeyPair(zconf.GlobalObject.CertFile, zconf.GlobalObject.PrivateKeyFile)
+	// 2. 监听TCP，热重启时优先使用父进程交接的监听器
+	listenerName := lc.GetName()
+	var tcpListener *net.TCPListener
+	inherited, ok, err := inheritedListener(listenerName)
+	if err != nil {
+		panic(err)
+	}
+	if ok {
+		if tcpListener, ok = inherited.(*net.TCPListener); !ok {
+			panic(fmt.Sprintf("inherited listener %s is not a tcp listener", listenerName))
+		}
+	} else {
+		tcpListener, err = net.ListenTCP(s.IPVersion, addr)
 		if err != nil {
 			panic(err)
 		}
+	}
+	s.trackSocket(listenerName, tcpListener)
 
-		// TLS connection
-		tlsConfig := &tls.Config{}
-		tlsConfig.Certificates = []tls.Certificate{crt}
-		tlsConfig.Time = time.Now
-		tlsConfig.Rand = rand.Reader
-		listener, err = tls.Listen(s.IPVersion, fmt.Sprintf("%s:%d", s.IP, s.Port), tlsConfig)
+	var listener net.Listener = tcpListener
+	if lc.ProxyProtocol {
+		// PROXY头在TLS握手之前，需要先于TLS解析
+		listener, err = newProxyProtoListener(listener, lc.ProxyProtocolTrusted)
 		if err != nil {
 			panic(err)
 		}
-	} else {
-		listener, err = net.ListenTCP(s.IPVersion, addr)
+	}
+	if lc.UseTLS() {
+		// 读取cerf和key (SSL)，证书更新后自动重新加载
+		tlsConfig, err := s.listenerTLSConfig(lc)
 		if err != nil {
-			panic(err)
+			zlog.Ins().ErrorF("[Start] listener %s load tls config err: %v\n", listenerName, err)
+			_ = listener.Close()
+			return
 		}
+
+		// TLS connection
+		listener = tls.NewListener(listener, tlsConfig)
 	}
 
 	// 3. 启动服务端业务
-	go func() {
-		for {
-			// 3.1 设置服务器最大连接控制，如果超过最大连接，则等待
-			// TODO 高并发限流策略
-			if s.ConnMgr.Len() >= zconf.GlobalObject.MaxConn {
-				zlog.Ins().InfoF("Exceeded the maxConnNum:%d, Wait:%d", zconf.GlobalObject.MaxConn, AcceptDelay.duration)
-				AcceptDelay.Delay()
-				continue
-			}
-			// 3.2 阻塞等待客户端建立连接请求
-			conn, err := listener.Accept()
-			if err != nil {
-				if errors.Is(err, net.ErrClosed) {
-					zlog.Ins().ErrorF("Listener closed")
-					return
-				}
-				zlog.Ins().ErrorF("Accept err: %v", err)
-				AcceptDelay.Delay()
-				continue
+	go s.serveListener(listener, listenerName)
+	select {
+	case <-s.exitChan:
+		err := listener.Close()
+		if err != nil {
+			zlog.Ins().ErrorF("listener close err: %v", err)
+		}
+	}
+}
+
+// 阻塞接收listener上的新连接并为其启动Connection，直到listener被关闭
+func (s *Server) serveListener(listener net.Listener, listenerName string) {
+	for {
+		// 1 设置服务器最大连接控制，如果超过最大连接，则等待
+		// TODO 高并发限流策略
+		if s.ConnMgr.Len() >= zconf.GlobalObject.MaxConn {
+			zlog.Ins().InfoF("Exceeded the maxConnNum:%d, Wait:%d", zconf.GlobalObject.MaxConn, AcceptDelay.Duration())
+			AcceptDelay.Delay()
+			continue
+		}
+		// 2 阻塞等待客户端建立连接请求
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				zlog.Ins().ErrorF("Listener %s closed", listenerName)
+				return
 			}
+			zlog.Ins().ErrorF("Accept err: %v", err)
+			AcceptDelay.Delay()
+			continue
+		}
 
-			AcceptDelay.Reset()
+		AcceptDelay.Reset()
 
-			// 处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn是绑定的
-			newCid := atomic.AddUint64(&s.cID, 1)
-			dealConn := newServerConn(s, conn, newCid)
+		// 3 处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn是绑定的
+		newCid := atomic.AddUint64(&s.cID, 1)
+		dealConn := newServerConn(s, conn, newCid, listenerName)
+		if s.reactor != nil && reactorSupported(conn) {
+			dealConn.reactor = s.reactor
+		}
 
-			go s.StartConn(dealConn)
+		go s.StartConn(dealConn)
+	}
+}
+
+func (s *Server) ListenUnixConn(lc *zconf.ListenerConfig) {
+	// 1. 解析socket文件权限
+	perm, err := lc.UnixSocketFileMode()
+	if err != nil {
+		zlog.Ins().ErrorF("[Start] parse unix socket perm err: %v\n", err)
+		return
+	}
+
+	// 2. 监听unix domain socket，热重启时优先使用父进程交接的监听器
+	listenerName := lc.GetName()
+	var listener *net.UnixListener
+	inherited, ok, err := inheritedListener(listenerName)
+	if err != nil {
+		panic(err)
+	}
+	if ok {
+		if listener, ok = inherited.(*net.UnixListener); !ok {
+			panic(fmt.Sprintf("inherited listener %s is not a unix listener", listenerName))
 		}
-	}()
+		// socket文件由父进程创建，当前进程退出时负责删除
+		listener.SetUnlinkOnClose(true)
+	} else {
+		listener, err = listenUnix(lc.UnixSocketPath, perm)
+		if err != nil {
+			panic(err)
+		}
+	}
+	s.trackSocket(listenerName, listener)
+
+	// 3. 启动服务端业务，unix socket连接与TCP连接共用Connection
+	go s.serveListener(listener, listenerName)
 	select {
 	case <-s.exitChan:
 		err := listener.Close()
 		if err != nil {
-			zlog.Ins().ErrorF("listener close err: %v", err)
+			zlog.Ins().ErrorF("unix listener close err: %v", err)
 		}
 	}
 }
 
-func (s *Server) ListenWebsocketConn() {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+// 创建websocket升级处理器，由该处理器升级的链接记录为来自listenerName监听器
+func (s *Server) newWebsocketHandler(listenerName string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		//0. 非websocket升级请求交给用户挂载的http.Handler处理
+		if s.httpHandler != nil && !websocket.IsWebSocketUpgrade(r) {
+			s.httpHandler.ServeHTTP(w, r)
+			return
+		}
 		//1. 设置服务器最大连接限制，如果超过最大连接，则等待
 		if s.ConnMgr.Len() >= zconf.GlobalObject.MaxConn {
-			zlog.Ins().InfoF("Exceeded the maxConnNum:%d, Wait:%d", zconf.GlobalObject.MaxConn, AcceptDelay.duration)
+			zlog.Ins().InfoF("Exceeded the maxConnNum:%d, Wait:%d", zconf.GlobalObject.MaxConn, AcceptDelay.Duration())
 			AcceptDelay.Delay()
 			return
 		}
@@ -252,13 +378,16 @@ func (s *Server) ListenWebsocketConn() {
 				return
 			}
 		}
-		//3. 判断 header里是有子协议
+		//3. 判断 header里是有子协议，使用当前请求的子协议协商，不修改共享的upgrader
+		upgrader := s.upgrader
 		if len(r.Header.Get("Sec-Websocket-Protocol")) > 0 {
-			s.upgrader.Subprotocols = websocket.Subprotocols(r)
+			reqUpgrader := *s.upgrader
+			reqUpgrader.Subprotocols = websocket.Subprotocols(r)
+			upgrader = &reqUpgrader
 		}
 
 		//4. 升级为websocket连接
-		conn, err := s.upgrader.Upgrade(w, r, nil)
+		conn, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			zlog.Ins().ErrorF("new websocket err:%v", err)
 			w.WriteHeader(500)
@@ -269,24 +398,284 @@ func (s *Server) ListenWebsocketConn() {
 
 		//5. 处理该新连接请求的业务方法， 此时应该有 handler 和 conn 是绑定的
 		newCid := atomic.AddUint64(&s.cID, 1)
-		wsConn := newWebsocketConn(s, conn, newCid)
+		wsConn := newWebsocketConn(s, conn, newCid, listenerName)
 		go s.StartConn(wsConn)
-	})
+	}
+}
 
-	err := http.ListenAndServe(fmt.Sprintf("%s:%d", s.IP, s.WsPort), nil)
+// 获取websocket升级处理器，用于挂载到用户已有的http服务中
+// 需要先调用Start启动worker工作池，由该处理器升级的链接监听器名称为mountedWebsocketListenerName
+func (s *Server) WebsocketHandler() http.Handler {
+	return s.newWebsocketHandler(mountedWebsocketListenerName)
+}
+
+func (s *Server) ListenWebsocketConn(lc *zconf.ListenerConfig) {
+	listenerName := lc.GetName()
+
+	// 每个websocket监听器使用各自的ServeMux和http.Server，同一进程中可以开启多个Server
+	mux := http.NewServeMux()
+	wsPath := lc.GetWsPath()
+	mux.Handle(wsPath, s.newWebsocketHandler(listenerName))
+	if s.httpHandler != nil && wsPath != "/" {
+		mux.Handle("/", s.httpHandler)
+	}
+
+	// 热重启时优先使用父进程交接的监听器
+	listener, ok, err := inheritedListener(listenerName)
 	if err != nil {
 		panic(err)
 	}
+	if !ok {
+		listener, err = net.Listen("tcp", lc.Addr())
+		if err != nil {
+			panic(err)
+		}
+	}
+	sock, _ := listener.(inheritableSocket)
+	s.trackSocket(listenerName, sock)
+	httpServer := &http.Server{Handler: mux}
+	if lc.UseTLS() {
+		tlsConfig, err := s.listenerTLSConfig(lc)
+		if err != nil {
+			zlog.Ins().ErrorF("[Start] listener %s load tls config err: %v\n", listenerName, err)
+			_ = listener.Close()
+			return
+		}
+		httpServer.TLSConfig = tlsConfig
+	}
+
+	go func() {
+		var err error
+		if lc.UseTLS() {
+			// wss://
+			err = httpServer.ServeTLS(listener, "", "")
+		} else {
+			err = httpServer.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			zlog.Ins().ErrorF("websocket listener %s serve err: %v", listenerName, err)
+		}
+	}()
+	select {
+	case <-s.exitChan:
+		// 已经升级为websocket的链接不受影响，由ConnManager负责关闭
+		// 等待正在处理的普通http请求结束，超时后强制关闭
+		ctx, cancel := context.WithTimeout(context.Background(), zconf.GlobalObject.ShutdownTimeoutDuration())
+		defer cancel()
+		if err := httpServer.Shutdown(ctx); err != nil {
+			zlog.Ins().ErrorF("websocket listener %s shutdown err: %v", listenerName, err)
+			_ = httpServer.Close()
+		}
+	}
 }
 
-func (s *Server) ListenKcpConn() {
+func (s *Server) ListenKcpConn(lc *zconf.ListenerConfig) {
+	listenerName := lc.GetName()
+
+	// 1. 监听KCP(基于UDP)，热重启时优先使用父进程交接的UDP套接字
+	udpConn, err := s.listenPacket(lc)
+	if err != nil {
+		panic(err)
+	}
+	listener, err := kcp.ServeConn(
+		nil,
+		zconf.GlobalObject.KcpFecDataShards,
+		zconf.GlobalObject.KcpFecParityShards,
+		udpConn,
+	)
+	if err != nil {
+		panic(err)
+	}
 
+	// 2. 启动服务端业务
+	go func() {
+		for {
+			// 2.1 设置服务器最大连接控制，如果超过最大连接，则等待
+			if s.ConnMgr.Len() >= zconf.GlobalObject.MaxConn {
+				zlog.Ins().InfoF("Exceeded the maxConnNum:%d, Wait:%d", zconf.GlobalObject.MaxConn, AcceptDelay.Duration())
+				AcceptDelay.Delay()
+				continue
+			}
+			// 2.2 阻塞等待客户端建立KCP会话
+			sess, err := listener.AcceptKCP()
+			if err != nil {
+				if errors.Is(err, io.ErrClosedPipe) {
+					zlog.Ins().ErrorF("Kcp Listener %s closed", listenerName)
+					return
+				}
+				zlog.Ins().ErrorF("Kcp Accept err: %v", err)
+				AcceptDelay.Delay()
+				continue
+			}
+
+			AcceptDelay.Reset()
+
+			// 2.3 KCP会话实现了net.Conn，按配置调整参数后直接复用Connection
+			setKcpSessionOptions(sess)
+
+			newCid := atomic.AddUint64(&s.cID, 1)
+			dealConn := newServerConn(s, sess, newCid, listenerName)
+
+			go s.StartConn(dealConn)
+		}
+	}()
+	select {
+	case <-s.exitChan:
+		err := listener.Close()
+		if err != nil {
+			zlog.Ins().ErrorF("kcp listener close err: %v", err)
+		}
+	}
 }
 
-// 启动服务器
-func (s *Server) Start() {
-	zlog.Ins().InfoF("[Zinx] Serve Name : %s, Serve Listener at IP: %s, Port: %d\n",
-		s.Name, s.IP, s.Port)
+func (s *Server) ListenUdpConn(lc *zconf.ListenerConfig) {
+	listenerName := lc.GetName()
+
+	// 1. 监听UDP，所有对端共用一个套接字，热重启时优先使用父进程交接的套接字
+	udpConn, err := s.listenPacket(lc)
+	if err != nil {
+		panic(err)
+	}
+	listener := newUdpListener(udpConn, zconf.GlobalObject.UdpIdleTimeoutDuration())
+	go listener.startIdleChecker()
+
+	// 2. 启动服务端业务
+	go func() {
+		buffer := make([]byte, udpMaxDatagramSize)
+		for {
+			// 2.1 阻塞等待任意对端的数据报
+			n, remoteAddr, err := udpConn.ReadFromUDP(buffer)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					zlog.Ins().ErrorF("Udp Listener %s closed", listenerName)
+					return
+				}
+				zlog.Ins().ErrorF("Udp Read err: %v", err)
+				continue
+			}
+
+			// 2.2 新的对端地址，为其创建一个虚拟连接
+			peer, ok := listener.lookup(remoteAddr)
+			if !ok {
+				// 超过最大连接数，直接丢弃该数据报
+				if s.ConnMgr.Len() >= zconf.GlobalObject.MaxConn {
+					zlog.Ins().InfoF("Exceeded the maxConnNum:%d, drop datagram from %s", zconf.GlobalObject.MaxConn, remoteAddr)
+					continue
+				}
+				peer = listener.addPeer(remoteAddr)
+
+				newCid := atomic.AddUint64(&s.cID, 1)
+				dealConn := newServerConn(s, peer, newCid, listenerName)
+
+				go s.StartConn(dealConn)
+			}
+
+			// 2.3 将数据报投递给对应的虚拟连接
+			peer.deliver(buffer[:n])
+		}
+	}()
+	select {
+	case <-s.exitChan:
+		err := listener.Close()
+		if err != nil {
+			zlog.Ins().ErrorF("udp listener close err: %v", err)
+		}
+	}
+}
+
+// 监听kcp/udp监听器使用的UDP套接字，热重启时优先使用父进程交接的套接字
+func (s *Server) listenPacket(lc *zconf.ListenerConfig) (*net.UDPConn, error) {
+	listenerName := lc.GetName()
+
+	var udpConn *net.UDPConn
+	inherited, ok, err := inheritedPacketConn(listenerName)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if udpConn, ok = inherited.(*net.UDPConn); !ok {
+			return nil, fmt.Errorf("inherited packet conn %s is not a udp conn", listenerName)
+		}
+	} else {
+		addr, err := net.ResolveUDPAddr("udp", lc.Addr())
+		if err != nil {
+			return nil, err
+		}
+		udpConn, err = net.ListenUDP("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.trackSocket(listenerName, udpConn)
+	return udpConn, nil
+}
+
+// 按照监听器配置的传输方式开启监听
+func (s *Server) listen(lc *zconf.ListenerConfig) {
+	switch lc.Mode {
+	case zconf.ServerModeTcp:
+		s.ListenTcpConn(lc)
+	case zconf.ServerModeWebsocket:
+		s.ListenWebsocketConn(lc)
+	case zconf.ServerModeKcp:
+		s.ListenKcpConn(lc)
+	case zconf.ServerModeUdp:
+		s.ListenUdpConn(lc)
+	case zconf.ServerModeUnix:
+		s.ListenUnixConn(lc)
+	default:
+		zlog.Ins().ErrorF("[Start] listener %s unknown mode: %s", lc.GetName(), lc.Mode)
+	}
+}
+
+// 获取当前Server需要开启的所有监听器配置
+// 如果没有配置Listeners，则按照Mode以及Host/各端口配置生成
+func (s *Server) listenerConfigs() []zconf.ListenerConfig {
+	if len(s.Listeners) > 0 {
+		return s.Listeners
+	}
+
+	newListener := func(mode string, port int) zconf.ListenerConfig {
+		return zconf.ListenerConfig{
+			Mode:           mode,
+			Host:           s.IP,
+			Port:           port,
+			UnixSocketPath: s.UnixSocketPath,
+			UnixSocketPerm: zconf.GlobalObject.UnixSocketPerm,
+			CertFile:       zconf.GlobalObject.CertFile,
+			PrivateKeyFile: zconf.GlobalObject.PrivateKeyFile,
+
+			ClientCAFile:    zconf.GlobalObject.ClientCAFile,
+			ClientAuth:      zconf.GlobalObject.ClientAuth,
+			TLSMinVersion:   zconf.GlobalObject.TLSMinVersion,
+			TLSCipherSuites: zconf.GlobalObject.TLSCipherSuites,
+
+			ProxyProtocol:        zconf.GlobalObject.ProxyProtocol,
+			ProxyProtocolTrusted: zconf.GlobalObject.ProxyProtocolTrusted,
+		}
+	}
+
+	switch zconf.GlobalObject.Mode {
+	case zconf.ServerModeTcp:
+		return []zconf.ListenerConfig{newListener(zconf.ServerModeTcp, s.Port)}
+	case zconf.ServerModeWebsocket:
+		return []zconf.ListenerConfig{newListener(zconf.ServerModeWebsocket, s.WsPort)}
+	case zconf.ServerModeKcp:
+		return []zconf.ListenerConfig{newListener(zconf.ServerModeKcp, s.KcpPort)}
+	case zconf.ServerModeUdp:
+		return []zconf.ListenerConfig{newListener(zconf.ServerModeUdp, s.UdpPort)}
+	case zconf.ServerModeUnix:
+		return []zconf.ListenerConfig{newListener(zconf.ServerModeUnix, 0)}
+	default:
+		return []zconf.ListenerConfig{
+			newListener(zconf.ServerModeTcp, s.Port),
+			newListener(zconf.ServerModeWebsocket, s.WsPort),
+		}
+	}
+}
+
+// 添加解码器并启动worker工作池
+func (s *Server) startMsgHandler() {
 	zlog.Ins().InfoF("[Zinx] Version : %s, MaxConn: %d, MaxPackageSize: %d\n",
 		zconf.GlobalObject.Version,
 		zconf.GlobalObject.MaxConn,
@@ -299,73 +688,267 @@ func (s *Server) Start() {
 	// 启动worker工作池
 	s.msgHandler.StartWorkerPool()
 
-	// 开启一个goroutine去做服务端listener业务
-	switch zconf.GlobalObject.Mode {
-	case zconf.ServerModeTcp:
-		go s.ListenTcpConn()
-	case zconf.ServerModeWebsocket:
-		go s.ListenWebsocketConn()
-	case zconf.ServerModeKcp:
-		go s.ListenKcpConn()
-	default:
-		go s.ListenTcpConn()
-		go s.ListenWebsocketConn()
+	// reactor网络模型
+	s.startReactor()
+}
+
+// 启动服务器，监听器的TLS证书加载失败时返回错误，不开启任何监听器
+func (s *Server) Start() error {
+	zlog.Ins().InfoF("[Zinx] Serve Name : %s, Serve Listener at IP: %s, Port: %d\n",
+		s.Name, s.IP, s.Port)
+
+	configs := s.listenerConfigs()
+	tlsConfigs, err := s.loadTLSConfigs(configs)
+	if err != nil {
+		zlog.Ins().ErrorF("[Start] Zinx server name %s, %v", s.Name, err)
+		return err
+	}
+	s.tlsConfigs = tlsConfigs
+
+	s.startMsgHandler()
 
+	s.listenerCount = len(configs)
+	s.listenersReady = make(chan struct{})
+
+	// 热重启启动的新进程，所有监听器重建完成后通知父进程
+	if f, ok := takeReadyFile(); ok {
+		go s.notifyParentReady(f)
+	}
+
+	// 每个监听器开启一个goroutine去做服务端listener业务
+	for _, lc := range configs {
+		lc := lc
+		zlog.Ins().InfoF("[Zinx] Serve Name : %s, Start Listener %s", s.Name, lc.GetName())
+		go s.listen(&lc)
 	}
+	return nil
+}
+
+// 在调用方提供的监听器上启动服务器，不再按照配置开启监听器
+// 如测试中使用NewPipeListener创建的内存监听器，链接与TCP链接一样使用Connection
+func (s *Server) StartWithListener(listeners ...net.Listener) {
+	s.startMsgHandler()
+
+	for _, listener := range listeners {
+		listenerName := listener.Addr().Network() + "://" + listener.Addr().String()
+		zlog.Ins().InfoF("[Zinx] Serve Name : %s, Start Listener %s", s.Name, listenerName)
+
+		go s.serveListener(listener, listenerName)
+		go func(listener net.Listener) {
+			<-s.exitChan
+			if err := listener.Close(); err != nil {
+				zlog.Ins().ErrorF("listener close err: %v", err)
+			}
+		}(listener)
+	}
+}
+
+// 通知所有监听器停止接收新链接
+func (s *Server) closeListeners() {
+	s.exitOnce.Do(func() {
+		close(s.exitChan)
+	})
 }
 
 // 停止服务器
 func (s *Server) Stop() {
-	//TODO 将一些服务器的资源、状态或者一些已经开辟的链接信息，进行停止或者回收
 	zlog.Ins().InfoF("[STOP] Zinx server name %s", s.Name)
+	s.closeListeners()
 	s.ConnMgr.ClearConn()
-	s.exitChan <- struct{}{}
-	close(s.exitChan)
+	s.stopReactor()
+	if s.sessionMgr != nil {
+		s.sessionMgr.clear()
+	}
 }
 
-// 运行服务器
-func (s *Server) Serve() {
+// 优雅关闭服务器
+// 1. 停止接收新链接
+// 2. 如果设置了告别消息，给每个链接发送告别消息
+// 3. 等待正在处理的业务任务以及每个链接的缓冲发送队列清空
+// 4. 主动关闭剩余的链接并等待其退出
+// 在ctx结束之前未能完成，则强制关闭所有链接并返回ctx.Err()
+func (s *Server) Shutdown(ctx context.Context) error {
+	zlog.Ins().InfoF("[SHUTDOWN] Zinx server name %s", s.Name)
+	s.closeListeners()
+	defer func() {
+		s.stopReactor()
+		if s.sessionMgr != nil {
+			s.sessionMgr.clear()
+		}
+	}()
+
+	// 不再处理已有链接上新读取到的消息，否则繁忙的服务器永远无法排空
+	if mh, ok := s.msgHandler.(*MsgHandle); ok {
+		mh.stopAccepting()
+	}
+
+	if s.goodbyeMsg != nil {
+		for _, conn := range s.connSnapshot() {
+			// 先尝试放入缓冲队列，保证告别消息排在已有消息之后
+			if err := conn.SendBuffMsg(s.goodbyeMsgID, s.goodbyeMsg); err != nil {
+				_ = conn.SendMsg(s.goodbyeMsgID, s.goodbyeMsg)
+			}
+		}
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	waitUntil := func(done func() bool) error {
+		for !done() {
+			select {
+			case <-ctx.Done():
+				zlog.Ins().ErrorF("[SHUTDOWN] Zinx server name %s, force close %d connections: %v", s.Name, s.ConnMgr.Len(), ctx.Err())
+				s.ConnMgr.ClearConn()
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		return nil
+	}
+
+	if err := waitUntil(s.isDrained); err != nil {
+		return err
+	}
+
+	for _, conn := range s.connSnapshot() {
+		conn.StopWithReason(ziface.CloseReasonServerStop, nil)
+	}
+
+	return waitUntil(func() bool {
+		return s.ConnMgr.Len() == 0
+	})
+}
+
+// 获取当前所有链接的快照
+// 不能在ConnMgr.Range的回调中关闭链接，reactor模式下链接会同步调用ConnMgr.Remove，而Range持有分片锁
+func (s *Server) connSnapshot() []ziface.IConnection {
+	conns := make([]ziface.IConnection, 0, s.ConnMgr.Len())
+	_ = s.ConnMgr.Range(func(connID uint64, conn ziface.IConnection, _ interface{}) error {
+		conns = append(conns, conn)
+		return nil
+	}, nil)
+	return conns
+}
+
+// 优雅关闭时用于判断链接的缓冲发送队列是否已清空，Connection和WsConnection实现了该接口
+type sendQueueDrainer interface {
+	pendingSendCount() int
+}
+
+var (
+	_ sendQueueDrainer = (*Connection)(nil)
+	_ sendQueueDrainer = (*WsConnection)(nil)
+)
+
+// 所有已投递的业务任务均已处理完毕，且所有链接的缓冲发送队列均已清空
+func (s *Server) isDrained() bool {
+	if s.msgHandler.GetInFlightTaskCount() > 0 {
+		return false
+	}
+
+	drained := true
+	_ = s.ConnMgr.Range(func(connID uint64, conn ziface.IConnection, _ interface{}) error {
+		if q, ok := conn.(sendQueueDrainer); ok && q.pendingSendCount() > 0 {
+			drained = false
+		}
+		return nil
+	}, nil)
+	return drained
+}
+
+// 运行服务器，启动失败时直接返回错误
+func (s *Server) Serve() error {
 	//启动server的服务功能
-	s.Start()
+	if err := s.Start(); err != nil {
+		return err
+	}
 
 	// 阻塞，否则主Go退出，listenner的go将会退出
 	c := make(chan os.Signal, 1)
-	// 监听指定信号 ctrl+c kill信号
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-	sig := <-c
-	zlog.Ins().InfoF("[SERVE] Zinx server , name %s, Serve Interrupt, signal = %v", s.Name, sig)
+	// 监听指定信号 ctrl+c kill信号，以及热重启信号
+	signal.Notify(c, append([]os.Signal{syscall.SIGINT, syscall.SIGTERM}, hotRestartSignals...)...)
+	for {
+		sig := <-c
+		zlog.Ins().InfoF("[SERVE] Zinx server , name %s, Serve Interrupt, signal = %v", s.Name, sig)
+
+		if !isHotRestartSignal(sig) {
+			break
+		}
+		// 热重启：新进程接管监听套接字并就绪后，当前进程优雅退出；新进程未能就绪则继续提供服务
+		if err := s.forkChild(); err != nil {
+			zlog.Ins().ErrorF("[SERVE] Zinx server , name %s, hot restart err: %v", s.Name, err)
+			continue
+		}
+		break
+	}
+
+	// 优雅关闭，最多等待ShutdownTimeout
+	ctx, cancel := context.WithTimeout(context.Background(), zconf.GlobalObject.ShutdownTimeoutDuration())
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		zlog.Ins().ErrorF("[SERVE] Zinx server , name %s, Shutdown err: %v", s.Name, err)
+	}
+	return nil
+}
+
+func isHotRestartSignal(sig os.Signal) bool {
+	for _, s := range hotRestartSignals {
+		if sig == s {
+			return true
+		}
+	}
+	return false
 }
 
 // 路由功能：给当前的服务注册一个路由方法，供客户端的链接处理使用
 func (s *Server) AddRouter(msgID uint32, router ziface.IRouter) {
-	if s.RouterSlicesMode {
-		panic("Serve RouterSlicesMode is TRUE!! ")
-	}
 	s.msgHandler.AddRouter(msgID, router)
 	zlog.Ins().InfoF("Add Router [MsgID = %v] Successed!", msgID)
 }
 
 func (s *Server) AddRouterSlices(msgId uint32, router ...ziface.RouterHandler) ziface.IRouterSlices {
-	if !s.RouterSlicesMode {
-		panic("Serve RouterSlicesMode is FALSE!! ")
-	}
 	return s.msgHandler.AddRouterSlices(msgId, router...)
 }
 
 func (s *Server) Group(start, end uint32, Handlers ...ziface.RouterHandler) ziface.IGroupRouterSlices {
-	if !s.RouterSlicesMode {
-		panic("Serve RouterSlicesMode is FALSE!! ")
-	}
 	return s.msgHandler.Group(start, end, Handlers...)
 }
 
 func (s *Server) Use(Handlers ...ziface.RouterHandler) ziface.IRouterSlices {
-	if !s.RouterSlicesMode {
-		panic("Serve RouterSlicesMode is FALSE!! ")
-	}
 	return s.msgHandler.Use(Handlers...)
 }
 
+// 运行期间移除msgID绑定的路由
+func (s *Server) RemoveRouter(msgID uint32) bool {
+	return s.msgHandler.RemoveRouter(msgID)
+}
+
+// 运行期间将msgID绑定到router，替换已经绑定的路由
+func (s *Server) ReplaceRouter(msgID uint32, router ziface.IRouter) {
+	s.msgHandler.ReplaceRouter(msgID, router)
+}
+
+// 运行期间将msgID绑定到路由切片，替换已经绑定的路由
+func (s *Server) ReplaceRouterSlices(msgID uint32, handlers ...ziface.RouterHandler) {
+	s.msgHandler.ReplaceRouterSlices(msgID, handlers...)
+}
+
+// 获取所有已注册的路由信息
+func (s *Server) GetRoutes() []ziface.RouteInfo {
+	return s.msgHandler.GetRoutes()
+}
+
+// 设置收到没有绑定路由的msgID时的处理函数
+func (s *Server) SetNotFoundHandler(handler ziface.NotFoundHandler) {
+	s.msgHandler.SetNotFoundHandler(handler)
+}
+
+// 设置路由处理发生panic或者报告错误时的处理函数
+func (s *Server) SetErrorHandler(handler ziface.ErrorHandler) {
+	s.msgHandler.SetErrorHandler(handler)
+}
+
 // 获取当前server的连接管理器
 func (s *Server) GetConnMgr() ziface.IConnManager {
 	return s.ConnMgr
@@ -391,6 +974,38 @@ func (s *Server) GetOnConnStop() func(ziface.IConnection) {
 	return s.onConnStop
 }
 
+// 注册连接即将关闭时的Hook函数，在链接的读写goroutine退出之前调用
+// 此时仍可以通过SendMsg/SendBuffMsg发送最后的消息，并通过Flush等待发送完成，关闭原因见GetCloseReason
+func (s *Server) SetOnConnBeforeClose(hookFunc func(connection ziface.IConnection)) {
+	s.onConnBeforeClose = hookFunc
+}
+
+// 得到该Server的连接即将关闭时的Hook函数
+func (s *Server) GetOnConnBeforeClose() func(ziface.IConnection) {
+	return s.onConnBeforeClose
+}
+
+// 注册连接关闭并从ConnManager中移除后的Hook函数
+func (s *Server) SetOnConnRemoved(hookFunc func(connection ziface.IConnection)) {
+	s.onConnRemoved = hookFunc
+}
+
+// 得到该Server的连接从ConnManager中移除后的Hook函数
+func (s *Server) GetOnConnRemoved() func(ziface.IConnection) {
+	return s.onConnRemoved
+}
+
+// 注册缓冲发送队列水位线Hook函数，水位线由SendQueueHighWatermark/SendQueueLowWatermark配置
+// 队列长度达到高水位线时overHigh为true，之后回落到低水位线时overHigh为false
+func (s *Server) SetOnSendQueueWatermark(hookFunc func(conn ziface.IConnection, overHigh bool)) {
+	s.onSendQueueWatermark = hookFunc
+}
+
+// 得到该Server的缓冲发送队列水位线Hook函数
+func (s *Server) GetOnSendQueueWatermark() func(ziface.IConnection, bool) {
+	return s.onSendQueueWatermark
+}
+
 func (s *Server) GetPacket() ziface.IDataPack {
 	return s.packet
 }
@@ -399,6 +1014,14 @@ func (s *Server) SetPacket(packet ziface.IDataPack) {
 	s.packet = packet
 }
 
+func (s *Server) GetCodec() ziface.ICodec {
+	return s.codec
+}
+
+func (s *Server) SetCodec(codec ziface.ICodec) {
+	s.codec = codec
+}
+
 func (s *Server) GetMsgHandler() ziface.IMsgHandle {
 	return s.msgHandler
 }
@@ -448,6 +1071,28 @@ func (s *Server) StartHeartBeatWithOption(interval time.Duration, option *ziface
 	s.hc = checker
 }
 
+// 开启会话层
+func (s *Server) StartSession(gracePeriod time.Duration) {
+	s.sessionMgr = newSessionManager(gracePeriod)
+
+	//添加会话层的路由
+	if s.RouterSlicesMode {
+		s.AddRouterSlices(ziface.SessionResumeMsgID, s.sessionMgr.handleResume)
+		s.AddRouterSlices(ziface.SessionAckMsgID, s.sessionMgr.handleAck)
+	} else {
+		s.AddRouter(ziface.SessionResumeMsgID, &sessionResumeRouter{mgr: s.sessionMgr})
+		s.AddRouter(ziface.SessionAckMsgID, &sessionAckRouter{mgr: s.sessionMgr})
+	}
+}
+
+// 获取会话管理器
+func (s *Server) GetSessionMgr() ziface.ISessionManager {
+	if s.sessionMgr == nil {
+		return nil
+	}
+	return s.sessionMgr
+}
+
 func (s *Server) GetLengthField() *ziface.LengthField {
 	if s.decoder != nil {
 		return s.decoder.GetLengthField()
@@ -463,10 +1108,21 @@ func (s *Server) AddInterceptor(interceptor ziface.IInterceptor) {
 	s.msgHandler.AddInterceptor(interceptor)
 }
 
+// 设置优雅关闭时发送给每个链接的告别消息
+func (s *Server) SetGoodbyeMsg(msgID uint32, data []byte) {
+	s.goodbyeMsgID = msgID
+	s.goodbyeMsg = data
+}
+
 func (s *Server) SetWebsocketAuth(f func(r *http.Request) error) {
 	s.websocketAuth = f
 }
 
+// 设置websocket监听器上非websocket升级请求的处理器
+func (s *Server) SetHttpHandler(handler http.Handler) {
+	s.httpHandler = handler
+}
+
 func (s *Server) ServerName() string {
 	return s.Name
 }
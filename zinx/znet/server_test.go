@@ -1,12 +1,15 @@
 package znet
 
 import (
+	"context"
 	"fmt"
+	"github.com/stretchr/testify/assert"
 	"io"
 	"net"
 	"sync"
 	"testing"
 	"time"
+	"zinx_server/zinx/zconf"
 	"zinx_server/zinx/ziface"
 	"zinx_server/zinx/zpack"
 )
@@ -149,6 +152,7 @@ func TestServer(t *testing.T) {
 
 	select {
 	case <-time.After(time.Second * 10):
+		s.Stop()
 		return
 	}
 }
@@ -211,3 +215,207 @@ func TestCloseConnectionBeforeSendMsg(t *testing.T) {
 	wg.Wait()
 	s.Stop()
 }
+
+func TestServerShutdown(t *testing.T) {
+	listener := NewPipeListener()
+	s := NewServer(WithGoodbyeMsg(3, []byte("server is shutting down"))).(*Server)
+	s.AddRouter(1, &PingRouter{})
+	s.StartWithListener(listener)
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// 管道写入是同步的，需要一直读取服务端的回复，直到链接被关闭
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	firstReply := make(chan struct{})
+	lastMsgID := make(chan uint32, 1)
+	go func() {
+		var msgID uint32
+		for {
+			headData := make([]byte, dp.GetHeadLen())
+			if _, err := io.ReadFull(conn, headData); err != nil {
+				break
+			}
+			msgHead, _ := dp.Unpack(headData)
+			_, _ = io.ReadFull(conn, make([]byte, msgHead.GetDataLen()))
+			if msgID == 0 {
+				close(firstReply)
+			}
+			msgID = msgHead.GetMsgID()
+		}
+		lastMsgID <- msgID
+	}()
+
+	pack, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("ping")))
+	_, _ = conn.Write(pack)
+	<-firstReply
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	assert.Nil(t, s.Shutdown(ctx))
+	assert.Equal(t, 0, s.GetConnMgr().Len())
+
+	// 所有回复都在告别消息之前送达，之后链接被关闭
+	assert.Equal(t, uint32(3), <-lastMsgID)
+
+	// 服务端不再接收新链接
+	<-listener.closed
+	_, err = listener.Dial()
+	assert.NotNil(t, err)
+}
+
+type slowEchoRouter struct {
+	BaseRouter
+}
+
+func (r *slowEchoRouter) Handle(request ziface.IRequest) {
+	time.Sleep(10 * time.Millisecond)
+	_ = request.GetConnection().SendMsg(request.GetMsgID(), request.GetData())
+}
+
+func TestServerShutdownBusy(t *testing.T) {
+	listener := NewPipeListener()
+	s := NewServer().(*Server)
+	s.AddRouter(1, &slowEchoRouter{})
+	s.StartWithListener(listener)
+
+	// 每个客户端收到回复后立即发送下一个请求，服务端始终有正在处理的任务
+	dp := zpack.Factory().NewPack(ziface.ZinxDataPack)
+	pack, _ := dp.Pack(zpack.NewMsgPackage(1, []byte("ping")))
+	replied := make(chan struct{}, 4)
+	for i := 0; i < 4; i++ {
+		conn, err := listener.Dial()
+		assert.Nil(t, err)
+		defer conn.Close()
+		go func() {
+			for {
+				if _, err := conn.Write(pack); err != nil {
+					return
+				}
+				if _, err := io.ReadFull(conn, make([]byte, len(pack))); err != nil {
+					return
+				}
+				select {
+				case replied <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		<-replied
+	}
+
+	// 停止处理新消息之后，已投递的任务处理完毕即可完成关闭，不需要等到超时强制关闭
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+	defer cancel()
+	start := time.Now()
+	assert.Nil(t, s.Shutdown(ctx))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Equal(t, 0, s.GetConnMgr().Len())
+}
+
+func TestServerListenerConfigs(t *testing.T) {
+	s := &Server{IP: "127.0.0.1", Port: 8999, WsPort: 9000}
+
+	mode := zconf.GlobalObject.Mode
+	defer func() { zconf.GlobalObject.Mode = mode }()
+
+	// 未配置Listeners时按照Mode生成
+	zconf.GlobalObject.Mode = ""
+	configs := s.listenerConfigs()
+	assert.Equal(t, 2, len(configs))
+	assert.Equal(t, "tcp://127.0.0.1:8999", configs[0].GetName())
+	assert.Equal(t, "websocket://127.0.0.1:9000", configs[1].GetName())
+
+	// 配置了Listeners时以Listeners为准
+	s.Listeners = []zconf.ListenerConfig{
+		{Name: "internal", Mode: zconf.ServerModeTcp, Host: "127.0.0.1", Port: 7000},
+		{Mode: zconf.ServerModeTcp, Host: "0.0.0.0", Port: 7443, CertFile: "server.crt", PrivateKeyFile: "server.key"},
+		{Mode: zconf.ServerModeUnix, UnixSocketPath: "/tmp/zinx.sock"},
+	}
+	configs = s.listenerConfigs()
+	assert.Equal(t, 3, len(configs))
+	assert.Equal(t, "internal", configs[0].GetName())
+	assert.False(t, configs[0].UseTLS())
+	assert.True(t, configs[1].UseTLS())
+	assert.Equal(t, "unix:///tmp/zinx.sock", configs[2].GetName())
+}
+
+type pipeClientRouter struct {
+	BaseRouter
+	replies chan string
+}
+
+func (r *pipeClientRouter) Handle(request ziface.IRequest) {
+	r.replies <- string(request.GetData())
+}
+
+func TestServerWithPipeListener(t *testing.T) {
+	workerPoolSize := zconf.GlobalObject.WorkerPoolSize
+	defer func() { zconf.GlobalObject.WorkerPoolSize = workerPoolSize }()
+
+	// 服务端与客户端通过内存管道通信，不占用真实端口
+	listener := NewPipeListener()
+	s := NewServer()
+	s.AddRouter(1, &PingRouter{})
+	s.StartWithListener(listener)
+	defer s.Stop()
+
+	router := &pipeClientRouter{replies: make(chan string, 3)}
+	started := make(chan ziface.IConnection, 1)
+	client := NewClient("127.0.0.1", 8999, WithDialerClient(listener.DialContext))
+	client.AddRouter(1, router)
+	client.SetOnConnStart(func(conn ziface.IConnection) {
+		started <- conn
+	})
+	client.Start()
+	defer client.Stop()
+
+	conn := <-started
+	assert.Nil(t, conn.SendMsg(1, []byte("ping")))
+	assert.Equal(t, "before ping ....\n", <-router.replies)
+	assert.Equal(t, "ping...ping...ping\n", <-router.replies)
+	assert.Equal(t, "After ping .....\n", <-router.replies)
+
+	assert.Equal(t, 1, s.GetConnMgr().Len())
+	serverConn, err := s.GetConnMgr().Get(1)
+	assert.Nil(t, err)
+	assert.Equal(t, "pipe://pipe", serverConn.GetListenerName())
+}
+
+func TestClientRestart(t *testing.T) {
+	workerPoolSize := zconf.GlobalObject.WorkerPoolSize
+	defer func() { zconf.GlobalObject.WorkerPoolSize = workerPoolSize }()
+
+	listener := NewPipeListener()
+	s := NewServer()
+	stopped := make(chan ziface.IConnection, 3)
+	s.SetOnConnStop(func(conn ziface.IConnection) {
+		stopped <- conn
+	})
+	s.StartWithListener(listener)
+	defer s.Stop()
+
+	started := make(chan ziface.IConnection, 3)
+	client := NewClient("127.0.0.1", 8999, WithDialerClient(listener.DialContext))
+	client.SetOnConnStart(func(conn ziface.IConnection) {
+		started <- conn
+	})
+	client.Start()
+	first := <-started
+
+	// 重启时先停止之前的链接，再建立新的链接
+	client.Restart()
+	second := <-started
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, second, client.Conn())
+	<-stopped
+
+	client.Stop()
+	<-stopped
+	assert.Eventually(t, func() bool {
+		return s.GetConnMgr().Len() == 0
+	}, time.Second, 10*time.Millisecond)
+}
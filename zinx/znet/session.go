@@ -0,0 +1,426 @@
+package znet
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zlog"
+)
+
+/*
+	服务端会话层，协议见ziface/isession.go
+*/
+
+var ErrSessionClosed = errors.New("session closed")
+
+// 会话消息的头部长度 seq(8字节) + msgID(4字节)
+const sessionDataHeadLen = 12
+
+// 会话在链接之间迁移时保存/恢复链接属性
+type propertyCarrier interface {
+	snapshotProperties() map[string]propertyValue
+	restoreProperties(properties map[string]propertyValue)
+}
+
+// 等待客户端确认的会话消息
+type sessionMsg struct {
+	seq  uint64
+	data []byte
+}
+
+type Session struct {
+	token string
+	mgr   *SessionManager
+
+	lock   sync.Mutex
+	conn   ziface.IConnection
+	seq    uint64
+	outbox []sessionMsg
+	closed bool
+
+	// 链接断开时保存的链接属性
+	properties map[string]propertyValue
+	// 宽限期定时器，链接断开时启动
+	expireTimer *time.Timer
+}
+
+// 获取会话的恢复令牌
+func (s *Session) GetToken() string {
+	return s.token
+}
+
+// 获取会话当前绑定的链接
+func (s *Session) GetConnection() ziface.IConnection {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.conn
+}
+
+// 发送会话消息
+func (s *Session) SendMsg(msgID uint32, data []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return ErrSessionClosed
+	}
+
+	s.seq++
+	msg := make([]byte, sessionDataHeadLen+len(data))
+	binary.BigEndian.PutUint64(msg, s.seq)
+	binary.BigEndian.PutUint32(msg[8:], msgID)
+	copy(msg[sessionDataHeadLen:], data)
+
+	if s.conn != nil {
+		// 链接正在关闭但会话还没有解绑时发送失败，消息保留在outbox中等待恢复后补发
+		if err := s.conn.SendBuffMsg(ziface.SessionDataMsgID, msg); err != nil && s.conn.Context().Err() == nil {
+			// 没有发送出去的消息不占用seq，避免客户端收到的seq不连续
+			s.seq--
+			return err
+		}
+	}
+
+	s.outbox = append(s.outbox, sessionMsg{seq: s.seq, data: msg})
+	if len(s.outbox) > s.mgr.maxUnacked {
+		// 丢弃最早的未确认消息，之后请求从该消息之前恢复会失败
+		s.outbox[0] = sessionMsg{}
+		s.outbox = s.outbox[1:]
+	}
+	return nil
+}
+
+// 获取尚未被客户端确认的消息数量
+func (s *Session) GetUnackedCount() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.outbox)
+}
+
+// 结束会话
+func (s *Session) Close() {
+	s.mgr.remove(s)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.closed = true
+	s.outbox = nil
+	s.properties = nil
+	if s.expireTimer != nil {
+		s.expireTimer.Stop()
+	}
+}
+
+// 客户端确认收到seq及之前的所有消息
+func (s *Session) ack(seq uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.ackLocked(seq)
+}
+
+func (s *Session) ackLocked(seq uint64) {
+	i := 0
+	for i < len(s.outbox) && s.outbox[i].seq <= seq {
+		s.outbox[i] = sessionMsg{}
+		i++
+	}
+	s.outbox = s.outbox[i:]
+}
+
+// 链接断开，保存链接属性并开始计算宽限期
+func (s *Session) detach(conn ziface.IConnection) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.conn != conn {
+		return
+	}
+	if carrier, ok := conn.(propertyCarrier); ok {
+		s.properties = carrier.snapshotProperties()
+	}
+	s.conn = nil
+
+	if s.closed {
+		return
+	}
+	s.expireTimer = time.AfterFunc(s.mgr.gracePeriod, func() {
+		s.mgr.expire(s)
+	})
+}
+
+// 将会话绑定到新的链接并重发客户端未收到的消息，lastSeq为客户端最后收到的消息seq
+// 返回会话之前绑定的链接(可能为nil)以及是否恢复成功
+func (s *Session) resume(conn ziface.IConnection, lastSeq uint64) (ziface.IConnection, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed || lastSeq > s.seq || (len(s.outbox) > 0 && s.outbox[0].seq > lastSeq+1) {
+		return nil, false
+	}
+	if s.expireTimer != nil {
+		s.expireTimer.Stop()
+		s.expireTimer = nil
+	}
+
+	// 旧链接可能还没有检测到断开，属性以旧链接上的为准
+	old := s.conn
+	if carrier, ok := old.(propertyCarrier); ok {
+		s.properties = carrier.snapshotProperties()
+	}
+	if carrier, ok := conn.(propertyCarrier); ok && s.properties != nil {
+		carrier.restoreProperties(s.properties)
+	}
+	s.properties = nil
+	s.conn = conn
+
+	s.ackLocked(lastSeq)
+	_ = conn.SendBuffMsg(ziface.SessionResumeMsgID, []byte{ziface.SessionResumeOK})
+	_ = conn.SendBuffMsg(ziface.SessionTokenMsgID, []byte(s.token))
+	for _, msg := range s.outbox {
+		if err := conn.SendBuffMsg(ziface.SessionDataMsgID, msg.data); err != nil {
+			zlog.Ins().ErrorF("session resume connID=%d replay seq=%d err: %v", conn.GetConnID(), msg.seq, err)
+			break
+		}
+	}
+	return old, true
+}
+
+// 会话管理
+type SessionManager struct {
+	gracePeriod time.Duration
+	maxUnacked  int
+
+	lock     sync.Mutex
+	sessions map[string]*Session
+	conns    map[uint64]*Session
+
+	onResumed func(session ziface.ISession, conn ziface.IConnection)
+	onExpired func(session ziface.ISession)
+}
+
+func newSessionManager(gracePeriod time.Duration) *SessionManager {
+	maxUnacked := zconf.GlobalObject.SessionMaxUnacked
+	if maxUnacked <= 0 {
+		maxUnacked = 1024
+	}
+	return &SessionManager{
+		gracePeriod: gracePeriod,
+		maxUnacked:  maxUnacked,
+		sessions:    make(map[string]*Session),
+		conns:       make(map[uint64]*Session),
+	}
+}
+
+// 根据令牌获取会话
+func (m *SessionManager) Get(token string) (ziface.ISession, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if session, ok := m.sessions[token]; ok {
+		return session, true
+	}
+	return nil, false
+}
+
+// 获取链接当前绑定的会话
+func (m *SessionManager) GetByConn(conn ziface.IConnection) (ziface.ISession, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if session, ok := m.conns[conn.GetConnID()]; ok {
+		return session, true
+	}
+	return nil, false
+}
+
+// 获取会话数量
+func (m *SessionManager) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return len(m.sessions)
+}
+
+// 设置会话恢复到新链接后的Hook函数
+func (m *SessionManager) SetOnSessionResumed(hookFunc func(session ziface.ISession, conn ziface.IConnection)) {
+	m.onResumed = hookFunc
+}
+
+// 设置会话过期被移除时的Hook函数
+func (m *SessionManager) SetOnSessionExpired(hookFunc func(session ziface.ISession)) {
+	m.onExpired = hookFunc
+}
+
+// 链接建立时创建新的会话并下发令牌
+func (m *SessionManager) onConnStart(conn ziface.IConnection) {
+	session := &Session{
+		token: newSessionToken(),
+		mgr:   m,
+		conn:  conn,
+	}
+
+	m.lock.Lock()
+	m.sessions[session.token] = session
+	m.conns[conn.GetConnID()] = session
+	m.lock.Unlock()
+
+	_ = conn.SendBuffMsg(ziface.SessionTokenMsgID, []byte(session.token))
+}
+
+// 链接断开时会话进入宽限期
+func (m *SessionManager) onConnStop(conn ziface.IConnection) {
+	m.lock.Lock()
+	session, ok := m.conns[conn.GetConnID()]
+	delete(m.conns, conn.GetConnID())
+	m.lock.Unlock()
+
+	if ok {
+		// 链接可能是在发送会话消息时被关闭的，不在当前goroutine中获取会话的锁
+		go session.detach(conn)
+	}
+}
+
+// 处理客户端的恢复请求
+func (m *SessionManager) handleResume(request ziface.IRequest) {
+	conn := request.GetConnection()
+	data := request.GetData()
+	if len(data) <= 8 {
+		_ = conn.SendBuffMsg(ziface.SessionResumeMsgID, []byte{ziface.SessionResumeFailed})
+		return
+	}
+	lastSeq := binary.BigEndian.Uint64(data)
+	token := string(data[8:])
+
+	m.lock.Lock()
+	session, ok := m.sessions[token]
+	current := m.conns[conn.GetConnID()]
+	m.lock.Unlock()
+
+	var old ziface.IConnection
+	if ok && session != current {
+		old, ok = session.resume(conn, lastSeq)
+	} else {
+		ok = false
+	}
+	if !ok {
+		zlog.Ins().ErrorF("connID=%d resume session failed, lastSeq=%d", conn.GetConnID(), lastSeq)
+		_ = conn.SendBuffMsg(ziface.SessionResumeMsgID, []byte{ziface.SessionResumeFailed})
+		return
+	}
+
+	m.lock.Lock()
+	// 新链接建立时创建的会话不再需要
+	if current != nil {
+		delete(m.sessions, current.token)
+	}
+	if old != nil && m.conns[old.GetConnID()] == session {
+		delete(m.conns, old.GetConnID())
+	}
+	m.conns[conn.GetConnID()] = session
+	m.lock.Unlock()
+
+	if current != nil {
+		current.lock.Lock()
+		current.closed = true
+		current.conn = nil
+		current.outbox = nil
+		current.lock.Unlock()
+	}
+	if old != nil {
+		// 旧链接已经被新链接取代
+		old.StopWithReason(ziface.CloseReasonSessionResumed, nil)
+	}
+
+	zlog.Ins().InfoF("connID=%d resume session, lastSeq=%d", conn.GetConnID(), lastSeq)
+	if m.onResumed != nil {
+		m.onResumed(session, conn)
+	}
+}
+
+// 处理客户端的确认消息
+func (m *SessionManager) handleAck(request ziface.IRequest) {
+	data := request.GetData()
+	if len(data) < 8 {
+		return
+	}
+	if session, ok := m.GetByConn(request.GetConnection()); ok {
+		session.(*Session).ack(binary.BigEndian.Uint64(data))
+	}
+}
+
+// 会话超过宽限期未恢复
+func (m *SessionManager) expire(session *Session) {
+	session.lock.Lock()
+	expired := session.conn == nil && !session.closed
+	session.lock.Unlock()
+	if !expired {
+		return
+	}
+
+	session.Close()
+	zlog.Ins().InfoF("session expired, token=%s", session.token)
+	if m.onExpired != nil {
+		m.onExpired(session)
+	}
+}
+
+func (m *SessionManager) remove(session *Session) {
+	conn := session.GetConnection()
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.sessions[session.token] == session {
+		delete(m.sessions, session.token)
+	}
+	if conn != nil && m.conns[conn.GetConnID()] == session {
+		delete(m.conns, conn.GetConnID())
+	}
+}
+
+// 服务器停止时结束所有会话
+func (m *SessionManager) clear() {
+	m.lock.Lock()
+	sessions := make([]*Session, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.lock.Unlock()
+
+	for _, session := range sessions {
+		session.Close()
+	}
+}
+
+func newSessionToken() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// 会话层的路由
+type sessionResumeRouter struct {
+	BaseRouter
+	mgr *SessionManager
+}
+
+func (r *sessionResumeRouter) Handle(request ziface.IRequest) {
+	r.mgr.handleResume(request)
+}
+
+type sessionAckRouter struct {
+	BaseRouter
+	mgr *SessionManager
+}
+
+func (r *sessionAckRouter) Handle(request ziface.IRequest) {
+	r.mgr.handleAck(request)
+}
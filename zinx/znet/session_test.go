@@ -0,0 +1,252 @@
+package znet
+
+import (
+	"context"
+	"encoding/binary"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zpack"
+)
+
+func readSessionMsg(t *testing.T, conn net.Conn) (uint32, []byte) {
+	dp := zpack.NewDataPack()
+	head := make([]byte, dp.GetHeadLen())
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := io.ReadFull(conn, head)
+	assert.Nil(t, err)
+	msg, err := dp.Unpack(head)
+	assert.Nil(t, err)
+	data := make([]byte, msg.GetDataLen())
+	_, err = io.ReadFull(conn, data)
+	assert.Nil(t, err)
+	return msg.GetMsgID(), data
+}
+
+func writeSessionMsg(t *testing.T, conn net.Conn, msgID uint32, data []byte) {
+	msg, err := zpack.NewDataPack().Pack(zpack.NewMsgPackage(msgID, data))
+	assert.Nil(t, err)
+	_, err = conn.Write(msg)
+	assert.Nil(t, err)
+}
+
+func readSessionData(t *testing.T, conn net.Conn) (uint64, string) {
+	msgID, data := readSessionMsg(t, conn)
+	assert.Equal(t, ziface.SessionDataMsgID, msgID)
+	assert.Equal(t, uint32(1), binary.BigEndian.Uint32(data[8:]))
+	return binary.BigEndian.Uint64(data), string(data[sessionDataHeadLen:])
+}
+
+func resumeData(lastSeq uint64, token string) []byte {
+	data := make([]byte, 8+len(token))
+	binary.BigEndian.PutUint64(data, lastSeq)
+	copy(data[8:], token)
+	return data
+}
+
+func startSessionServer(gracePeriod time.Duration) (*PipeListener, ziface.IServer, chan ziface.IConnection) {
+	started := make(chan ziface.IConnection, 2)
+	listener := NewPipeListener()
+	s := NewServer()
+	s.StartSession(gracePeriod)
+	s.SetOnConnStart(func(conn ziface.IConnection) {
+		started <- conn
+	})
+	s.StartWithListener(listener)
+	return listener, s, started
+}
+
+func TestSessionResume(t *testing.T) {
+	listener, s, started := startSessionServer(time.Minute)
+	defer s.Stop()
+
+	resumed := make(chan ziface.IConnection, 1)
+	mgr := s.GetSessionMgr()
+	mgr.SetOnSessionResumed(func(session ziface.ISession, conn ziface.IConnection) {
+		resumed <- conn
+	})
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	serverConn := <-started
+	msgID, token := readSessionMsg(t, conn)
+	assert.Equal(t, ziface.SessionTokenMsgID, msgID)
+
+	session, ok := mgr.Get(string(token))
+	assert.True(t, ok)
+	bySession, _ := mgr.GetByConn(serverConn)
+	assert.Equal(t, session, bySession)
+	serverConn.SetProperty("uid", 1001)
+	serverConn.SetPropertyWithTTL("ticket", "t1", 300*time.Millisecond)
+
+	for _, data := range []string{"a", "b", "c"} {
+		assert.Nil(t, session.SendMsg(1, []byte(data)))
+	}
+	for i, data := range []string{"a", "b", "c"} {
+		seq, payload := readSessionData(t, conn)
+		assert.Equal(t, uint64(i+1), seq)
+		assert.Equal(t, data, payload)
+	}
+
+	// 只确认前两条消息
+	ack := make([]byte, 8)
+	binary.BigEndian.PutUint64(ack, 2)
+	writeSessionMsg(t, conn, ziface.SessionAckMsgID, ack)
+	assert.Eventually(t, func() bool { return session.GetUnackedCount() == 1 }, time.Second, 10*time.Millisecond)
+
+	conn.Close()
+	assert.Eventually(t, func() bool { return session.GetConnection() == nil }, time.Second, 10*time.Millisecond)
+	// 断开期间发送的消息在恢复后补发
+	assert.Nil(t, session.SendMsg(1, []byte("d")))
+
+	conn, err = listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+	newConn := <-started
+	msgID, _ = readSessionMsg(t, conn)
+	assert.Equal(t, ziface.SessionTokenMsgID, msgID)
+
+	writeSessionMsg(t, conn, ziface.SessionResumeMsgID, resumeData(2, string(token)))
+	msgID, data := readSessionMsg(t, conn)
+	assert.Equal(t, ziface.SessionResumeMsgID, msgID)
+	assert.Equal(t, []byte{ziface.SessionResumeOK}, data)
+	msgID, data = readSessionMsg(t, conn)
+	assert.Equal(t, ziface.SessionTokenMsgID, msgID)
+	assert.Equal(t, token, data)
+	for i, data := range []string{"c", "d"} {
+		seq, payload := readSessionData(t, conn)
+		assert.Equal(t, uint64(i+3), seq)
+		assert.Equal(t, data, payload)
+	}
+
+	assert.Equal(t, newConn, <-resumed)
+	assert.Equal(t, newConn, session.GetConnection())
+	uid, err := newConn.GetProperty("uid")
+	assert.Nil(t, err)
+	assert.Equal(t, 1001, uid)
+	// 带有效期的属性恢复后按照剩余的有效期继续计时
+	ticket, err := newConn.GetProperty("ticket")
+	assert.Nil(t, err)
+	assert.Equal(t, "t1", ticket)
+	assert.Eventually(t, func() bool {
+		_, err := newConn.GetProperty("ticket")
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	// 新链接建立时创建的会话已经被移除
+	assert.Equal(t, 1, mgr.Len())
+	bySession, _ = mgr.GetByConn(newConn)
+	assert.Equal(t, session, bySession)
+}
+
+func TestSessionSendMsgOnClosingConn(t *testing.T) {
+	s := NewServer()
+	removed := make(chan struct{})
+	s.SetOnConnRemoved(func(conn ziface.IConnection) { close(removed) })
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	c := newServerConn(s, serverConn, 1, "pipe")
+	go c.Start()
+	c.Stop()
+	<-removed
+
+	// 链接已经关闭但会话尚未解绑，消息保留下来等待恢复后补发
+	session := &Session{token: newSessionToken(), mgr: newSessionManager(time.Minute), conn: c}
+	assert.Nil(t, session.SendMsg(1, []byte("a")))
+	assert.Equal(t, 1, session.GetUnackedCount())
+}
+
+func TestServerShutdownClearsSessions(t *testing.T) {
+	listener, s, started := startSessionServer(time.Minute)
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+	<-started
+	msgID, _ := readSessionMsg(t, conn)
+	assert.Equal(t, ziface.SessionTokenMsgID, msgID)
+	assert.Equal(t, 1, s.GetSessionMgr().Len())
+
+	// 优雅关闭后不再保留等待恢复的会话
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(t, s.Shutdown(ctx))
+	assert.Equal(t, 0, s.GetSessionMgr().Len())
+}
+
+func TestSessionExpired(t *testing.T) {
+	listener, s, started := startSessionServer(50 * time.Millisecond)
+	defer s.Stop()
+
+	expired := make(chan ziface.ISession, 1)
+	mgr := s.GetSessionMgr()
+	mgr.SetOnSessionExpired(func(session ziface.ISession) {
+		expired <- session
+	})
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	<-started
+	_, token := readSessionMsg(t, conn)
+	conn.Close()
+
+	select {
+	case session := <-expired:
+		assert.Equal(t, string(token), session.GetToken())
+	case <-time.After(time.Second):
+		t.Fatal("wait session expired timeout")
+	}
+	_, ok := mgr.Get(string(token))
+	assert.False(t, ok)
+
+	// 过期的会话不能再恢复
+	conn, err = listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+	<-started
+	readSessionMsg(t, conn)
+	writeSessionMsg(t, conn, ziface.SessionResumeMsgID, resumeData(0, string(token)))
+	msgID, data := readSessionMsg(t, conn)
+	assert.Equal(t, ziface.SessionResumeMsgID, msgID)
+	assert.Equal(t, []byte{ziface.SessionResumeFailed}, data)
+}
+
+func TestClientSessionResume(t *testing.T) {
+	workerPoolSize := zconf.GlobalObject.WorkerPoolSize
+	defer func() { zconf.GlobalObject.WorkerPoolSize = workerPoolSize }()
+
+	listener, s, started := startSessionServer(time.Minute)
+	defer s.Stop()
+
+	router := &pipeClientRouter{replies: make(chan string, 3)}
+	client := NewClient("127.0.0.1", 8999, WithDialerClient(listener.DialContext))
+	client.AddRouter(1, router)
+	client.StartSession()
+	client.Start()
+	defer client.Stop()
+
+	serverConn := <-started
+	mgr := s.GetSessionMgr()
+	session, _ := mgr.GetByConn(serverConn)
+	assert.Eventually(t, func() bool { return client.GetSessionToken() == session.GetToken() }, time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, session.SendMsg(1, []byte("a")))
+	assert.Equal(t, "a", <-router.replies)
+	assert.Eventually(t, func() bool { return session.GetUnackedCount() == 0 }, time.Second, 10*time.Millisecond)
+
+	// 服务端链接断开期间的消息在客户端重连后补收
+	serverConn.Stop()
+	assert.Eventually(t, func() bool { return session.GetConnection() == nil }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, session.SendMsg(1, []byte("b")))
+
+	client.Restart()
+	newConn := <-started
+	assert.Equal(t, "b", <-router.replies)
+	assert.Equal(t, newConn, session.GetConnection())
+	assert.Equal(t, session.GetToken(), client.GetSessionToken())
+	assert.Equal(t, 1, mgr.Len())
+}
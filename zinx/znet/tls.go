@@ -0,0 +1,348 @@
+package znet
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/zlog"
+)
+
+/*
+	TLS/mTLS
+	证书、私钥以及客户端CA证书在运行期间会定期检查文件是否被更新，更新后自动重新加载，
+	新的握手使用新证书，已建立的链接不受影响
+*/
+
+const (
+	// TLS握手超时时间
+	tlsHandshakeTimeout = 10 * time.Second
+)
+
+// 客户端证书校验方式
+const (
+	TLSClientAuthNone     = "none"     //不要求客户端证书
+	TLSClientAuthOptional = "optional" //客户端提供了证书则校验
+	TLSClientAuthRequire  = "require"  //必须提供并通过校验(mTLS)
+)
+
+// 可热更新的证书
+type tlsCertReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+
+	lock      sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	// 上次加载时各文件的修改时间
+	modTimes map[string]time.Time
+}
+
+func newTLSCertReloader(certFile, keyFile, caFile string) (*tlsCertReloader, error) {
+	r := &tlsCertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *tlsCertReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+// 重新加载证书，加载失败时继续使用旧的证书
+func (r *tlsCertReloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return err
+		}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	var clientCAs *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return err
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no valid certificate found in %s", r.caFile)
+		}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+
+	return nil
+}
+
+// 证书文件是否在上次加载之后被修改过
+func (r *tlsCertReloader) changed() bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			// 证书轮换时文件可能短暂不存在，下次再检查
+			continue
+		}
+		if !info.ModTime().Equal(r.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// 定期检查证书文件，直到done被关闭
+func (r *tlsCertReloader) watch(interval time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.reload(); err != nil {
+				zlog.Ins().ErrorF("reload tls certificate %s err: %v", r.certFile, err)
+				continue
+			}
+			zlog.Ins().InfoF("reload tls certificate %s successfully", r.certFile)
+		case <-done:
+			return
+		}
+	}
+}
+
+func (r *tlsCertReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+func (r *tlsCertReloader) getClientCAs() *x509.CertPool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.clientCAs
+}
+
+// 根据监听器配置创建服务端TLS配置
+func newServerTLSConfig(lc *zconf.ListenerConfig, reloader *tlsCertReloader) (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(lc.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := parseTLSCipherSuites(lc.TLSCipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := parseTLSClientAuth(lc.ClientAuth, lc.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Time:           time.Now,
+		Rand:           rand.Reader,
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		ClientAuth:     clientAuth,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if lc.ClientCAFile != "" {
+		// 每次握手使用最新加载的CA证书校验客户端
+		tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := tlsConfig.Clone()
+			config.GetConfigForClient = nil
+			config.ClientCAs = reloader.getClientCAs()
+			return config, nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// 为监听器加载证书并创建TLS配置，证书文件更新后自动重新加载，直到exitChan被关闭
+func (s *Server) newListenerTLSConfig(lc *zconf.ListenerConfig) (*tls.Config, error) {
+	tlsConfig, reloader, err := loadListenerTLSConfig(lc)
+	if err != nil {
+		return nil, err
+	}
+
+	go reloader.watch(zconf.GlobalObject.TLSCertReloadIntervalDuration(), s.exitChan)
+
+	return tlsConfig, nil
+}
+
+func loadListenerTLSConfig(lc *zconf.ListenerConfig) (*tls.Config, *tlsCertReloader, error) {
+	reloader, err := newTLSCertReloader(lc.CertFile, lc.PrivateKeyFile, lc.ClientCAFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig, err := newServerTLSConfig(lc, reloader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tlsConfig, reloader, nil
+}
+
+// Start时预先加载所有监听器的TLS配置，任意一个加载失败都不开启监听器
+// 全部加载成功之后才开始定时检查证书更新
+func (s *Server) loadTLSConfigs(configs []zconf.ListenerConfig) (map[string]*tls.Config, error) {
+	tlsConfigs := make(map[string]*tls.Config)
+	reloaders := make([]*tlsCertReloader, 0)
+	for i := range configs {
+		lc := &configs[i]
+		if !lc.UseTLS() {
+			continue
+		}
+		tlsConfig, reloader, err := loadListenerTLSConfig(lc)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s load tls config: %w", lc.GetName(), err)
+		}
+		tlsConfigs[lc.GetName()] = tlsConfig
+		reloaders = append(reloaders, reloader)
+	}
+
+	for _, reloader := range reloaders {
+		go reloader.watch(zconf.GlobalObject.TLSCertReloadIntervalDuration(), s.exitChan)
+	}
+	return tlsConfigs, nil
+}
+
+// 获取监听器的TLS配置，优先使用Start时预先加载的配置
+func (s *Server) listenerTLSConfig(lc *zconf.ListenerConfig) (*tls.Config, error) {
+	if tlsConfig, ok := s.tlsConfigs[lc.GetName()]; ok {
+		return tlsConfig, nil
+	}
+	return s.newListenerTLSConfig(lc)
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unknown tls version: %s", version)
+	}
+}
+
+// 按照名称(如"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")解析加密套件，为空则使用Go的默认套件
+func parseTLSCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	suites := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+	for _, suite := range tls.InsecureCipherSuites() {
+		suites[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := suites[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown tls cipher suite: %s", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// 配置了客户端CA证书但没有指定校验方式时，默认要求客户端提供证书
+func parseTLSClientAuth(clientAuth, caFile string) (tls.ClientAuthType, error) {
+	if clientAuth == "" {
+		if caFile != "" {
+			return tls.RequireAndVerifyClientCert, nil
+		}
+		return tls.NoClientCert, nil
+	}
+
+	switch clientAuth {
+	case TLSClientAuthNone:
+		return tls.NoClientCert, nil
+	case TLSClientAuthOptional:
+		if caFile == "" {
+			return 0, errors.New("tls client auth optional requires ClientCAFile")
+		}
+		return tls.VerifyClientCertIfGiven, nil
+	case TLSClientAuthRequire:
+		if caFile == "" {
+			return 0, errors.New("tls client auth require requires ClientCAFile")
+		}
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return 0, fmt.Errorf("unknown tls client auth: %s", clientAuth)
+	}
+}
+
+// 如果是TLS链接，则完成握手，使得OnConnStart中即可获取对端证书
+func tlsHandshake(ctx context.Context, conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, tlsHandshakeTimeout)
+	defer cancel()
+	return tlsConn.HandshakeContext(ctx)
+}
+
+// 获取TLS链接中已通过校验的对端证书
+func peerCertificate(conn net.Conn) *x509.Certificate {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	state := tlsConn.ConnectionState()
+	if len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
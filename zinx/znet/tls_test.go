@@ -0,0 +1,193 @@
+package znet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+)
+
+// 生成测试用证书，parent为nil时生成自签名的CA证书
+func genTestCert(t *testing.T, cn string, serial int64, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	return cert, key,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, os.WriteFile(path, data, 0600))
+		return path
+	}
+
+	ca, caKey, caPem, _ := genTestCert(t, "zinx-ca", 1, nil, nil)
+	_, _, serverPem, serverKeyPem := genTestCert(t, "zinx-server", 2, ca, caKey)
+	_, _, clientPem, clientKeyPem := genTestCert(t, "zinx-client", 3, ca, caKey)
+
+	lc := zconf.ListenerConfig{
+		Name:           "tls",
+		Mode:           zconf.ServerModeTcp,
+		Host:           "127.0.0.1",
+		CertFile:       write("server.crt", serverPem),
+		PrivateKeyFile: write("server.key", serverKeyPem),
+		ClientCAFile:   write("ca.crt", caPem),
+		TLSMinVersion:  "1.2",
+	}
+
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{lc}
+	peers := make(chan string, 1)
+	s.SetOnConnStart(func(conn ziface.IConnection) {
+		if cert := conn.GetPeerCertificate(); cert != nil {
+			peers <- cert.Subject.CommonName
+		}
+	})
+	assert.Nil(t, s.Start())
+	defer s.Stop()
+	addr := listenerAddr(t, s, "tls")
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	// 没有客户端证书时握手失败
+	conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+	if err == nil {
+		_, err = conn.Read(make([]byte, 1))
+		_ = conn.Close()
+	}
+	assert.NotNil(t, err)
+
+	// 提供客户端证书，服务端可以获取对端身份
+	clientCert, err := tls.X509KeyPair(clientPem, clientKeyPem)
+	assert.Nil(t, err)
+	conn, err = tls.Dial("tcp", addr, &tls.Config{
+		RootCAs:      roots,
+		ServerName:   "localhost",
+		Certificates: []tls.Certificate{clientCert},
+	})
+	assert.Nil(t, err)
+	defer conn.Close()
+	select {
+	case cn := <-peers:
+		assert.Equal(t, "zinx-client", cn)
+	case <-time.After(time.Second):
+		t.Fatal("peer certificate not found")
+	}
+	assert.Equal(t, int64(2), conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64())
+}
+
+func TestStartTLSLoadError(t *testing.T) {
+	dir := t.TempDir()
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{
+		{Name: "plain", Mode: zconf.ServerModeTcp, Host: "127.0.0.1"},
+		{
+			Name:           "tls",
+			Mode:           zconf.ServerModeTcp,
+			Host:           "127.0.0.1",
+			CertFile:       filepath.Join(dir, "missing.crt"),
+			PrivateKeyFile: filepath.Join(dir, "missing.key"),
+		},
+	}
+
+	// 证书加载失败时Start返回错误，不开启任何监听器
+	assert.NotNil(t, s.Start())
+	defer s.Stop()
+	assert.Nil(t, s.listenersReady)
+}
+
+func TestTLSCertReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+
+	ca, caKey, _, _ := genTestCert(t, "zinx-ca", 1, nil, nil)
+	_, _, certPem, keyPem := genTestCert(t, "zinx-server", 2, ca, caKey)
+	assert.Nil(t, os.WriteFile(certFile, certPem, 0600))
+	assert.Nil(t, os.WriteFile(keyFile, keyPem, 0600))
+
+	reloader, err := newTLSCertReloader(certFile, keyFile, "")
+	assert.Nil(t, err)
+	assert.False(t, reloader.changed())
+
+	// 证书轮换
+	_, _, certPem, keyPem = genTestCert(t, "zinx-server", 3, ca, caKey)
+	assert.Nil(t, os.WriteFile(certFile, certPem, 0600))
+	assert.Nil(t, os.WriteFile(keyFile, keyPem, 0600))
+	future := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(certFile, future, future))
+	assert.True(t, reloader.changed())
+
+	assert.Nil(t, reloader.reload())
+	cert, _ := reloader.getCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), leaf.SerialNumber.Int64())
+
+	// 加载失败时继续使用旧证书
+	assert.Nil(t, os.WriteFile(keyFile, []byte("broken"), 0600))
+	assert.NotNil(t, reloader.reload())
+	cert2, _ := reloader.getCertificate(nil)
+	assert.Equal(t, cert, cert2)
+}
+
+func TestParseTLSOptions(t *testing.T) {
+	version, err := parseTLSVersion("1.3")
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), version)
+	_, err = parseTLSVersion("2.0")
+	assert.NotNil(t, err)
+
+	suites, err := parseTLSCipherSuites([]string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, suites)
+	_, err = parseTLSCipherSuites([]string{"TLS_UNKNOWN"})
+	assert.NotNil(t, err)
+
+	auth, err := parseTLSClientAuth("", "ca.crt")
+	assert.Nil(t, err)
+	assert.Equal(t, tls.RequireAndVerifyClientCert, auth)
+	auth, err = parseTLSClientAuth(TLSClientAuthOptional, "ca.crt")
+	assert.Nil(t, err)
+	assert.Equal(t, tls.VerifyClientCertIfGiven, auth)
+	_, err = parseTLSClientAuth(TLSClientAuthRequire, "")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,83 @@
+package znet
+
+import (
+	"context"
+	"fmt"
+	"zinx_server/zinx/ziface"
+)
+
+/*
+	带类型的路由，自动解码请求并编码发送响应
+
+	znet.HandleTyped(s, 3, func(ctx context.Context, conn ziface.IConnection, req *pb.Position) (*pb.Position, error) {
+		...
+	}, znet.WithReplyMsgID(200))
+*/
+
+// 不需要回复的带类型路由使用的响应类型
+type NoReply struct{}
+
+type typedRoute struct {
+	replyMsgID uint32
+	codec      ziface.ICodec
+}
+
+type TypedOption func(r *typedRoute)
+
+// 响应使用的消息ID，默认与请求的消息ID相同
+func WithReplyMsgID(msgID uint32) TypedOption {
+	return func(r *typedRoute) {
+		r.replyMsgID = msgID
+	}
+}
+
+// 该路由使用的编解码器，默认使用Server的编解码器
+func WithCodec(codec ziface.ICodec) TypedOption {
+	return func(r *typedRoute) {
+		r.codec = codec
+	}
+}
+
+// 注册带类型的路由，请求按照编解码器解码为Req后调用handler
+// handler返回非nil的响应时编码后通过回复消息ID发送给客户端，返回错误时不发送响应
+// 解码、处理以及发送响应出错时交给Server的错误处理函数
+// 路由以路由切片的方式注册，Use添加的公共组件同样生效
+func HandleTyped[Req, Resp any](server ziface.IServer, msgID uint32,
+	handler func(ctx context.Context, conn ziface.IConnection, req *Req) (*Resp, error), opts ...TypedOption) ziface.IRouterSlices {
+	route := &typedRoute{replyMsgID: msgID}
+	for _, opt := range opts {
+		opt(route)
+	}
+
+	return server.AddRouterSlices(msgID, func(request ziface.IRequest) {
+		codec := route.codec
+		if codec == nil {
+			codec = server.GetCodec()
+		}
+		conn := request.GetConnection()
+
+		req := new(Req)
+		if err := codec.Unmarshal(request.GetData(), req); err != nil {
+			request.SetError(fmt.Errorf("connID=%d %s decode request: %w", conn.GetConnID(), codec.Name(), err))
+			return
+		}
+
+		resp, err := handler(conn.Context(), conn, req)
+		if err != nil {
+			request.SetError(err)
+			return
+		}
+		if resp == nil {
+			return
+		}
+
+		data, err := codec.Marshal(resp)
+		if err != nil {
+			request.SetError(fmt.Errorf("connID=%d %s encode response: %w", conn.GetConnID(), codec.Name(), err))
+			return
+		}
+		if err = conn.SendMsg(route.replyMsgID, data); err != nil {
+			request.SetError(fmt.Errorf("connID=%d send response msgID=%d: %w", conn.GetConnID(), route.replyMsgID, err))
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package znet
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+	"zinx_server/zinx/ziface"
+)
+
+type helloReq struct {
+	Name string `json:"name"`
+}
+
+type helloResp struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestHandleTyped(t *testing.T) {
+	listener := NewPipeListener()
+	s := NewServer()
+	HandleTyped(s, 1, func(ctx context.Context, conn ziface.IConnection, req *helloReq) (*helloResp, error) {
+		assert.NotNil(t, ctx)
+		if req.Name == "" {
+			return nil, errors.New("empty name")
+		}
+		return &helloResp{Greeting: "hello " + req.Name}, nil
+	}, WithReplyMsgID(2))
+	errs := make(chan error, 2)
+	s.SetErrorHandler(func(request ziface.IRequest, err error) { errs <- err })
+	s.StartWithListener(listener)
+	defer s.Stop()
+
+	conn, err := listener.Dial()
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	// 解码失败以及处理出错时不回复，错误交给错误处理函数
+	writeSessionMsg(t, conn, 1, []byte("not json"))
+	assert.Contains(t, (<-errs).Error(), "json decode request")
+	writeSessionMsg(t, conn, 1, []byte(`{}`))
+	assert.EqualError(t, <-errs, "empty name")
+	writeSessionMsg(t, conn, 1, []byte(`{"name":"zinx"}`))
+
+	msgID, data := readSessionMsg(t, conn)
+	assert.Equal(t, uint32(2), msgID)
+	assert.JSONEq(t, `{"greeting":"hello zinx"}`, string(data))
+
+	_ = conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+}
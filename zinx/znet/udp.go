@@ -0,0 +1,258 @@
+package znet
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"zinx_server/zinx/zlog"
+)
+
+/*
+	UDP虚拟连接
+	UDP本身是无连接的，这里按照对端地址为每个远程peer维护一个实现了net.Conn的虚拟连接，
+	使得数据报流量也可以复用Connection、FrameDecoder以及路由和Worker工作池
+*/
+
+const (
+	// 单个UDP数据报的最大长度
+	udpMaxDatagramSize = 65535
+	// 每个虚拟连接未被读取的数据报队列长度，队列满时新到达的数据报会被丢弃
+	udpPeerInboxLen = 256
+	// 空闲检测的最小间隔
+	udpMinIdleCheckInterval = time.Second
+)
+
+// UDP监听器，负责维护对端地址与虚拟连接的映射关系
+type udpListener struct {
+	// 所有虚拟连接共用的UDP套接字
+	conn *net.UDPConn
+	// 对端地址 -> 虚拟连接
+	peers     map[string]*udpPeerConn
+	peersLock sync.Mutex
+	// 虚拟连接的空闲超时时间，为0则不做空闲检测
+	idleTimeout time.Duration
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// 一个远程peer对应的虚拟连接
+type udpPeerConn struct {
+	listener   *udpListener
+	remoteAddr *net.UDPAddr
+	key        string
+
+	// 已到达但尚未被读取的数据报
+	inbox chan []byte
+	// 上一个数据报中未被读完的部分
+	pending []byte
+
+	// 最后一次收到数据报的时间(UnixNano)
+	lastActive atomic.Int64
+	// 读超时时间点(UnixNano)，为0表示不超时
+	readDeadline atomic.Int64
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+func newUdpListener(conn *net.UDPConn, idleTimeout time.Duration) *udpListener {
+	return &udpListener{
+		conn:        conn,
+		peers:       make(map[string]*udpPeerConn),
+		idleTimeout: idleTimeout,
+		closed:      make(chan struct{}),
+	}
+}
+
+// 根据对端地址查找虚拟连接
+func (l *udpListener) lookup(addr *net.UDPAddr) (*udpPeerConn, bool) {
+	l.peersLock.Lock()
+	defer l.peersLock.Unlock()
+
+	peer, ok := l.peers[addr.String()]
+	return peer, ok
+}
+
+// 为新的对端地址创建虚拟连接
+func (l *udpListener) addPeer(addr *net.UDPAddr) *udpPeerConn {
+	peer := &udpPeerConn{
+		listener:   l,
+		remoteAddr: addr,
+		key:        addr.String(),
+		inbox:      make(chan []byte, udpPeerInboxLen),
+		closed:     make(chan struct{}),
+	}
+	peer.lastActive.Store(time.Now().UnixNano())
+
+	l.peersLock.Lock()
+	l.peers[peer.key] = peer
+	l.peersLock.Unlock()
+
+	return peer
+}
+
+// 移除虚拟连接
+func (l *udpListener) removePeer(peer *udpPeerConn) {
+	l.peersLock.Lock()
+	defer l.peersLock.Unlock()
+
+	if cur, ok := l.peers[peer.key]; ok && cur == peer {
+		delete(l.peers, peer.key)
+	}
+}
+
+// 关闭所有超过空闲时间的虚拟连接
+func (l *udpListener) expireIdlePeers(now time.Time) {
+	l.peersLock.Lock()
+	expired := make([]*udpPeerConn, 0)
+	for _, peer := range l.peers {
+		if now.Sub(time.Unix(0, peer.lastActive.Load())) >= l.idleTimeout {
+			expired = append(expired, peer)
+		}
+	}
+	l.peersLock.Unlock()
+
+	for _, peer := range expired {
+		zlog.Ins().InfoF("udp peer %s idle timeout, close it", peer.key)
+		_ = peer.Close()
+	}
+}
+
+// 空闲检测，直到监听器关闭
+func (l *udpListener) startIdleChecker() {
+	if l.idleTimeout <= 0 {
+		return
+	}
+
+	interval := l.idleTimeout / 2
+	if interval < udpMinIdleCheckInterval {
+		interval = udpMinIdleCheckInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			l.expireIdlePeers(now)
+		case <-l.closed:
+			return
+		}
+	}
+}
+
+// 关闭UDP套接字以及所有虚拟连接
+func (l *udpListener) Close() error {
+	var err error
+	l.closeOnce.Do(func() {
+		close(l.closed)
+		err = l.conn.Close()
+
+		l.peersLock.Lock()
+		peers := make([]*udpPeerConn, 0, len(l.peers))
+		for _, peer := range l.peers {
+			peers = append(peers, peer)
+		}
+		l.peersLock.Unlock()
+
+		for _, peer := range peers {
+			_ = peer.Close()
+		}
+	})
+	return err
+}
+
+// 投递一个收到的数据报，data会被拷贝
+func (p *udpPeerConn) deliver(data []byte) {
+	p.lastActive.Store(time.Now().UnixNano())
+
+	datagram := make([]byte, len(data))
+	copy(datagram, data)
+
+	select {
+	case <-p.closed:
+	case p.inbox <- datagram:
+	default:
+		zlog.Ins().DebugF("udp peer %s inbox is full, drop datagram len=%d", p.key, len(data))
+	}
+}
+
+func (p *udpPeerConn) Read(b []byte) (int, error) {
+	// 先读完上一个数据报剩余的部分
+	if len(p.pending) > 0 {
+		n := copy(b, p.pending)
+		p.pending = p.pending[n:]
+		return n, nil
+	}
+
+	var timeout <-chan time.Time
+	if deadline := p.readDeadline.Load(); deadline > 0 {
+		d := time.Until(time.Unix(0, deadline))
+		if d <= 0 {
+			return 0, os.ErrDeadlineExceeded
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case datagram := <-p.inbox:
+		n := copy(b, datagram)
+		p.pending = datagram[n:]
+		return n, nil
+	case <-p.closed:
+		return 0, io.EOF
+	case <-timeout:
+		return 0, os.ErrDeadlineExceeded
+	}
+}
+
+func (p *udpPeerConn) Write(b []byte) (int, error) {
+	select {
+	case <-p.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	return p.listener.conn.WriteToUDP(b, p.remoteAddr)
+}
+
+func (p *udpPeerConn) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.closed)
+		p.listener.removePeer(p)
+	})
+	return nil
+}
+
+func (p *udpPeerConn) LocalAddr() net.Addr {
+	return p.listener.conn.LocalAddr()
+}
+
+func (p *udpPeerConn) RemoteAddr() net.Addr {
+	return p.remoteAddr
+}
+
+func (p *udpPeerConn) SetDeadline(t time.Time) error {
+	return p.SetReadDeadline(t)
+}
+
+func (p *udpPeerConn) SetReadDeadline(t time.Time) error {
+	if t.IsZero() {
+		p.readDeadline.Store(0)
+	} else {
+		p.readDeadline.Store(t.UnixNano())
+	}
+	return nil
+}
+
+// 所有虚拟连接共用一个套接字，无法为单个连接设置写超时，这里不做任何处理
+// UDP写入不会因对端而阻塞，WriteTimeout对UDP监听器不生效
+func (p *udpPeerConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
@@ -0,0 +1,91 @@
+package znet
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/zpack"
+)
+
+func TestUdpPeerConn(t *testing.T) {
+	udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	assert.Nil(t, err)
+
+	listener := newUdpListener(udpConn, time.Second)
+	defer listener.Close()
+
+	remote := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 10086}
+	peer := listener.addPeer(remote)
+
+	_, ok := listener.lookup(remote)
+	assert.True(t, ok)
+
+	// 一个数据报可以被分多次读完
+	peer.deliver([]byte("hello zinx"))
+	buf := make([]byte, 5)
+	n, err := peer.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(buf[:n]))
+	n, err = peer.Read(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, " zinx", string(buf[:n]))
+
+	// 读超时
+	_ = peer.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	_, err = peer.Read(buf)
+	assert.ErrorIs(t, err, os.ErrDeadlineExceeded)
+	_ = peer.SetReadDeadline(time.Time{})
+
+	// 空闲超时后虚拟连接被关闭并从监听器中移除
+	listener.expireIdlePeers(time.Now().Add(2 * time.Second))
+	_, ok = listener.lookup(remote)
+	assert.False(t, ok)
+	_, err = peer.Read(buf)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestUdpServer(t *testing.T) {
+	defer func(timeout int) { zconf.GlobalObject.UdpIdleTimeout = timeout }(zconf.GlobalObject.UdpIdleTimeout)
+	zconf.GlobalObject.UdpIdleTimeout = 1
+
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{{Name: "udp", Mode: zconf.ServerModeUdp, Host: "127.0.0.1"}}
+	s.AddRouter(1, &poolEchoRouter{})
+	s.Start()
+	defer s.Stop()
+	port := listenerUDPPort(t, s, "udp")
+
+	conn, err := net.DialUDP("udp", nil, &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: port})
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	dp := zpack.NewDataPack()
+	req, err := dp.Pack(zpack.NewMsgPackage(1, []byte("ping over udp")))
+	assert.Nil(t, err)
+
+	// 监听套接字已经绑定，数据报会在内核中排队直到服务端开始读取
+	_, err = conn.Write(req)
+	assert.Nil(t, err)
+	buf := make([]byte, udpMaxDatagramSize)
+	_ = conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("udp reply err: %v", err)
+	}
+
+	// 一个回包对应一个完整的数据报
+	msg, err := dp.Unpack(buf[:dp.GetHeadLen()])
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), msg.GetMsgID())
+	assert.Equal(t, "ping over udp", string(buf[dp.GetHeadLen():n]))
+	assert.Equal(t, 1, s.GetConnMgr().Len())
+
+	// 对端空闲超时后，虚拟连接被回收并从连接管理器中移除
+	assert.Eventually(t, func() bool {
+		return s.GetConnMgr().Len() == 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
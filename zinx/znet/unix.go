@@ -0,0 +1,68 @@
+package znet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+	"zinx_server/zinx/zlog"
+)
+
+/*
+	unix domain socket监听，用于同一主机上的sidecar、本地agent等进程间通信
+*/
+
+const (
+	// 探测已存在的socket文件是否仍有进程在监听的超时时间
+	unixSocketProbeTimeout = 500 * time.Millisecond
+)
+
+// 监听unix domain socket，并设置socket文件权限
+func listenUnix(path string, perm os.FileMode) (*net.UnixListener, error) {
+	if err := removeStaleUnixSocket(path); err != nil {
+		return nil, err
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// 关闭listener时自动删除socket文件
+	listener.SetUnlinkOnClose(true)
+
+	if err = os.Chmod(path, perm); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// 清理上次进程异常退出时残留的socket文件
+// 如果该socket文件仍有进程在监听，则返回错误，避免抢占正在运行的服务
+func removeStaleUnixSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("unix socket path %s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, unixSocketProbeTimeout)
+	if err == nil {
+		_ = conn.Close()
+		return fmt.Errorf("unix socket %s is already in use", path)
+	}
+
+	zlog.Ins().InfoF("remove stale unix socket %s", path)
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
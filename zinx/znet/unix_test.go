@@ -0,0 +1,79 @@
+package znet
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "zinx.sock")
+
+	listener, err := listenUnix(path, 0600)
+	assert.Nil(t, err)
+
+	info, err := os.Stat(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// 仍在监听的socket不能被抢占
+	_, err = listenUnix(path, 0600)
+	assert.NotNil(t, err)
+
+	// 模拟进程异常退出后残留的socket文件
+	listener.SetUnlinkOnClose(false)
+	assert.Nil(t, listener.Close())
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+
+	listener, err = listenUnix(path, 0660)
+	assert.Nil(t, err)
+
+	conn, err := net.Dial("unix", path)
+	assert.Nil(t, err)
+	_ = conn.Close()
+
+	assert.Nil(t, listener.Close())
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUnixServerAndClient(t *testing.T) {
+	workerPoolSize := zconf.GlobalObject.WorkerPoolSize
+	defer func() { zconf.GlobalObject.WorkerPoolSize = workerPoolSize }()
+
+	path := filepath.Join(t.TempDir(), "zinx.sock")
+	s := NewServer().(*Server)
+	s.Listeners = []zconf.ListenerConfig{{Mode: zconf.ServerModeUnix, UnixSocketPath: path, UnixSocketPerm: "0600"}}
+	s.AddRouter(1, &poolEchoRouter{})
+	s.Start()
+	defer s.Stop()
+
+	// 服务端异步开启监听，等待socket文件按照监听器配置的权限创建
+	assert.Eventually(t, func() bool {
+		info, err := os.Stat(path)
+		return err == nil && info.Mode().Perm() == 0600
+	}, 3*time.Second, 10*time.Millisecond)
+
+	router := &pipeClientRouter{replies: make(chan string, 1)}
+	client := NewUnixClient(path)
+	client.AddRouter(1, router)
+	client.SetOnConnStart(func(conn ziface.IConnection) {
+		_ = conn.SendMsg(1, []byte("ping over unix"))
+	})
+	client.Start()
+	defer client.Stop()
+
+	select {
+	case reply := <-router.replies:
+		assert.Equal(t, "ping over unix", reply)
+	case <-time.After(3 * time.Second):
+		t.Fatal("unix reply timeout")
+	}
+	assert.Equal(t, 1, s.GetConnMgr().Len())
+}
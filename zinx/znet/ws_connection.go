@@ -2,8 +2,10 @@ package znet
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"net"
 	"strconv"
@@ -14,6 +16,7 @@ import (
 	"zinx_server/zinx/zinterceptor"
 	"zinx_server/zinx/zlog"
 	"zinx_server/zinx/zpack"
+	"zinx_server/zinx/zutils"
 )
 
 /*
@@ -37,16 +40,14 @@ type WsConnection struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	//有缓冲管道，用于读写Goroutine之间的消息通信
-	msgBuffChan chan []byte
+	//有缓冲发送队列，用于读写Goroutine之间的消息通信
+	sendQueue *sendQueue
 
 	//用户收发消息的Lock
 	msgLock sync.RWMutex
 
 	//链接属性集合
-	property map[string]interface{}
-	//保护链接属性的锁
-	propertyLock sync.RWMutex
+	property connProperty
 
 	//当前的链接状态
 	isClosed bool
@@ -58,6 +59,16 @@ type WsConnection struct {
 	onConnStart func(conn ziface.IConnection)
 	//当前连接断开时的Hook函数
 	onConnStop func(conn ziface.IConnection)
+	//当前连接即将关闭时的Hook函数
+	onConnBeforeClose func(conn ziface.IConnection)
+	//当前连接从ConnManager中移除后的Hook函数
+	onConnRemoved func(conn ziface.IConnection)
+
+	//链接关闭的原因，只记录第一次停止时的原因
+	closeLock   sync.Mutex
+	closing     bool
+	closeReason ziface.CloseReason
+	closeErr    error
 
 	// Data packet packaging method
 	// (数据报文封包方式)
@@ -71,6 +82,12 @@ type WsConnection struct {
 	lastActivityTime time.Time
 	// 心跳检测器
 	hc ziface.IHeartbeatChecker
+	// 会话管理器，未开启会话层时为空
+	sessionMgr *SessionManager
+	// 读/写/空闲超时
+	timeout connTimeout
+	// 流量统计
+	stats connStats
 
 	// 链接名称，默认与创建链接的Server/Client的Name一致
 	name string
@@ -80,22 +97,27 @@ type WsConnection struct {
 
 	// 当前链接的远程地址
 	remoteAddr string
+
+	// 接收该链接的监听器名称，客户端链接为空
+	listenerName string
 }
 
 // 创建一个Server服务端特性的连接的方法
-func newWebsocketConn(server ziface.IServer, conn *websocket.Conn, connID uint64) ziface.IConnection {
+func newWebsocketConn(server ziface.IServer, conn *websocket.Conn, connID uint64, listenerName string) ziface.IConnection {
 	c := &WsConnection{
-		conn:        conn,
-		connID:      connID,
-		connIdStr:   strconv.FormatUint(connID, 10),
-		isClosed:    false,
-		msgBuffChan: nil,
-		property:    nil,
-		name:        server.ServerName(),
-		localAddr:   conn.LocalAddr().String(),
-		remoteAddr:  conn.RemoteAddr().String(),
+		conn:         conn,
+		connID:       connID,
+		connIdStr:    strconv.FormatUint(connID, 10),
+		isClosed:     false,
+		name:         server.ServerName(),
+		localAddr:    conn.LocalAddr().String(),
+		remoteAddr:   conn.RemoteAddr().String(),
+		listenerName: listenerName,
 	}
 
+	// 在创建时即生成ctx，使得链接在Start之前也可以被安全地Stop
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
 	lengthField := server.GetLengthField()
 	if lengthField != nil {
 		c.frameDecoder = zinterceptor.NewFrameDecoder(*lengthField)
@@ -104,8 +126,18 @@ func newWebsocketConn(server ziface.IServer, conn *websocket.Conn, connID uint64
 	c.packet = server.GetPacket()
 	c.onConnStart = server.GetOnConnStart()
 	c.onConnStop = server.GetOnConnStop()
+	c.onConnBeforeClose = server.GetOnConnBeforeClose()
+	c.onConnRemoved = server.GetOnConnRemoved()
+	if mgr, ok := server.GetSessionMgr().(*SessionManager); ok {
+		c.sessionMgr = mgr
+	}
 	c.msgHandler = server.GetMsgHandler()
 
+	c.sendQueue = newSendQueue(c)
+	c.timeout.init(conn)
+	c.stats.init()
+	c.sendQueue.onWatermark = server.GetOnSendQueueWatermark()
+
 	c.connManager = server.GetConnMgr()
 
 	server.GetConnMgr().Add(c)
@@ -115,17 +147,17 @@ func newWebsocketConn(server ziface.IServer, conn *websocket.Conn, connID uint64
 // 创建一个Client服务端特性的连接的方法
 func newWsClientConn(client ziface.IClient, conn *websocket.Conn) ziface.IConnection {
 	c := &WsConnection{
-		conn:        conn,
-		connID:      0,  // client ignore
-		connIdStr:   "", // client ignore
-		isClosed:    false,
-		msgBuffChan: nil,
-		property:    nil,
-		name:        client.GetName(),
-		localAddr:   conn.LocalAddr().String(),
-		remoteAddr:  conn.RemoteAddr().String(),
+		conn:       conn,
+		connID:     0,  // client ignore
+		connIdStr:  "", // client ignore
+		isClosed:   false,
+		name:       client.GetName(),
+		localAddr:  conn.LocalAddr().String(),
+		remoteAddr: conn.RemoteAddr().String(),
 	}
 
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
 	lengthField := client.GetLengthField()
 	if lengthField != nil {
 		c.frameDecoder = zinterceptor.NewFrameDecoder(*lengthField)
@@ -137,6 +169,10 @@ func newWsClientConn(client ziface.IClient, conn *websocket.Conn) ziface.IConnec
 	c.onConnStop = client.GetOnConnStop()
 	c.msgHandler = client.GetMsgHandler()
 
+	c.sendQueue = newSendQueue(c)
+	c.timeout.init(conn)
+	c.stats.init()
+
 	return c
 }
 
@@ -145,22 +181,33 @@ func (c *WsConnection) StartWriter() {
 	zlog.Ins().InfoF("Writer Goroutine is running")
 	defer zlog.Ins().InfoF("%s [conn Writer exit!]", c.RemoteAddr().String())
 
-	for {
-		select {
-		case data, ok := <-c.msgBuffChan:
-			if ok {
-				if err := c.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
-					zlog.Ins().ErrorF("Send Buff Data error:, %s Conn Writer exit", err)
-					break
-				}
-			} else {
-				zlog.Ins().ErrorF("msgBuffChan is Closed")
-				break
-			}
-		case <-c.ctx.Done():
-			return
+	if err := c.sendQueue.writeLoop(c.ctx, c.writeBatch); err != nil && c.ctx.Err() == nil {
+		zlog.Ins().ErrorF("Send Buff Data error:, %s Conn Writer exit", err)
+		// 写出失败的链接已经不可用
+		c.StopWithReason(writeCloseReason(err), err)
+	}
+}
+
+// 写出一批消息，每条消息都是一个独立的websocket帧
+func (c *WsConnection) writeBatch(batch [][]byte) error {
+	c.timeout.beforeWrite(c.conn)
+	for _, data := range batch {
+		if err := c.conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+			return err
 		}
+		c.stats.onWrite(len(data), 1)
 	}
+	c.timeout.onWrite()
+	return nil
+}
+
+// 根据读取websocket消息时的错误判断链接关闭的原因
+func wsReadCloseReason(err error) ziface.CloseReason {
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) {
+		return ziface.CloseReasonRemoteClosed
+	}
+	return readCloseReason(err)
 }
 
 // 读消息Goroutine，从客户端中读取数据
@@ -168,6 +215,16 @@ func (c *WsConnection) StartReader() {
 	zlog.Ins().InfoF("[Reader Goroutine is running]")
 	defer zlog.Ins().InfoF("%s [conn Reader exit!]", c.RemoteAddr().String())
 	defer c.Stop()
+	defer func() {
+		if err := recover(); err != nil {
+			zlog.Ins().ErrorF("connID=%d, panic err=%v", c.GetConnID(), err)
+			c.StopWithReason(ziface.CloseReasonPanic, fmt.Errorf("%v", err))
+		}
+	}()
+
+	// 复用的解码结果切片
+	var frames [][]byte
+	c.timeout.start()
 	for {
 		select {
 		case <-c.ctx.Done():
@@ -175,20 +232,30 @@ func (c *WsConnection) StartReader() {
 		default:
 			// 从conn的IO中读取数据到内存缓存buffer中
 			messageType, buffer, err := c.conn.ReadMessage()
+			if err != nil && isTimeoutErr(err) {
+				// websocket读超时之后链接不能继续使用
+				reason := c.timeout.expired(time.Now())
+				if reason == ziface.CloseReasonNone {
+					reason = ziface.CloseReasonReadTimeout
+				}
+				zlog.Ins().ErrorF("connID=%d %s, close it", c.connID, reason)
+				c.StopWithReason(reason, err)
+				return
+			}
 			if err != nil {
-				c.cancel()
+				c.StopWithReason(wsReadCloseReason(err), err)
 				return
 			}
+			c.timeout.onRead()
+			c.stats.onRead(len(buffer))
 			if messageType == websocket.PingMessage {
 				c.updateActivity()
 				continue
 			}
 			n := len(buffer)
-			if err != nil {
-				zlog.Ins().ErrorF("read msg head [read datalen=%d], error = %s", n, err.Error())
-				return
+			if zlog.DebugEnabled() {
+				zlog.Ins().DebugF("read buffer %s \n", hex.EncodeToString(buffer[0:n]))
 			}
-			zlog.Ins().DebugF("read buffer %s \n", hex.EncodeToString(buffer[0:n]))
 
 			//正常读取到对端数据，更新心跳检测Active状态
 			if n > 0 && c.hc != nil {
@@ -198,20 +265,26 @@ func (c *WsConnection) StartReader() {
 			//处理自定义协议断粘包问题
 			if c.frameDecoder != nil {
 				// 为读取到的0-n个字节的数据进行解码
-				bufArrays := c.frameDecoder.Decode(buffer)
-				if bufArrays == nil {
-					continue
+				frames, err = decodeFrames(c.frameDecoder, frames[:0], buffer)
+				if err != nil {
+					c.stats.onDecodeError()
+					c.StopWithReason(ziface.CloseReasonDecodeError, err)
+					return
 				}
-				for _, bytes := range bufArrays {
-					zlog.Ins().DebugF("read buffer %s \n", hex.EncodeToString(bytes))
-					msg := zpack.NewMessage(uint32(len(bytes)), bytes)
+				for _, frame := range frames {
+					if err = checkPacketSize(c.packet, frame); err != nil {
+						c.stats.onDecodeError()
+						c.StopWithReason(ziface.CloseReasonPacketTooLarge, err)
+						return
+					}
 					//得到当前客户端请求的Request
-					req := NewRequest(c, msg)
+					c.stats.onMsgIn()
+					req := newReadRequest(c, frame)
 					c.msgHandler.Execute(req)
 				}
 			} else {
-				msg := zpack.NewMsgPackage(uint32(n), buffer[0:n])
-				req := NewRequest(c, msg)
+				c.stats.onMsgIn()
+				req := newReadRequest(c, buffer[0:n])
 				c.msgHandler.Execute(req)
 			}
 		}
@@ -219,8 +292,9 @@ func (c *WsConnection) StartReader() {
 }
 
 func (c *WsConnection) Start() {
-	c.ctx, c.cancel = context.WithCancel(context.Background())
-
+	if c.sessionMgr != nil {
+		c.sessionMgr.onConnStart(c)
+	}
 	c.callOnConnStart()
 
 	//启动心跳检测
@@ -245,69 +319,89 @@ func (c *WsConnection) Start() {
 }
 
 func (c *WsConnection) Stop() {
+	c.StopWithReason(ziface.CloseReasonStop, nil)
+}
+
+// 以指定的原因停止链接，只有第一次调用时的原因会被记录
+// 第一次调用时先执行OnConnBeforeClose，此时链接仍可以发送消息，之后再通知读写goroutine退出
+func (c *WsConnection) StopWithReason(reason ziface.CloseReason, err error) {
+	if !c.setCloseReason(reason, err) {
+		return
+	}
+	c.callOnConnBeforeClose()
+
 	c.cancel()
 }
 
+// 记录关闭原因，返回false表示链接已经在停止中
+func (c *WsConnection) setCloseReason(reason ziface.CloseReason, err error) bool {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+
+	if c.closing {
+		return false
+	}
+	c.closing = true
+	c.closeReason, c.closeErr = reason, err
+	return true
+}
+
+// 获取链接关闭的原因以及导致关闭的错误
+func (c *WsConnection) GetCloseReason() (ziface.CloseReason, error) {
+	c.closeLock.Lock()
+	defer c.closeLock.Unlock()
+
+	return c.closeReason, c.closeErr
+}
+
 func (c *WsConnection) Send(data []byte) error {
 	c.msgLock.RLock()
-	defer c.msgLock.RUnlock()
 	if c.isClosed == true {
+		c.msgLock.RUnlock()
 		return errors.New("WsConnection closed when send msg")
 	}
 
+	c.timeout.beforeWrite(c.conn)
 	err := c.conn.WriteMessage(websocket.BinaryMessage, data)
+	c.msgLock.RUnlock()
+
 	if err != nil {
 		zlog.Ins().ErrorF("SendMsg err data = %+v, err = %+v", data, err)
+		if isTimeoutErr(err) {
+			c.StopWithReason(ziface.CloseReasonWriteTimeout, err)
+		}
 		return err
 	}
+	c.timeout.onWrite()
+	c.stats.onWrite(len(data), 1)
 	return nil
 }
 
 func (c *WsConnection) SendToQueue(data []byte) error {
-	c.msgLock.RLock()
-	defer c.msgLock.RUnlock()
-
-	if c.msgBuffChan == nil {
-		c.msgBuffChan = make(chan []byte, zconf.GlobalObject.MaxMsgChanLen)
-
-		go c.StartWriter()
-	}
-	idleTimeout := time.NewTimer(5 * time.Millisecond)
-	defer idleTimeout.Stop()
-
-	if c.isClosed == true {
-		return errors.New("WsConnection closed when send buff msg")
-	}
-
 	if data == nil {
 		zlog.Ins().ErrorF("Pack data is nil")
 		return errors.New("Pack data is nil ")
 	}
 
-	select {
-	case <-idleTimeout.C:
-		return errors.New("send buff msg timeout")
-	case c.msgBuffChan <- data:
-		return nil
-	}
+	return c.pushSendQueue(context.Background(), data, ziface.SendPriorityNormal)
 }
 
 // 直接将Message数据发送数据给远程的TCP客户端
 func (c *WsConnection) SendMsg(msgID uint32, data []byte) error {
-	c.msgLock.RLock()
-	defer c.msgLock.RUnlock()
-
 	if c.isClosed == true {
-		return errors.New("WsConnection closed when send buff msg")
+		return errors.New("WsConnection closed when send msg")
 	}
 
-	// 将data封包，并且发送
-	msg, err := c.packet.Pack(zpack.NewMsgPackage(msgID, data))
+	// 将data封包，并且通过Send发送，与Connection一致地统计流量
+	msg, pooled, err := packMsg(c.packet, msgID, data)
 	if err != nil {
 		zlog.Ins().ErrorF("Pack error msg ID = %d", msgID)
 		return errors.New("Pack error msg ")
 	}
-	err = c.conn.WriteMessage(websocket.BinaryMessage, msg)
+	if pooled {
+		defer zutils.PutBuffer(msg)
+	}
+	err = c.Send(msg)
 	if err != nil {
 		zlog.Ins().ErrorF("SendMsg err msg ID = %d, data = %+v, err = %+v", msgID, string(msg), err)
 		return err
@@ -316,26 +410,32 @@ func (c *WsConnection) SendMsg(msgID uint32, data []byte) error {
 	return nil
 }
 
-func (c *WsConnection) SendBuffMsg(msgID uint32, data []byte) error {
-	c.msgLock.RLock()
-	defer c.msgLock.RUnlock()
-
-	if c.msgBuffChan == nil {
-		c.msgBuffChan = make(chan []byte, zconf.GlobalObject.MaxMsgChanLen)
-		// Start the Goroutine for writing back to the client data stream
-		// This method only reads data from MsgBuffChan, allocating memory and starting Goroutine without calling SendBuffMsg
-		// (开启用于写回客户端数据流程的Goroutine
-		// 此方法只读取MsgBuffChan中的数据没调用SendBuffMsg可以分配内存和启用协程)
-		go c.StartWriter()
+// 直接发送携带请求ID的消息
+func (c *WsConnection) SendMsgWithRequestID(msgID uint32, requestID uint32, data []byte) error {
+	msg, err := packRequestIDMsg(c.packet, msgID, requestID, data)
+	if err != nil {
+		return err
 	}
+	defer zutils.PutBuffer(msg)
 
-	idleTimeout := time.NewTimer(5 * time.Millisecond)
-	defer idleTimeout.Stop()
+	return c.Send(msg)
+}
 
-	if c.isClosed == true {
-		return errors.New("WsConnection closed when send buff msg")
-	}
+func (c *WsConnection) SendBuffMsg(msgID uint32, data []byte) error {
+	return c.SendBuffMsgContext(context.Background(), msgID, data)
+}
+
+// 有缓冲发送，队列已满时按照链接的溢出策略处理，block/timeout策略下最多等待到ctx结束
+func (c *WsConnection) SendBuffMsgContext(ctx context.Context, msgID uint32, data []byte) error {
+	return c.sendBuffMsg(ctx, msgID, data, ziface.SendPriorityNormal)
+}
+
+// 按优先级有缓冲发送，写goroutine总是先写出高优先级通道中的消息
+func (c *WsConnection) SendBuffMsgWithPriority(msgID uint32, data []byte, priority ziface.SendPriority) error {
+	return c.sendBuffMsg(context.Background(), msgID, data, priority)
+}
 
+func (c *WsConnection) sendBuffMsg(ctx context.Context, msgID uint32, data []byte, priority ziface.SendPriority) error {
 	// Package data and send
 	// (将data封包，并且发送)
 	msg, err := c.packet.Pack(zpack.NewMsgPackage(msgID, data))
@@ -344,23 +444,100 @@ func (c *WsConnection) SendBuffMsg(msgID uint32, data []byte) error {
 		return errors.New("Pack error msg ")
 	}
 
-	// Send timeout
-	select {
-	case <-idleTimeout.C:
-		return errors.New("send buff msg timeout")
-	case c.msgBuffChan <- msg:
-		return nil
+	return c.pushSendQueue(ctx, msg, priority)
+}
+
+// 放入缓冲发送队列，首次使用时创建队列并启动写goroutine
+func (c *WsConnection) pushSendQueue(ctx context.Context, data []byte, priority ziface.SendPriority) error {
+	c.msgLock.RLock()
+	if c.isClosed == true {
+		c.msgLock.RUnlock()
+		return errors.New("WsConnection closed when send buff msg")
 	}
+	if c.sendQueue.init() {
+		// Start the Goroutine for writing back to the client data stream
+		// (开启用于写回客户端数据流程的Goroutine)
+		go c.StartWriter()
+	}
+	disconnect, overHigh, err := c.sendQueue.push(ctx, c.ctx, data, priority)
+	c.msgLock.RUnlock()
+
+	// 关闭链接需要获取msgLock写锁，高水位回调中也可能再次发送或关闭链接，均在释放读锁之后进行
+	if overHigh {
+		c.sendQueue.notifyHigh()
+	}
+	if disconnect {
+		c.StopWithReason(ziface.CloseReasonSlowConsumer, err)
+	}
+	return err
+}
+
+// 等待调用之前通过SendBuffMsg/SendToQueue放入队列的消息全部写出
+func (c *WsConnection) Flush() error {
+	c.msgLock.RLock()
+	defer c.msgLock.RUnlock()
+
+	if c.isClosed == true {
+		return errors.New("WsConnection closed when flush")
+	}
+	if c.sendQueue.init() {
+		go c.StartWriter()
+	}
+	return c.sendQueue.flush(c.ctx)
+}
+
+// 设置缓冲发送队列已满时的处理策略
+func (c *WsConnection) SetSendQueuePolicy(policy string) error {
+	return c.sendQueue.setPolicy(policy)
+}
+
+// 设置缓冲发送队列的高/低水位线以及回调
+func (c *WsConnection) SetSendQueueWatermark(high, low int, callback func(conn ziface.IConnection, overHigh bool)) {
+	c.sendQueue.setWatermark(high, low, callback)
+}
+
+// 缓冲发送队列中尚未写出的消息数量
+func (c *WsConnection) GetSendQueueLen() int {
+	return c.sendQueue.depth()
+}
+
+// 缓冲发送队列的容量
+func (c *WsConnection) GetSendQueueCap() int {
+	return c.sendQueue.capacity()
+}
+
+// 缓冲发送队列各优先级通道的统计
+func (c *WsConnection) GetSendQueueStats() []ziface.SendLaneStats {
+	return c.sendQueue.stats()
+}
+
+// 获取链接的流量统计
+func (c *WsConnection) GetStats() ziface.ConnStats {
+	stats := c.stats.snapshot()
+	stats.SendDropped = sendQueueDropped(c.sendQueue)
+	stats.QueueLen = c.sendQueue.depth()
+	return stats
 }
 
 func (c *WsConnection) finalizer() {
 	c.callOnConnStop()
 
+	if c.sessionMgr != nil {
+		c.sessionMgr.onConnStop(c)
+	}
+
+	if c.release() {
+		c.callOnConnRemoved()
+	}
+}
+
+// 关闭websocket并从ConnManager中移除，返回false表示链接已经被释放过
+func (c *WsConnection) release() bool {
 	c.msgLock.Lock()
-	c.msgLock.Unlock()
+	defer c.msgLock.Unlock()
 
 	if c.isClosed == true {
-		return
+		return false
 	}
 
 	if c.hc != nil {
@@ -373,13 +550,13 @@ func (c *WsConnection) finalizer() {
 		c.connManager.Remove(c)
 	}
 
-	if c.msgBuffChan != nil {
-		close(c.msgBuffChan)
-	}
+	c.sendQueue.close()
+	c.property.stopTimers()
 
 	c.isClosed = true
 
-	zlog.Ins().InfoF("Conn Stop()...ConnID = %d", c.connID)
+	zlog.Ins().InfoF("Conn Stop()...ConnID = %d, reason = %s", c.connID, c.closeReason)
+	return true
 }
 
 func (c *WsConnection) callOnConnStart() {
@@ -389,6 +566,32 @@ func (c *WsConnection) callOnConnStart() {
 	}
 }
 
+// 拷贝当前的链接属性，会话在链接之间迁移时使用
+func (c *WsConnection) snapshotProperties() map[string]propertyValue {
+	return c.property.snapshot()
+}
+
+// 恢复会话保存的链接属性
+func (c *WsConnection) restoreProperties(properties map[string]propertyValue) {
+	c.property.restore(c, properties)
+}
+
+// 调用onConnBeforeClose Hook函数
+func (c *WsConnection) callOnConnBeforeClose() {
+	if c.onConnBeforeClose != nil {
+		zlog.Ins().InfoF("ZINX CallOnConnBeforeClose....")
+		c.onConnBeforeClose(c)
+	}
+}
+
+// 调用onConnRemoved Hook函数
+func (c *WsConnection) callOnConnRemoved() {
+	if c.onConnRemoved != nil {
+		zlog.Ins().InfoF("ZINX CallOnConnRemoved....")
+		c.onConnRemoved(c)
+	}
+}
+
 func (c *WsConnection) callOnConnStop() {
 	if c.onConnStop != nil {
 		zlog.Ins().InfoF("ZINX CallOnConnStop....")
@@ -410,6 +613,21 @@ func (c *WsConnection) updateActivity() {
 	c.lastActivityTime = time.Now()
 }
 
+// 设置读超时
+func (c *WsConnection) SetReadTimeout(timeout time.Duration) {
+	c.timeout.setRead(timeout)
+}
+
+// 设置写超时
+func (c *WsConnection) SetWriteTimeout(timeout time.Duration) {
+	c.timeout.setWrite(timeout)
+}
+
+// 设置空闲超时
+func (c *WsConnection) SetIdleTimeout(timeout time.Duration) {
+	c.timeout.setIdle(timeout)
+}
+
 func (c *WsConnection) GetConnection() net.Conn {
 	return nil
 }
@@ -444,20 +662,16 @@ func (c *WsConnection) LocalAddr() net.Addr {
 }
 
 func (c *WsConnection) SetProperty(key string, value interface{}) {
-	c.propertyLock.Lock()
-	defer c.propertyLock.Unlock()
-	if c.property == nil {
-		c.property = make(map[string]interface{})
-	}
+	c.property.set(c, key, value, 0)
+}
 
-	c.property[key] = value
+// 设置带有效期的链接属性
+func (c *WsConnection) SetPropertyWithTTL(key string, value interface{}, ttl time.Duration) {
+	c.property.set(c, key, value, ttl)
 }
 
 func (c *WsConnection) GetProperty(key string) (interface{}, error) {
-	c.propertyLock.Lock()
-	defer c.propertyLock.Unlock()
-
-	if value, ok := c.property[key]; ok {
+	if value, ok := c.property.get(key); ok {
 		return value, nil
 	}
 
@@ -465,10 +679,27 @@ func (c *WsConnection) GetProperty(key string) (interface{}, error) {
 }
 
 func (c *WsConnection) RemoveProperty(key string) {
-	c.propertyLock.Lock()
-	defer c.propertyLock.Unlock()
+	c.property.remove(c, key)
+}
+
+// 添加链接属性变化的Hook函数
+func (c *WsConnection) AddPropertyChangeHook(hook ziface.PropertyChangeHook) {
+	c.property.addHook(hook)
+}
+
+// 缓冲发送队列中尚未写出的消息数量(包括已取出正在写的消息)
+func (c *WsConnection) pendingSendCount() int {
+	return c.sendQueue.depth()
+}
+
+// 获取接收该链接的监听器名称
+func (c *WsConnection) GetListenerName() string {
+	return c.listenerName
+}
 
-	delete(c.property, key)
+// 获取wss链接中已通过校验的对端证书
+func (c *WsConnection) GetPeerCertificate() *x509.Certificate {
+	return peerCertificate(c.conn.UnderlyingConn())
 }
 
 // 返回ctx，用于用户自定义的go程获取连接退出状态
@@ -0,0 +1,80 @@
+package znet
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"zinx_server/zinx/zconf"
+)
+
+// 等待Server的所有监听器开启，返回指定监听器实际监听的地址
+func listenerAddr(t *testing.T, s *Server, name string) string {
+	select {
+	case <-s.listenersReady:
+	case <-time.After(3 * time.Second):
+		t.Fatal("listeners not ready")
+	}
+	s.socketsLock.Lock()
+	defer s.socketsLock.Unlock()
+	return s.sockets[name].(net.Listener).Addr().String()
+}
+
+func TestWebsocketListener(t *testing.T) {
+	hello := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	// 同一进程中开启两个带websocket监听器的Server
+	s1 := NewServer(WithHttpHandler(hello)).(*Server)
+	s1.Listeners = []zconf.ListenerConfig{{Name: "ws1", Mode: zconf.ServerModeWebsocket, Host: "127.0.0.1", WsPath: "/ws"}}
+	s1.Start()
+	defer s1.Stop()
+
+	s2 := NewServer().(*Server)
+	s2.Listeners = []zconf.ListenerConfig{{Name: "ws2", Mode: zconf.ServerModeWebsocket, Host: "127.0.0.1"}}
+	s2.Start()
+	defer s2.Stop()
+
+	addr1 := listenerAddr(t, s1, "ws1")
+	addr2 := listenerAddr(t, s2, "ws2")
+
+	// 子协议按照各自请求协商
+	dialer := websocket.Dialer{Subprotocols: []string{"zinx.v1"}}
+	conn, _, err := dialer.Dial("ws://"+addr1+"/ws", nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Equal(t, "zinx.v1", conn.Subprotocol())
+	conn2, _, err := websocket.DefaultDialer.Dial("ws://"+addr2+"/", nil)
+	assert.Nil(t, err)
+	defer conn2.Close()
+	assert.Equal(t, "", conn2.Subprotocol())
+	assert.Eventually(t, func() bool {
+		return s1.GetConnMgr().Len() == 1 && s2.GetConnMgr().Len() == 1
+	}, 3*time.Second, 10*time.Millisecond)
+
+	// websocket路径以外的请求交给挂载的http.Handler
+	resp, err := http.Get("http://" + addr1 + "/index")
+	assert.Nil(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	assert.Equal(t, "hello", string(body))
+
+	// 将升级处理器挂载到用户自己的http服务中
+	mux := http.NewServeMux()
+	mux.Handle("/game", s2.WebsocketHandler())
+	httpServer := httptest.NewServer(mux)
+	defer httpServer.Close()
+
+	conn3, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(httpServer.URL, "http")+"/game", nil)
+	assert.Nil(t, err)
+	defer conn3.Close()
+	assert.Eventually(t, func() bool {
+		return s2.GetConnMgr().Len() == 2
+	}, 3*time.Second, 10*time.Millisecond)
+}
@@ -29,26 +29,25 @@ func (dp *DataPackLtv) GetHeadLen() uint32 {
 // Pack packs the message (compresses the data)
 // (封包方法,压缩数据)
 func (dp *DataPackLtv) Pack(msg ziface.IMessage) ([]byte, error) {
-	// Create a buffer to store the bytes
-	// (创建一个存放bytes字节的缓冲)
-	dataBuff := bytes.NewBuffer([]byte{})
+	data := msg.GetData()
+	dataBuff := make([]byte, defaultHeaderLen, int(defaultHeaderLen)+len(data))
 
 	// Write the data length
-	if err := binary.Write(dataBuff, binary.LittleEndian, msg.GetDataLen()); err != nil {
-		return nil, err
-	}
-
+	binary.LittleEndian.PutUint32(dataBuff[0:4], msg.GetDataLen())
 	// Write the message ID
-	if err := binary.Write(dataBuff, binary.LittleEndian, msg.GetMsgID()); err != nil {
-		return nil, err
-	}
-
+	binary.LittleEndian.PutUint32(dataBuff[4:8], msg.GetMsgID())
 	// Write the data
-	if err := binary.Write(dataBuff, binary.LittleEndian, msg.GetData()); err != nil {
-		return nil, err
-	}
+	dataBuff = append(dataBuff, data...)
+
+	return dataBuff, nil
+}
 
-	return dataBuff.Bytes(), nil
+// AppendPack packs the message and appends it to dst, no allocation happens when dst has enough capacity
+// (将消息封包后追加到dst中，dst容量足够时不会产生内存分配)
+func (dp *DataPackLtv) AppendPack(dst []byte, msgID uint32, data []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(data)))
+	dst = binary.LittleEndian.AppendUint32(dst, msgID)
+	return append(dst, data...)
 }
 
 // Unpack unpacks the message (decompresses the data)
@@ -0,0 +1,77 @@
+package zpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"zinx_server/zinx/zconf"
+	"zinx_server/zinx/ziface"
+)
+
+/*
+	携带请求ID的封包方式，在标准TLV包头之后追加4字节请求ID
+	+---------------+---------------+---------------+---------------+
+	|     MsgID     |    DataLen    |   RequestID   |     Data      |
+	| uint32(4byte) | uint32(4byte) | uint32(4byte) |    n byte     |
+	+---------------+---------------+---------------+---------------+
+	请求ID为0表示普通消息，非0表示请求-响应式调用的消息
+*/
+
+var rpcHeaderLen uint32 = 12
+
+type RPCDataPack struct{}
+
+func NewRPCDataPack() ziface.IDataPack {
+	return &RPCDataPack{}
+}
+
+// 获取包头长度
+func (dp *RPCDataPack) GetHeadLen() uint32 {
+	return rpcHeaderLen
+}
+
+// 封包方法，消息实现了ziface.IRequestIDMessage时写入其请求ID
+func (dp *RPCDataPack) Pack(msg ziface.IMessage) ([]byte, error) {
+	var requestID uint32
+	if m, ok := msg.(ziface.IRequestIDMessage); ok {
+		requestID = m.GetRequestID()
+	}
+	data := msg.GetData()
+	dataBuff := make([]byte, rpcHeaderLen, int(rpcHeaderLen)+len(data))
+
+	binary.BigEndian.PutUint32(dataBuff[0:4], msg.GetMsgID())
+	binary.BigEndian.PutUint32(dataBuff[4:8], msg.GetDataLen())
+	binary.BigEndian.PutUint32(dataBuff[8:12], requestID)
+
+	return append(dataBuff, data...), nil
+}
+
+// 封包追加到dst中，请求ID为0
+func (dp *RPCDataPack) AppendPack(dst []byte, msgID uint32, data []byte) []byte {
+	return dp.AppendPackWithRequestID(dst, msgID, 0, data)
+}
+
+// 将携带请求ID的消息封包后追加到dst中
+func (dp *RPCDataPack) AppendPackWithRequestID(dst []byte, msgID uint32, requestID uint32, data []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, msgID)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(data)))
+	dst = binary.BigEndian.AppendUint32(dst, requestID)
+	return append(dst, data...)
+}
+
+// 拆包方法，只解析包头
+func (dp *RPCDataPack) Unpack(binaryData []byte) (ziface.IMessage, error) {
+	if len(binaryData) < int(rpcHeaderLen) {
+		return nil, errors.New("rpc pack head too short")
+	}
+	msg := &Message{
+		ID:        binary.BigEndian.Uint32(binaryData[0:4]),
+		DataLen:   binary.BigEndian.Uint32(binaryData[4:8]),
+		RequestID: binary.BigEndian.Uint32(binaryData[8:12]),
+	}
+
+	// 判断dataLen的长度是否超出我们允许的最大包长度
+	if zconf.GlobalObject.MaxPacketSize > 0 && msg.GetDataLen() > zconf.GlobalObject.MaxPacketSize {
+		return nil, errors.New("Too large msg data received! ")
+	}
+	return msg, nil
+}
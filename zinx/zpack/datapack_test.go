@@ -7,6 +7,7 @@ import (
 	"testing"
 	"time"
 	"zinx_server/zinx/ziface"
+	"zinx_server/zinx/zutils"
 )
 
 func TestDataPack(t *testing.T) {
@@ -105,3 +106,80 @@ func TestDataPack(t *testing.T) {
 	}
 
 }
+
+func TestDataPackAppendPack(t *testing.T) {
+	dp := NewDataPack()
+	data := []byte("zinx")
+
+	packed, err := dp.Pack(NewMsgPackage(1, data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	appended := dp.(ziface.IDataPackAppender).AppendPack(make([]byte, 0, 16), 1, data)
+	if string(packed) != string(appended) {
+		t.Errorf("AppendPack = %v, Pack = %v", appended, packed)
+	}
+
+	msg := GetMessage(1, data)
+	if msg.GetDataLen() != 4 || string(msg.GetData()) != "zinx" {
+		t.Errorf("GetMessage = %+v", msg)
+	}
+	msg.Release()
+	if msg.GetData() != nil {
+		t.Error("released message should be reset")
+	}
+}
+
+func TestRPCDataPack(t *testing.T) {
+	dp := Factory().NewPack(ziface.ZinxDataPackRPC)
+	data := []byte("zinx")
+
+	msg := NewMsgPackage(1, data)
+	msg.SetRequestID(7)
+	packed, err := dp.Pack(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packed) != int(dp.GetHeadLen())+len(data) {
+		t.Fatalf("packed len = %d", len(packed))
+	}
+	appended := dp.(ziface.IDataPackRequestID).AppendPackWithRequestID(nil, 1, 7, data)
+	if string(packed) != string(appended) {
+		t.Errorf("AppendPackWithRequestID = %v, Pack = %v", appended, packed)
+	}
+
+	head, err := dp.Unpack(packed[:dp.GetHeadLen()])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.GetMsgID() != 1 || head.GetDataLen() != 4 || head.(ziface.IRequestIDMessage).GetRequestID() != 7 {
+		t.Errorf("Unpack = %+v", head)
+	}
+
+	// 普通消息的请求ID为0
+	head, _ = dp.Unpack(dp.(ziface.IDataPackAppender).AppendPack(nil, 2, data))
+	if head.(ziface.IRequestIDMessage).GetRequestID() != 0 {
+		t.Errorf("AppendPack requestID = %d", head.(ziface.IRequestIDMessage).GetRequestID())
+	}
+}
+
+// go test -run=^$ -bench=Pack ./zpack
+func BenchmarkPack(b *testing.B) {
+	dp := NewDataPack()
+	data := make([]byte, 128)
+
+	b.Run("Pack", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = dp.Pack(NewMsgPackage(1, data))
+		}
+	})
+	b.Run("AppendPack", func(b *testing.B) {
+		appender := dp.(ziface.IDataPackAppender)
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			buf := zutils.GetBuffer(int(dp.GetHeadLen()) + len(data))
+			zutils.PutBuffer(appender.AppendPack(buf[:0], 1, data))
+		}
+	})
+}
@@ -24,24 +24,24 @@ func (dp *DataPack) GetHeadLen() uint32 {
 
 // 封包方法，压缩数据
 func (dp *DataPack) Pack(msg ziface.IMessage) ([]byte, error) {
-	dataBuff := bytes.NewBuffer([]byte{})
+	data := msg.GetData()
+	dataBuff := make([]byte, defaultHeaderLen, int(defaultHeaderLen)+len(data))
 
 	// Write the message ID
-	if err := binary.Write(dataBuff, binary.BigEndian, msg.GetMsgID()); err != nil {
-		return nil, err
-	}
-
+	binary.BigEndian.PutUint32(dataBuff[0:4], msg.GetMsgID())
 	// Write the data length
-	if err := binary.Write(dataBuff, binary.BigEndian, msg.GetDataLen()); err != nil {
-		return nil, err
-	}
-
+	binary.BigEndian.PutUint32(dataBuff[4:8], msg.GetDataLen())
 	// Write the data
-	if err := binary.Write(dataBuff, binary.BigEndian, msg.GetData()); err != nil {
-		return nil, err
-	}
+	dataBuff = append(dataBuff, data...)
+
+	return dataBuff, nil
+}
 
-	return dataBuff.Bytes(), nil
+// 将消息封包后追加到dst中，dst容量足够时不会产生内存分配
+func (dp *DataPack) AppendPack(dst []byte, msgID uint32, data []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, msgID)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(data)))
+	return append(dst, data...)
 }
 
 // 拆包方法，解压数据
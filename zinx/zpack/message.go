@@ -1,10 +1,37 @@
 package zpack
 
+import (
+	"sync"
+	"zinx_server/zinx/zutils"
+)
+
 type Message struct {
 	DataLen uint32
 	ID      uint32
 	Data    []byte
 	rawData []byte
+	// 请求ID，只有携带请求ID的封包方式使用
+	RequestID uint32
+
+	// 是否来自消息池，以及rawData是否为缓冲池中的缓冲区
+	pooled bool
+}
+
+var messagePool = sync.Pool{
+	New: func() interface{} {
+		return new(Message)
+	},
+}
+
+// 从消息池中获取消息，数据拷贝到缓冲池分配的缓冲区中，使用完毕后需要调用Release归还
+func GetMessage(ID uint32, data []byte) *Message {
+	buf := zutils.GetBuffer(len(data))
+	copy(buf, data)
+
+	msg := messagePool.Get().(*Message)
+	msg.Init(ID, buf)
+	msg.pooled = true
+	return msg
 }
 
 func NewMsgPackage(ID uint32, data []byte) *Message {
@@ -35,6 +62,7 @@ func NewMessageByMsgId(id uint32, len uint32, data []byte) *Message {
 
 func (msg *Message) Init(ID uint32, data []byte) {
 	msg.ID = ID
+	msg.RequestID = 0
 	msg.Data = data
 	msg.rawData = data
 	msg.DataLen = uint32(len(data))
@@ -67,3 +95,22 @@ func (msg *Message) SetMsgID(msgID uint32) {
 func (msg *Message) SetData(data []byte) {
 	msg.Data = data
 }
+
+func (msg *Message) GetRequestID() uint32 {
+	return msg.RequestID
+}
+
+func (msg *Message) SetRequestID(requestID uint32) {
+	msg.RequestID = requestID
+}
+
+// 将消息及其数据缓冲区归还到池中，之后不能再使用该消息以及GetData/GetRawData返回的数据
+// 不是通过GetMessage获取的消息调用Release没有任何效果
+func (msg *Message) Release() {
+	if !msg.pooled {
+		return
+	}
+	zutils.PutBuffer(msg.rawData)
+	*msg = Message{}
+	messagePool.Put(msg)
+}
@@ -29,6 +29,8 @@ func (f *pack_factory) NewPack(kind string) ziface.IDataPack {
 	switch kind {
 	case ziface.ZinxDataPack:
 		dataPack = NewDataPack()
+	case ziface.ZinxDataPackRPC:
+		dataPack = NewRPCDataPack()
 	case ziface.ZinxDataPackOld:
 		//dataPack = NewDataPackLtv()
 		//不实现小端LTV方法
@@ -0,0 +1,63 @@
+package zutils
+
+import (
+	"math/bits"
+	"sync"
+	"unsafe"
+)
+
+/*
+	按容量分级的字节缓冲池
+	容量为2的幂，从64B到1MB，超出范围的缓冲区直接分配且不会被回收复用
+	池中保存的是底层数组的指针，Get/Put本身不会产生内存分配
+*/
+
+const (
+	minBufferSizeBits = 6  // 64B
+	maxBufferSizeBits = 20 // 1MB
+)
+
+var bufferPools [maxBufferSizeBits - minBufferSizeBits + 1]sync.Pool
+
+// 获取长度为size的缓冲区，缓冲区中的内容是未初始化的
+func GetBuffer(size int) []byte {
+	if size <= 0 {
+		return nil
+	}
+	idx, ok := bufferPoolIndex(size)
+	if !ok {
+		return make([]byte, size)
+	}
+
+	capacity := 1 << (idx + minBufferSizeBits)
+	if p := bufferPools[idx].Get(); p != nil {
+		return unsafe.Slice((*byte)(p.(unsafe.Pointer)), capacity)[:size]
+	}
+	return make([]byte, size, capacity)
+}
+
+// 归还由GetBuffer获取的缓冲区，归还之后不能再使用该缓冲区
+// 容量不属于任何分级的缓冲区会被直接丢弃
+func PutBuffer(buf []byte) {
+	c := cap(buf)
+	if c == 0 || c&(c-1) != 0 {
+		return
+	}
+	idx, ok := bufferPoolIndex(c)
+	if !ok {
+		return
+	}
+	bufferPools[idx].Put(unsafe.Pointer(unsafe.SliceData(buf[:1])))
+}
+
+// 能容纳size个字节的最小分级
+func bufferPoolIndex(size int) (int, bool) {
+	n := bits.Len(uint(size - 1))
+	if n < minBufferSizeBits {
+		n = minBufferSizeBits
+	}
+	if n > maxBufferSizeBits {
+		return 0, false
+	}
+	return n - minBufferSizeBits, true
+}
@@ -0,0 +1,40 @@
+package zutils
+
+import (
+	"testing"
+)
+
+func TestBufferPool(t *testing.T) {
+	buf := GetBuffer(100)
+	if len(buf) != 100 || cap(buf) != 128 {
+		t.Errorf("GetBuffer(100) len = %d, cap = %d", len(buf), cap(buf))
+	}
+	copy(buf, "zinx")
+	PutBuffer(buf)
+
+	// 同一分级的缓冲区可以被复用
+	buf = GetBuffer(128)
+	if len(buf) != 128 || cap(buf) != 128 {
+		t.Errorf("GetBuffer(128) len = %d, cap = %d", len(buf), cap(buf))
+	}
+	PutBuffer(buf)
+
+	// 超出分级范围的缓冲区不会被池化
+	large := GetBuffer(1<<maxBufferSizeBits + 1)
+	if len(large) != 1<<maxBufferSizeBits+1 {
+		t.Errorf("GetBuffer(large) len = %d", len(large))
+	}
+	PutBuffer(large)
+	PutBuffer(make([]byte, 100))
+
+	if GetBuffer(0) != nil {
+		t.Error("GetBuffer(0) should be nil")
+	}
+}
+
+func BenchmarkBufferPool(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		PutBuffer(GetBuffer(1024))
+	}
+}